@@ -0,0 +1,113 @@
+// Package ballot 免 gas 投票中选票与计票结果的编码，与 BallotAnchor 合约以及前端的签名保持一致
+// 不依赖数据库，可以在离线工具与单元测试中使用
+package ballot
+
+import (
+	"backend/config"
+	"backend/tally"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/pkg/errors"
+	"math/big"
+	"sort"
+)
+
+const (
+	domainName    = "VotingChain Ballot"
+	domainVersion = "1"
+)
+
+// TypedData 返回选票的 EIP-712 结构，前端用 eth_signTypedData_v4 签名
+// domain 中的 verifyingContract 是投票合约，选票不能被挪用到其他投票
+func TypedData(contractAddr, voterAddr string, option, issuedAt int64) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Ballot": {
+				{Name: "voter", Type: "address"},
+				{Name: "option", Type: "int256"},
+				{Name: "issuedAt", Type: "uint256"},
+			},
+		},
+		PrimaryType: "Ballot",
+		Domain: apitypes.TypedDataDomain{
+			Name:              domainName,
+			Version:           domainVersion,
+			ChainId:           math.NewHexOrDecimal256(config.G.Blockchain.ChainID),
+			VerifyingContract: common.HexToAddress(contractAddr).Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"voter":    common.HexToAddress(voterAddr).Hex(),
+			"option":   fmt.Sprint(option),
+			"issuedAt": fmt.Sprint(issuedAt),
+		},
+	}
+}
+
+func mustType(t string) abi.Type {
+	typ, err := abi.NewType(t, "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
+
+var leafArgs = abi.Arguments{{Type: mustType("address")}, {Type: mustType("int256")}, {Type: mustType("uint256")}}
+
+// Leaf 计算选票在 Merkle 树中的叶子，与 BallotAnchor 合约的说明一致：
+// keccak256(bytes.concat(keccak256(abi.encode(address voter, int256 option, uint256 issuedAt))))
+func Leaf(voterAddr string, option, issuedAt int64) (common.Hash, error) {
+	encoded, err := leafArgs.Pack(common.HexToAddress(voterAddr), big.NewInt(option), big.NewInt(issuedAt))
+	if err != nil {
+		return common.Hash{}, errors.Wrapf(err, "failed to encode ballot")
+	}
+	return crypto.Keccak256Hash(crypto.Keccak256(encoded)), nil
+}
+
+var resultArgs = abi.Arguments{
+	{Name: "options", Type: mustType("int256[]")},
+	{Name: "votes", Type: mustType("uint256[]")},
+	{Name: "electorate", Type: mustType("uint256")},
+	{Name: "cast", Type: mustType("uint256")},
+	{Name: "abstained", Type: mustType("uint256")},
+	{Name: "quorumMet", Type: mustType("bool")},
+	{Name: "passed", Type: mustType("bool")},
+	{Name: "winners", Type: mustType("int256[]")},
+}
+
+// ResultHash 计算计票结果的哈希，与锚定交易中的 resultHash 对应：
+// keccak256(abi.encode(int256[] options, uint256[] votes, uint256 electorate, uint256 cast, uint256 abstained,
+// bool quorumMet, bool passed, int256[] winners))
+// options 按选项 id 升序排列，votes 与之一一对应；说明文字与比例不参与哈希，任何人都可以由公开的得票重新计算
+func ResultHash(res *tally.Result) (common.Hash, error) {
+	counts := make([]tally.OptionCount, len(res.Counts))
+	copy(counts, res.Counts)
+	sort.Slice(counts, func(i, j int) bool { return counts[i].ID < counts[j].ID })
+
+	options := make([]*big.Int, 0, len(counts))
+	votes := make([]*big.Int, 0, len(counts))
+	for _, count := range counts {
+		options = append(options, big.NewInt(count.ID))
+		votes = append(votes, big.NewInt(int64(count.Votes)))
+	}
+	winners := make([]*big.Int, 0, len(res.Winners))
+	for _, w := range res.Winners {
+		winners = append(winners, big.NewInt(w))
+	}
+
+	encoded, err := resultArgs.Pack(options, votes, big.NewInt(int64(res.Electorate)), big.NewInt(int64(res.Cast)),
+		big.NewInt(int64(res.Abstained)), res.QuorumMet, res.Passed, winners)
+	if err != nil {
+		return common.Hash{}, errors.Wrapf(err, "failed to encode tally result")
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
@@ -0,0 +1,198 @@
+package ballot
+
+import (
+	"backend/config"
+	"backend/tally"
+	"backend/utils"
+	"crypto/ecdsa"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+const testContract = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+
+func TestLeafEncoding(t *testing.T) {
+	tests := []struct {
+		voter    string
+		option   int64
+		issuedAt int64
+	}{
+		{"0x70997970C51812dc3A010C7d01b50e0d17dc79C8", 1, 1700000000},
+		{"0x0000000000000000000000000000000000000001", 42, 0},
+		{"0xffffffffffffffffffffffffffffffffffffffff", 1 << 40, 1 << 50},
+	}
+	for _, tt := range tests {
+		// abi.encode 的每个参数都是 32 字节：address 与 uint256 左侧补零，int256 为补码
+		var encoded []byte
+		encoded = append(encoded, common.LeftPadBytes(common.HexToAddress(tt.voter).Bytes(), 32)...)
+		encoded = append(encoded, common.LeftPadBytes(big.NewInt(tt.option).Bytes(), 32)...)
+		encoded = append(encoded, common.LeftPadBytes(big.NewInt(tt.issuedAt).Bytes(), 32)...)
+		want := crypto.Keccak256Hash(crypto.Keccak256(encoded))
+
+		got, err := Leaf(tt.voter, tt.option, tt.issuedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Leaf(%s, %d, %d) = %s, want %s", tt.voter, tt.option, tt.issuedAt, got.Hex(), want.Hex())
+		}
+	}
+}
+
+func TestLeafDependsOnEveryField(t *testing.T) {
+	base, _ := Leaf("0x70997970C51812dc3A010C7d01b50e0d17dc79C8", 1, 100)
+	others := []common.Hash{}
+	for _, args := range []struct {
+		voter            string
+		option, issuedAt int64
+	}{
+		{"0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC", 1, 100},
+		{"0x70997970C51812dc3A010C7d01b50e0d17dc79C8", 2, 100},
+		{"0x70997970C51812dc3A010C7d01b50e0d17dc79C8", 1, 101},
+	} {
+		leaf, err := Leaf(args.voter, args.option, args.issuedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		others = append(others, leaf)
+	}
+	for i, leaf := range others {
+		if leaf == base {
+			t.Errorf("case %d: leaf should change with the ballot", i)
+		}
+	}
+}
+
+// signTypedData 模拟钱包的 eth_signTypedData_v4，返回 v 为 27/28 的签名
+func signTypedData(t *testing.T, key *ecdsa.PrivateKey, typedData apitypes.TypedData) string {
+	t.Helper()
+	digest, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(digest, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return hexutil.Encode(sig)
+}
+
+func TestRecoverBallotSigner(t *testing.T) {
+	config.G.Blockchain.ChainID = 1337
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	voter := crypto.PubkeyToAddress(key.PublicKey)
+	typedData := TypedData(testContract, voter.Hex(), 2, 1700000000)
+	sig := signTypedData(t, key, typedData)
+
+	signer, digest, err := utils.RecoverTypedDataSigner(typedData, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer != voter {
+		t.Fatalf("signer = %s, want %s", signer.Hex(), voter.Hex())
+	}
+	want, _, _ := apitypes.TypedDataAndHash(typedData)
+	if digest != common.BytesToHash(want) {
+		t.Fatalf("digest = %s, want %s", digest.Hex(), hexutil.Encode(want))
+	}
+
+	// 签名绑定了选项、投票合约与链，换任何一项都恢复出其他地址
+	tampered := []apitypes.TypedData{
+		TypedData(testContract, voter.Hex(), 3, 1700000000),
+		TypedData("0x0000000000000000000000000000000000000001", voter.Hex(), 2, 1700000000),
+	}
+	config.G.Blockchain.ChainID = 1
+	tampered = append(tampered, TypedData(testContract, voter.Hex(), 2, 1700000000))
+	for i, td := range tampered {
+		signer, _, err := utils.RecoverTypedDataSigner(td, sig)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if signer == voter {
+			t.Errorf("case %d: signature should not match the changed ballot", i)
+		}
+	}
+}
+
+func TestRecoverRejectsMalformedSignature(t *testing.T) {
+	typedData := TypedData(testContract, "0x70997970C51812dc3A010C7d01b50e0d17dc79C8", 1, 1)
+	// 空签名、长度不是 65 字节、不是十六进制、以及 r 与 s 为零无法恢复公钥
+	for _, sig := range []string{"", "0x1234", "not hex", "0x" + strings.Repeat("00", 64) + "1b"} {
+		if _, _, err := utils.RecoverTypedDataSigner(typedData, sig); err == nil {
+			t.Errorf("signature %q should be rejected", sig)
+		}
+	}
+}
+
+func testResult() *tally.Result {
+	return &tally.Result{
+		Rule: tally.RulePlurality,
+		Counts: []tally.OptionCount{
+			{Option: tally.Option{ID: 2, Label: "B"}, Votes: 3, Share: 0.6},
+			{Option: tally.Option{ID: 1, Label: "A"}, Votes: 2, Share: 0.4},
+		},
+		Electorate:  6,
+		Cast:        5,
+		Valid:       5,
+		QuorumMet:   true,
+		Leading:     []int64{2},
+		Winners:     []int64{2},
+		Passed:      true,
+		Explanation: []string{"Option #2 wins"},
+	}
+}
+
+func TestResultHashIsCanonical(t *testing.T) {
+	want, err := ResultHash(testResult())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 得票的顺序、标签、比例与说明不影响哈希
+	res := testResult()
+	res.Counts[0], res.Counts[1] = res.Counts[1], res.Counts[0]
+	res.Counts[0].Label = "renamed"
+	res.Counts[0].Share = 0
+	res.Explanation = nil
+	if got, _ := ResultHash(res); got != want {
+		t.Fatalf("hash changed with presentation only: %s, want %s", got.Hex(), want.Hex())
+	}
+
+	changes := []func(r *tally.Result){
+		func(r *tally.Result) { r.Counts[0].Votes++ },
+		func(r *tally.Result) { r.Counts[1].ID = 3 },
+		func(r *tally.Result) { r.Electorate++ },
+		func(r *tally.Result) { r.Cast++ },
+		func(r *tally.Result) { r.Abstained++ },
+		func(r *tally.Result) { r.QuorumMet = false },
+		func(r *tally.Result) { r.Passed = false },
+		func(r *tally.Result) { r.Winners = []int64{} },
+	}
+	for i, change := range changes {
+		res := testResult()
+		change(res)
+		got, err := ResultHash(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == want {
+			t.Errorf("change %d should change the hash", i)
+		}
+	}
+}
+
+func TestResultHashEmpty(t *testing.T) {
+	// 没有选票的投票同样可以锚定
+	if _, err := ResultHash(&tally.Result{}); err != nil {
+		t.Fatal(err)
+	}
+}
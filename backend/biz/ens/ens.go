@@ -0,0 +1,235 @@
+package ens
+
+import (
+	"backend/config"
+	"backend/utils"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/pkg/errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 只包含用到的方法，与 ENS 以及 contracts/NameRegistry.sol 都兼容
+const registryABI = `[{"inputs":[{"name":"node","type":"bytes32"}],"name":"resolver","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"}]`
+const resolverABI = `[{"inputs":[{"name":"node","type":"bytes32"}],"name":"addr","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},` +
+	`{"inputs":[{"name":"node","type":"bytes32"}],"name":"name","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"}]`
+
+// cache 缓存正向与反向解析的结果，没有记录的结果也会缓存，按 LRU 淘汰
+var cache = lru.NewCache[string, cacheEntry](10000)
+
+type cacheEntry struct {
+	value    string
+	expireAt time.Time
+}
+
+// lookupConcurrency 批量反向解析时同时进行的查询数
+const lookupConcurrency = 8
+
+func cacheGet(key string) (string, bool) {
+	entry, ok := cache.Get(key)
+	if !ok || time.Now().After(entry.expireAt) {
+		return "", false
+	}
+	return entry.value, true
+}
+
+func cachePut(key, value string) {
+	ttl := time.Duration(config.G.ENS.CacheTTLSec) * time.Second
+	if ttl <= 0 {
+		return
+	}
+	cache.Add(key, cacheEntry{value: value, expireAt: time.Now().Add(ttl)})
+}
+
+// sharedClient 所有解析共用的 RPC 客户端，第一次使用时创建
+var sharedClient struct {
+	mu     sync.Mutex
+	client *ethclient.Client
+}
+
+func ethClient() (*ethclient.Client, error) {
+	sharedClient.mu.Lock()
+	defer sharedClient.mu.Unlock()
+	if sharedClient.client == nil {
+		client, err := utils.NewEthClient()
+		if err != nil {
+			return nil, errors.Wrapf(err, "New client err")
+		}
+		sharedClient.client = client
+	}
+	return sharedClient.client, nil
+}
+
+// Enabled 是否配置了注册表合约
+func Enabled() bool {
+	return config.G.ENS.RegistryAddr != ""
+}
+
+// IsName 输入中包含 . 时视为名称，否则视为十六进制地址
+func IsName(input string) bool {
+	return strings.Contains(input, ".")
+}
+
+// NormalizeName 转为小写并去掉首尾空白，不做完整的 UTS-46 规范化
+func NormalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Namehash 按 EIP-137 计算名称的节点
+func Namehash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node.Bytes(), crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+func getResolver(ctx context.Context, client *ethclient.Client, node common.Hash) (common.Address, error) {
+	var resolver common.Address
+	err := utils.CallViewMethodWithABI(ctx, client, registryABI, config.G.ENS.RegistryAddr, "resolver",
+		[]interface{}{[32]byte(node)}, &resolver)
+	if err != nil {
+		return common.Address{}, errors.Wrapf(err, "Call registry method 'resolver' err")
+	}
+	return resolver, nil
+}
+
+// ResolveName 正向解析，返回名称指向的钱包地址（没有 0x 前缀）
+func ResolveName(ctx context.Context, name string) (string, error) {
+	if !Enabled() {
+		return "", errors.New("Name resolution is not enabled")
+	}
+	name = NormalizeName(name)
+	if addr, ok := cacheGet("name:" + name); ok {
+		if addr == "" {
+			return "", errors.Errorf("Name '%s' is not registered", name)
+		}
+		return addr, nil
+	}
+
+	client, err := ethClient()
+	if err != nil {
+		return "", err
+	}
+	node := Namehash(name)
+	resolver, err := getResolver(ctx, client, node)
+	if err != nil {
+		return "", err
+	}
+	var addr common.Address
+	if resolver != (common.Address{}) {
+		err = utils.CallViewMethodWithABI(ctx, client, resolverABI, resolver.Hex(), "addr",
+			[]interface{}{[32]byte(node)}, &addr)
+		if err != nil {
+			return "", errors.Wrapf(err, "Call resolver method 'addr' err")
+		}
+	}
+
+	res := ""
+	if addr != (common.Address{}) {
+		res = utils.NormalizeHex(addr.Hex())
+	}
+	cachePut("name:"+name, res)
+	if res == "" {
+		return "", errors.Errorf("Name '%s' is not registered", name)
+	}
+	return res, nil
+}
+
+// LookupAddress 反向解析，返回钱包地址的主名称，没有记录时返回空字符串
+// 反向记录可以由地址持有者随意设置，因此只有正向解析也指回该地址时才会返回
+func LookupAddress(ctx context.Context, walletAddr string) (string, error) {
+	if !Enabled() {
+		return "", nil
+	}
+	walletAddr = utils.NormalizeHex(walletAddr)
+	if name, ok := cacheGet("addr:" + walletAddr); ok {
+		return name, nil
+	}
+
+	client, err := ethClient()
+	if err != nil {
+		return "", err
+	}
+	node := Namehash(walletAddr + ".addr.reverse")
+	resolver, err := getResolver(ctx, client, node)
+	if err != nil {
+		return "", err
+	}
+	var name string
+	if resolver != (common.Address{}) {
+		err = utils.CallViewMethodWithABI(ctx, client, resolverABI, resolver.Hex(), "name",
+			[]interface{}{[32]byte(node)}, &name)
+		if err != nil {
+			return "", errors.Wrapf(err, "Call resolver method 'name' err")
+		}
+	}
+
+	if name != "" {
+		addr, err := ResolveName(ctx, name)
+		if err != nil || addr != walletAddr {
+			name = ""
+		}
+	}
+	cachePut("addr:"+walletAddr, name)
+	return name, nil
+}
+
+// LookupAddresses 批量反向解析，返回 钱包地址 -> 名称，只包含有名称的地址
+// 解析失败只记录日志，不影响调用方；最多同时进行 lookupConcurrency 个查询
+func LookupAddresses(ctx context.Context, walletAddrs []string) map[string]string {
+	res := make(map[string]string)
+	if !Enabled() {
+		return res
+	}
+
+	seen := make(map[string]bool)
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, lookupConcurrency)
+	)
+	for _, walletAddr := range walletAddrs {
+		walletAddr = utils.NormalizeHex(walletAddr)
+		if seen[walletAddr] {
+			continue
+		}
+		seen[walletAddr] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			name, err := LookupAddress(ctx, walletAddr)
+			if err != nil {
+				log.Printf("Failed to lookup name of %s: %v", walletAddr, err)
+				return
+			}
+			if name != "" {
+				mu.Lock()
+				res[walletAddr] = name
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return res
+}
+
+// ResolveAddressInput 接受十六进制地址或名称，返回没有 0x 前缀的钱包地址
+func ResolveAddressInput(ctx context.Context, input string) (string, error) {
+	if IsName(input) {
+		return ResolveName(ctx, input)
+	}
+	return utils.NormalizeHex(input), nil
+}
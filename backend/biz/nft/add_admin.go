@@ -33,6 +33,16 @@ func CreateAddAdminTx(ctx context.Context, executorWalletAddr, targetWalletAddr
 	return tx, nil
 }
 
+// VerifyAdminTx 确认 tx_hash 是调用 VotingNFT 的 methodName(target) 且执行成功的交易，methodName 为 addAdmin 或 removeAdmin
+func VerifyAdminTx(ctx context.Context, txHash, methodName, targetWalletAddr string) error {
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return errors.Wrapf(err, "New client err")
+	}
+	return utils.VerifyContractMethodCallTx(ctx, client, common.HexToHash(txHash), utils.ContractVotingNFT,
+		config.G.Blockchain.NFTContractAddr, methodName, common.HexToAddress(targetWalletAddr))
+}
+
 func IsAdminByBlockchain(ctx context.Context, walletAddr string) (bool, error) {
 	client, err := utils.NewEthClient()
 	if err != nil {
@@ -72,6 +82,7 @@ func AddAdminToDb(ctx context.Context, walletAddr string) error {
 	if err != nil {
 		return errors.Wrapf(err, "Set user role by wallet address in DB err")
 	}
+	InvalidateChainRoleCache(walletAddr)
 
 	return nil
 }
@@ -0,0 +1,112 @@
+package nft
+
+import (
+	"backend/config"
+	"backend/database"
+	"backend/database/models"
+	"backend/utils"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	"log"
+	"time"
+)
+
+// RootRole VotingNFT 合约中 ROOT_ROLE 的值
+var RootRole = crypto.Keccak256Hash([]byte("ROOT_ROLE"))
+
+// chainRoleCache 缓存链上查询到的角色，避免每个请求都调用合约，按 LRU 淘汰
+var chainRoleCache = lru.NewCache[string, chainRoleCacheEntry](10000)
+
+type chainRoleCacheEntry struct {
+	role     string
+	expireAt time.Time
+}
+
+func HasRootRoleByBlockchain(ctx context.Context, walletAddr string) (bool, error) {
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return false, errors.Wrapf(err, "New client err")
+	}
+
+	var hasRole bool
+	err = utils.CallViewMethod(
+		ctx,
+		client,
+		utils.ContractVotingNFT,
+		config.G.Blockchain.NFTContractAddr,
+		"hasRole",
+		[]interface{}{[32]byte(RootRole), common.HexToAddress(walletAddr)},
+		&hasRole,
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "Call contract method 'hasRole' err")
+	}
+
+	return hasRole, nil
+}
+
+// GetRoleByBlockchain 根据链上权限推导钱包的角色：ROOT_ROLE 为 root，isAdministrator 为 admin，否则为 user
+// 结果会缓存 config.G.Blockchain.ChainRoleCacheTTLSec 秒
+func GetRoleByBlockchain(ctx context.Context, walletAddr string) (string, error) {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	ttl := time.Duration(config.G.Blockchain.ChainRoleCacheTTLSec) * time.Second
+
+	entry, ok := chainRoleCache.Get(walletAddr)
+	if ok && time.Now().Before(entry.expireAt) {
+		return entry.role, nil
+	}
+
+	role := models.RoleUser
+	isRoot, err := HasRootRoleByBlockchain(ctx, walletAddr)
+	if err != nil {
+		return "", err
+	}
+	if isRoot {
+		role = models.RoleRoot
+	} else {
+		isAdmin, err := IsAdminByBlockchain(ctx, walletAddr)
+		if err != nil {
+			return "", err
+		}
+		if isAdmin {
+			role = models.RoleAdmin
+		}
+	}
+
+	if ttl > 0 {
+		chainRoleCache.Add(walletAddr, chainRoleCacheEntry{role: role, expireAt: time.Now().Add(ttl)})
+	}
+	return role, nil
+}
+
+// InvalidateChainRoleCache 在发起或确认链上权限变更后调用
+func InvalidateChainRoleCache(walletAddr string) {
+	chainRoleCache.Remove(utils.NormalizeHex(walletAddr))
+}
+
+// ConfirmUserRole 以链上数据为准确认用户的角色
+// 数据库中的角色与链上不一致时记录日志，并把链上的角色写回数据库
+// 只处理由链上决定的角色（user、admin、root），auditor 等角色原样返回
+func ConfirmUserRole(ctx context.Context, user *models.User) (string, error) {
+	if user.Role != models.RoleUser && user.Role != models.RoleAdmin && user.Role != models.RoleRoot {
+		return user.Role, nil
+	}
+
+	chainRole, err := GetRoleByBlockchain(ctx, user.WalletAddr)
+	if err != nil {
+		return "", errors.Wrapf(err, "Get role by blockchain err")
+	}
+	if chainRole == user.Role {
+		return chainRole, nil
+	}
+
+	log.Printf("Role mismatch for user %s: db=%s, chain=%s, repairing db", user.WalletAddr, user.Role, chainRole)
+	err = models.SetUserRoleByWalletAddr(database.Db, user.WalletAddr, chainRole)
+	if err != nil {
+		return "", errors.Wrapf(err, "Repair user role in DB err")
+	}
+	return chainRole, nil
+}
@@ -65,21 +65,60 @@ func GetAdminList(ctx context.Context) ([]*models.User, error) {
 	return users, nil
 }
 
-func SyncAdminList(ctx context.Context) error {
+// SyncAdminList 按链上数据同步 root 与 admin 角色
+// 启用 admin 变更审批时，链上新增但没有已执行的 add_admin 提议的 admin 不会写入数据库，以 skipped 返回
+// 否则 root 可以直接调用合约添加 admin，再通过同步绕过审批
+func SyncAdminList(ctx context.Context) ([]string, error) {
+	// sync root list first, demoted roots will be picked up by admin sync below
+	rootList, err := GetRootList(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get root list from blockchain")
+	}
+	err = models.SyncRootListByWalletAddrList(database.Db, rootList)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to sync root list")
+	}
+
 	// get admin list from blockchain
 	res, err := getAdminListFromBlockchain(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "Failed to get admin list from blockchain")
+		return nil, errors.Wrapf(err, "Failed to get admin list from blockchain")
 	}
 
-	var addrList []string
+	var addrList, skipped []string
 	for _, addr := range res {
-		addrList = append(addrList, utils.NormalizeHex(addr.Hex()))
+		addrStr := utils.NormalizeHex(addr.Hex())
+		approved, err := adminGrantApproved(addrStr)
+		if err != nil {
+			return nil, err
+		}
+		if !approved {
+			log.Warn(fmt.Sprintf("Admin %s on chain has no executed proposal, skipped in sync", addrStr))
+			skipped = append(skipped, addrStr)
+			continue
+		}
+		addrList = append(addrList, addrStr)
 	}
 
 	err = models.SyncAdminListByWalletAddrList(database.Db, addrList)
 	if err != nil {
-		return errors.Wrapf(err, "Failed to sync admin list")
+		return nil, errors.Wrapf(err, "Failed to sync admin list")
+	}
+	return skipped, nil
+}
+
+// adminGrantApproved 未启用审批、数据库中已经是 admin 或 root，或最近一次已执行的提议是 add_admin 时返回 true
+func adminGrantApproved(walletAddr string) (bool, error) {
+	if config.G.Governance.AdminChangeThreshold <= 0 {
+		return true, nil
+	}
+	user, err := models.GetUserByWalletAddr(database.Db, walletAddr)
+	if err == nil && (user.Role == models.RoleAdmin || user.Role == models.RoleRoot) {
+		return true, nil
+	}
+	action, err := models.LatestExecutedAdminProposalAction(database.Db, walletAddr)
+	if err != nil {
+		return false, err
 	}
-	return nil
+	return action == models.ProposalActionAddAdmin, nil
 }
@@ -49,6 +49,7 @@ func RemoveAdminFromDb(ctx context.Context, walletAddr string) error {
 	if err != nil {
 		return errors.Wrapf(err, "Set user role by wallet address in DB err")
 	}
+	InvalidateChainRoleCache(walletAddr)
 
 	return nil
 }
@@ -0,0 +1,189 @@
+package nft
+
+import (
+	"backend/config"
+	"backend/database"
+	"backend/database/models"
+	"backend/utils"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"math/big"
+)
+
+func getRootListFromBlockchain(ctx context.Context) ([]common.Address, error) {
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	var count *big.Int
+	err = utils.CallViewMethod(
+		ctx,
+		client,
+		utils.ContractVotingNFT,
+		config.G.Blockchain.NFTContractAddr,
+		"getRoleMemberCount",
+		[]interface{}{[32]byte(RootRole)},
+		&count,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to call view method 'getRoleMemberCount'")
+	}
+
+	var res []common.Address
+	for i := int64(0); i < count.Int64(); i++ {
+		var addr common.Address
+		err = utils.CallViewMethod(
+			ctx,
+			client,
+			utils.ContractVotingNFT,
+			config.G.Blockchain.NFTContractAddr,
+			"getRoleMember",
+			[]interface{}{[32]byte(RootRole), big.NewInt(i)},
+			&addr,
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to call view method 'getRoleMember'")
+		}
+		res = append(res, addr)
+	}
+
+	return res, nil
+}
+
+func GetRootList(ctx context.Context) ([]string, error) {
+	res, err := getRootListFromBlockchain(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get root list from blockchain")
+	}
+
+	var addrList []string
+	for _, addr := range res {
+		addrList = append(addrList, utils.NormalizeHex(addr.Hex()))
+	}
+	return addrList, nil
+}
+
+// CreateGrantRootTx 创建授予 ROOT_ROLE 的交易
+// 只有链上已经是 admin 的钱包才能成为 root，因为 addAdmin 等方法同时需要 DEFAULT_ADMIN_ROLE
+func CreateGrantRootTx(ctx context.Context, executorWalletAddr, targetWalletAddr string) (*types.Transaction, error) {
+	isAdmin, err := IsAdminByBlockchain(ctx, targetWalletAddr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Check if admin by blockchain err")
+	}
+	if !isAdmin {
+		return nil, errors.New("Target wallet address must be an admin before becoming root")
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	tx, err := utils.CreateContractMethodCallTx(
+		ctx,
+		client,
+		executorWalletAddr,
+		utils.ContractVotingNFT,
+		config.G.Blockchain.NFTContractAddr,
+		"grantRole",
+		[32]byte(RootRole),
+		common.HexToAddress(targetWalletAddr),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Create contract method call tx err")
+	}
+
+	return tx, nil
+}
+
+// CreateRevokeRootTx 创建撤销 ROOT_ROLE 的交易，不允许撤销最后一个 root
+// 被撤销的钱包仍然保留 admin 身份，但合约中 ROOT_ROLE 与 DEFAULT_ADMIN_ROLE 只能由 root 授予，它无法重新授予自己 root
+func CreateRevokeRootTx(ctx context.Context, executorWalletAddr, targetWalletAddr string) (*types.Transaction, error) {
+	roots, err := GetRootList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	isRoot := false
+	for _, root := range roots {
+		if root == utils.NormalizeHex(targetWalletAddr) {
+			isRoot = true
+		}
+	}
+	if !isRoot {
+		return nil, errors.New("Target wallet address is not a root")
+	}
+	if len(roots) <= 1 {
+		return nil, errors.New("Cannot revoke the last root, grant root to another wallet first")
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	tx, err := utils.CreateContractMethodCallTx(
+		ctx,
+		client,
+		executorWalletAddr,
+		utils.ContractVotingNFT,
+		config.G.Blockchain.NFTContractAddr,
+		"revokeRole",
+		[32]byte(RootRole),
+		common.HexToAddress(targetWalletAddr),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Create contract method call tx err")
+	}
+
+	return tx, nil
+}
+
+func GrantRootToDb(ctx context.Context, walletAddr string) error {
+	isRoot, err := HasRootRoleByBlockchain(ctx, walletAddr)
+	if err != nil {
+		return errors.Wrapf(err, "Check if root by blockchain err")
+	}
+
+	if !isRoot {
+		return errors.New("Wallet address is not a root from blockchain data")
+	}
+
+	err = models.SetUserRoleByWalletAddr(database.Db, walletAddr, models.RoleRoot)
+	if err != nil {
+		return errors.Wrapf(err, "Set user role by wallet address in DB err")
+	}
+	InvalidateChainRoleCache(walletAddr)
+
+	return nil
+}
+
+func RevokeRootFromDb(ctx context.Context, walletAddr string) error {
+	isRoot, err := HasRootRoleByBlockchain(ctx, walletAddr)
+	if err != nil {
+		return errors.Wrapf(err, "Check if root by blockchain err")
+	}
+
+	if isRoot {
+		return errors.New("Wallet address is a root from blockchain data")
+	}
+
+	isAdmin, err := IsAdminByBlockchain(ctx, walletAddr)
+	if err != nil {
+		return errors.Wrapf(err, "Check if admin by blockchain err")
+	}
+
+	role := models.RoleUser
+	if isAdmin {
+		role = models.RoleAdmin
+	}
+	err = models.SetUserRoleByWalletAddr(database.Db, walletAddr, role)
+	if err != nil {
+		return errors.Wrapf(err, "Set user role by wallet address in DB err")
+	}
+	InvalidateChainRoleCache(walletAddr)
+
+	return nil
+}
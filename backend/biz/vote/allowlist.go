@@ -0,0 +1,281 @@
+package vote
+
+import (
+	"backend/biz/ens"
+	"backend/database"
+	"backend/database/models"
+	"backend/utils"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+const (
+	AllowlistFormatCSV  = "csv"
+	AllowlistFormatJSON = "json"
+)
+
+const (
+	MemberStatusNotRegistered = "not_registered" // 还没有持有该投票的 NFT
+	MemberStatusRegistered    = "registered"     // 已登记为投票人，尚未投票
+	MemberStatusCommitted     = "committed"      // commit-reveal 投票中已提交承诺，尚未揭示
+	MemberStatusVoted         = "voted"
+)
+
+// AllowlistInput 名单文件中的一行，Value 为钱包地址、名称或邮箱
+type AllowlistInput struct {
+	Line  int
+	Value string
+}
+
+// ParseAllowlist 解析名单文件
+// CSV 每行取第一列，第一行为 wallet、email 之类的表头时跳过；JSON 为字符串数组，或包含 wallet_address / email 的对象数组
+func ParseAllowlist(data []byte, format string) ([]AllowlistInput, error) {
+	var res []AllowlistInput
+	switch format {
+	case AllowlistFormatJSON:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, errors.New("JSON allowlist must be an array")
+		}
+		for i, item := range items {
+			var value string
+			if err := json.Unmarshal(item, &value); err != nil {
+				var obj struct {
+					WalletAddr string `json:"wallet_address"`
+					Email      string `json:"email"`
+				}
+				if err := json.Unmarshal(item, &obj); err != nil {
+					return nil, errors.Errorf("Item %d must be a string or an object", i+1)
+				}
+				value = obj.WalletAddr
+				if value == "" {
+					value = obj.Email
+				}
+			}
+			res = append(res, AllowlistInput{Line: i + 1, Value: strings.TrimSpace(value)})
+		}
+	case AllowlistFormatCSV:
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		for line := 1; ; line++ {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid CSV")
+			}
+			value := strings.TrimSpace(record[0])
+			if line == 1 && isAllowlistHeader(value) {
+				continue
+			}
+			if value == "" {
+				continue
+			}
+			res = append(res, AllowlistInput{Line: line, Value: value})
+		}
+	default:
+		return nil, errors.Errorf("Unknown allowlist format %q", format)
+	}
+	if len(res) > models.MaxVoteAllowlistEntries {
+		return nil, errors.Errorf("Allowlist can have at most %d members", models.MaxVoteAllowlistEntries)
+	}
+	return res, nil
+}
+
+func isAllowlistHeader(value string) bool {
+	switch strings.ToLower(value) {
+	case "wallet", "wallet_address", "address", "email", "member":
+		return true
+	}
+	return false
+}
+
+// ResolveAllowlist 将名单中的邮箱解析为注册用户、名称解析为钱包地址
+// 任意一行无法解析时返回全部问题，不会只保存一部分
+func ResolveAllowlist(ctx context.Context, inputs []AllowlistInput) ([]models.VoteAllowlistEntry, []string, error) {
+	var emails []string
+	for _, in := range inputs {
+		if strings.Contains(in.Value, "@") {
+			emails = append(emails, strings.ToLower(in.Value))
+		}
+	}
+	users, err := models.BatchGetVerifiedUsersByEmails(database.Db, emails)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []models.VoteAllowlistEntry
+	var problems []string
+	for _, in := range inputs {
+		if in.Value == "" {
+			problems = append(problems, fmt.Sprintf("Line %d: empty member", in.Line))
+			continue
+		}
+		if strings.Contains(in.Value, "@") {
+			user, ok := users[strings.ToLower(in.Value)]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("Line %d: %s is not the verified email of a registered user", in.Line, in.Value))
+				continue
+			}
+			entries = append(entries, models.VoteAllowlistEntry{UserID: user.ID, Email: in.Value})
+			continue
+		}
+		if !ens.IsName(in.Value) && !common.IsHexAddress(in.Value) {
+			problems = append(problems, fmt.Sprintf("Line %d: %s is not a wallet address, name or email", in.Line, in.Value))
+			continue
+		}
+		walletAddr, err := ens.ResolveAddressInput(ctx, in.Value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Line %d: %v", in.Line, err))
+			continue
+		}
+		entries = append(entries, models.VoteAllowlistEntry{WalletAddr: walletAddr})
+	}
+	return entries, problems, nil
+}
+
+// CheckAllowlistMemberWallet 按用户加入名单的成员只有一票，同一用户的其他钱包已经登记为投票人或提交了选票时拒绝 walletAddr
+// userID 为 GetWalletAllowlistMember 返回的用户 ID，为 0 时不限制
+func CheckAllowlistMemberWallet(ctx context.Context, v *models.Vote, walletAddr string, userID uint64) error {
+	if userID == 0 {
+		return nil
+	}
+	tokens, err := GetVoteTokensFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return err
+	}
+	return checkMemberWallet(v, walletAddr, userID, tokens)
+}
+
+func checkMemberWallet(v *models.Vote, walletAddr string, userID uint64, tokens []NftInfo) error {
+	if userID == 0 {
+		return nil
+	}
+	user, err := models.LookupUserCached(database.Db, walletAddr)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.ID != userID {
+		return nil
+	}
+	walletAddrs, err := models.ListAllWalletAddrsOfUser(database.Db, user)
+	if err != nil {
+		return err
+	}
+	others := make(map[string]bool)
+	for _, w := range walletAddrs {
+		if w = utils.NormalizeHex(w); w != utils.NormalizeHex(walletAddr) {
+			others[w] = true
+		}
+	}
+
+	for _, token := range tokens {
+		owner := utils.NormalizeHex(token.Owner.Hex())
+		if token.Metadata.Role == models.ParticipationRoleVoter && others[owner] {
+			return errors.Errorf("Wallet 0x%s of the same allowlisted member is already a voter of this vote", owner)
+		}
+	}
+	if v.Gasless {
+		ballots, err := models.ListOffchainBallots(database.Db, v.ContractAddr)
+		if err != nil {
+			return err
+		}
+		for _, b := range ballots {
+			if others[b.WalletAddr] {
+				return errors.Errorf("Wallet 0x%s of the same allowlisted member has already submitted a ballot", b.WalletAddr)
+			}
+		}
+	}
+	return nil
+}
+
+// AllowlistMember 名单成员与链上的登记、投票情况
+type AllowlistMember struct {
+	models.VoteAllowlistEntry
+	Status      string   `json:"status"`
+	WalletAddrs []string `json:"wallet_addresses"` // 持有该投票 NFT 的钱包
+}
+
+// GetAllowlistStatus 从链上读取投票的 token 与承诺，给出名单中每个成员的状态
+// 按用户加入的成员，用户的任意一个钱包登记或投票都算
+func GetAllowlistStatus(ctx context.Context, v *models.Vote) ([]AllowlistMember, map[string]int, error) {
+	entries, err := models.ListVoteAllowlist(database.Db, v.ContractAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := GetVoteTokensFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	committed := make(map[string]bool)
+	if v.CommitReveal {
+		commits, err := SyncCommitments(ctx, v.ContractAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, commit := range commits {
+			committed[utils.NormalizeHex(commit.Voter.Hex())] = true
+		}
+	}
+
+	// 钱包 -> 状态，只统计投票人的 token
+	walletStatus := make(map[string]string)
+	walletAddrs := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Metadata.Role != models.ParticipationRoleVoter {
+			continue
+		}
+		walletAddr := utils.NormalizeHex(token.Owner.Hex())
+		status := MemberStatusRegistered
+		if token.Metadata.Option != nil && token.Metadata.Option.Sign() != 0 {
+			status = MemberStatusVoted
+		} else if committed[walletAddr] {
+			status = MemberStatusCommitted
+		}
+		walletStatus[walletAddr] = status
+		walletAddrs = append(walletAddrs, walletAddr)
+	}
+	users, err := models.BatchGetUsersByAnyWalletAddrs(database.Db, walletAddrs)
+	if err != nil {
+		return nil, nil, err
+	}
+	userWallets := make(map[uint64][]string)
+	for _, walletAddr := range walletAddrs {
+		if user, ok := users[walletAddr]; ok {
+			userWallets[user.ID] = append(userWallets[user.ID], walletAddr)
+		}
+	}
+
+	rank := map[string]int{MemberStatusNotRegistered: 0, MemberStatusRegistered: 1, MemberStatusCommitted: 2, MemberStatusVoted: 3}
+	summary := map[string]int{MemberStatusNotRegistered: 0, MemberStatusRegistered: 0, MemberStatusVoted: 0}
+	if v.CommitReveal {
+		summary[MemberStatusCommitted] = 0
+	}
+	res := make([]AllowlistMember, 0, len(entries))
+	for _, entry := range entries {
+		member := AllowlistMember{VoteAllowlistEntry: entry, Status: MemberStatusNotRegistered, WalletAddrs: []string{}}
+		if entry.UserID != 0 {
+			member.WalletAddrs = append(member.WalletAddrs, userWallets[entry.UserID]...)
+		} else if _, ok := walletStatus[entry.WalletAddr]; ok {
+			member.WalletAddrs = append(member.WalletAddrs, entry.WalletAddr)
+		}
+		// 用户有多个钱包时取进展最多的状态
+		for _, walletAddr := range member.WalletAddrs {
+			if rank[walletStatus[walletAddr]] > rank[member.Status] {
+				member.Status = walletStatus[walletAddr]
+			}
+		}
+		summary[member.Status]++
+		res = append(res, member)
+	}
+	return res, summary, nil
+}
@@ -0,0 +1,63 @@
+package vote
+
+import (
+	"backend/database/models"
+	"backend/utils"
+	"context"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"math/big"
+)
+
+// voteContract 返回投票使用的合约，登记相关方法在两种合约中 ABI 相同
+func voteContract(v *models.Vote) string {
+	if v.CommitReveal {
+		return utils.ContractVotingCommitReveal
+	}
+	return utils.ContractVoting
+}
+
+// CreateRegisterVoterTx 生成登记为投票人的交易，资格由调用者在此之前检查
+func CreateRegisterVoterTx(ctx context.Context, executorWalletAddr string, v *models.Vote) (*types.Transaction, error) {
+	info, err := GetVotingInfoFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+	if int(info.State) != models.VoteStateRegistration {
+		return nil, errors.New("Vote is not in registration state")
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+	return utils.CreateContractMethodCallTx(ctx, client, executorWalletAddr, voteContract(v), v.ContractAddr, "registerVoter")
+}
+
+// CreateVoteTx 生成投票的交易，option 从 1 开始
+// commit-reveal 投票需要使用 CreateCommitTx，免 gas 投票需要提交签名的选票
+func CreateVoteTx(ctx context.Context, executorWalletAddr string, v *models.Vote, option int64) (*types.Transaction, error) {
+	if v.CommitReveal {
+		return nil, errors.New("Commit-reveal vote only accepts commitments")
+	}
+	if v.Gasless {
+		return nil, errors.New("Gasless vote only accepts signed ballots")
+	}
+	info, err := GetVotingInfoFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+	if int(info.State) != models.VoteStateVoting {
+		return nil, errors.New("Vote is not in voting state")
+	}
+	if !hasVotingOption(info, option) {
+		return nil, errors.Errorf("Option #%d does not exist", option)
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+	return utils.CreateContractMethodCallTx(ctx, client, executorWalletAddr, utils.ContractVoting, v.ContractAddr,
+		"doVote", big.NewInt(option))
+}
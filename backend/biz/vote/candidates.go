@@ -0,0 +1,125 @@
+package vote
+
+import (
+	"backend/database/models"
+	"backend/utils"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	CandidateStatusPending  = "pending"  // 等待 owner 审核
+	CandidateStatusApproved = "approved" // 已成为候选人
+)
+
+// MaxApproveCandidatesBatch 一次最多生成的审核交易数
+const MaxApproveCandidatesBatch = 50
+
+var candidateStatusRoles = map[string]string{
+	CandidateStatusPending:  models.ParticipationRolePendingCandidate,
+	CandidateStatusApproved: models.ParticipationRoleCandidate,
+}
+
+// IsCandidateStatus 判断是否为合法的候选人状态
+func IsCandidateStatus(status string) bool {
+	_, ok := candidateStatusRoles[status]
+	return ok
+}
+
+// CandidateStatusOf 根据 token 的角色返回候选人状态，不是候选人时返回空字符串
+func CandidateStatusOf(role string) string {
+	for status, r := range candidateStatusRoles {
+		if r == role {
+			return status
+		}
+	}
+	return ""
+}
+
+// ListCandidates 从链上读取投票的候选人，status 为空则返回待审核与已通过的全部候选人
+// 只读取不写入，vote_participations 索引由 SyncVoteMetadata 维护
+func ListCandidates(ctx context.Context, contractAddr, status string) ([]NftInfo, error) {
+	tokens, err := GetVoteTokensFromBlockchain(ctx, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []NftInfo
+	for _, token := range tokens {
+		tokenStatus := CandidateStatusOf(token.Metadata.Role)
+		if tokenStatus == "" || (status != "" && tokenStatus != status) {
+			continue
+		}
+		res = append(res, token)
+	}
+	return res, nil
+}
+
+// CreateApproveCandidatesTxs 为投票的 owner 生成依次调用 approveCandidate 的交易，nonce 连续递增
+// candidateAddrs 为空时审核所有待审核的候选人
+func CreateApproveCandidatesTxs(ctx context.Context, executorWalletAddr, contractAddr string, candidateAddrs []string) ([]*types.Transaction, error) {
+	info, err := GetVotingInfoFromBlockchain(ctx, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	if utils.NormalizeHex(info.Admin.Hex()) != utils.NormalizeHex(executorWalletAddr) {
+		return nil, errors.New("Only the vote owner can approve candidates")
+	}
+	if !info.CandidateNeedApproval {
+		return nil, errors.New("Vote does not require candidate approval")
+	}
+	if int(info.State) != models.VoteStateRegistration {
+		return nil, errors.New("Vote is not in registration state")
+	}
+
+	pending, err := ListCandidates(ctx, contractAddr, CandidateStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	pendingSet := make(map[string]bool)
+	for _, token := range pending {
+		pendingSet[utils.NormalizeHex(token.Owner.Hex())] = true
+	}
+
+	if len(candidateAddrs) == 0 {
+		for _, token := range pending {
+			candidateAddrs = append(candidateAddrs, token.Owner.Hex())
+		}
+	}
+	if len(candidateAddrs) == 0 {
+		return nil, errors.New("No pending candidates")
+	}
+	if len(candidateAddrs) > MaxApproveCandidatesBatch {
+		return nil, errors.Errorf("At most %d candidates per batch", MaxApproveCandidatesBatch)
+	}
+	seen := make(map[string]bool)
+	for _, addr := range candidateAddrs {
+		addr = utils.NormalizeHex(addr)
+		if !pendingSet[addr] {
+			return nil, errors.Errorf("0x%s is not a pending candidate", addr)
+		}
+		if seen[addr] {
+			return nil, errors.Errorf("0x%s is listed more than once", addr)
+		}
+		seen[addr] = true
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	txs := make([]*types.Transaction, 0, len(candidateAddrs))
+	for i, addr := range candidateAddrs {
+		tx, err := utils.CreateContractMethodCallTx(ctx, client, executorWalletAddr, utils.ContractVoting, contractAddr,
+			"approveCandidate", common.HexToAddress(addr))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to create approve transaction for 0x%s", utils.NormalizeHex(addr))
+		}
+		// 每笔交易都以当前的 pending nonce 构建，按顺序签名发送时需要依次递增
+		txs = append(txs, types.NewTransaction(tx.Nonce()+uint64(i), *tx.To(), tx.Value(), tx.Gas(), tx.GasPrice(), tx.Data()))
+	}
+	return txs, nil
+}
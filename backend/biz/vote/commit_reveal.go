@@ -0,0 +1,239 @@
+package vote
+
+import (
+	"backend/database"
+	"backend/database/models"
+	"backend/utils"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	"log"
+	"math/big"
+	"time"
+)
+
+// CommitInfo 对应 VotingCommitReveal 合约中的 CommitInfo
+type CommitInfo struct {
+	Voter      common.Address `json:"voter"`
+	Commitment [32]byte       `json:"commitment"`
+	Revealed   bool           `json:"revealed"`
+}
+
+// GenerateSalt 生成 32 字节的随机 salt，投票人需要自己保存，揭示时再提交
+func GenerateSalt() [32]byte {
+	var salt [32]byte
+	_, _ = rand.Read(salt[:])
+	return salt
+}
+
+// ComputeCommitment 计算承诺，与合约中的 computeCommitment 一致：
+// keccak256(abi.encodePacked(int256 option, bytes32 salt, address voter, address votingContract))
+func ComputeCommitment(option int64, salt [32]byte, voterAddr, contractAddr string) ([32]byte, error) {
+	if option <= 0 {
+		return [32]byte{}, errors.New("Option starts from 1")
+	}
+	return crypto.Keccak256Hash(
+		common.LeftPadBytes(big.NewInt(option).Bytes(), 32),
+		salt[:],
+		common.HexToAddress(voterAddr).Bytes(),
+		common.HexToAddress(contractAddr).Bytes(),
+	), nil
+}
+
+// ParseBytes32 解析 0x 开头的 32 字节十六进制字符串，例如 salt 与承诺
+func ParseBytes32(s string) ([32]byte, error) {
+	var res [32]byte
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != 32 {
+		return res, errors.New("Must be 32 bytes in 0x-prefixed hex")
+	}
+	copy(res[:], b)
+	return res, nil
+}
+
+func GetCommitsFromBlockchain(ctx context.Context, contractAddr string) ([]CommitInfo, error) {
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	var res []CommitInfo
+	err = utils.CallViewMethod(ctx, client, utils.ContractVotingCommitReveal, contractAddr, "getAllCommits", []interface{}{}, &res)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to call view method")
+	}
+	return res, nil
+}
+
+// SyncCommitments 从链上读取 commit-reveal 投票的全部承诺，写入 vote_commitments 索引
+func SyncCommitments(ctx context.Context, contractAddr string) ([]CommitInfo, error) {
+	commits, err := GetCommitsFromBlockchain(ctx, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	commitments := make([]models.VoteCommitment, 0, len(commits))
+	for _, commit := range commits {
+		commitments = append(commitments, models.VoteCommitment{
+			ContractAddr: contractAddr,
+			WalletAddr:   commit.Voter.Hex(),
+			Commitment:   hexutil.Encode(commit.Commitment[:]),
+			Revealed:     commit.Revealed,
+		})
+	}
+	if err := models.UpsertVoteCommitments(database.Db, commitments); err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// RemindUnrevealed 在揭示阶段给尚未揭示的投票人发邮件提醒，每个承诺只提醒一次
+// 只有发送成功的承诺会被标记为已提醒，钱包未注册、邮箱未验证或发送失败的承诺在下一轮检查时重试
+func RemindUnrevealed(v *models.Vote) (int, error) {
+	commitments, err := models.ListUnremindedCommitments(database.Db, v.ContractAddr)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]uint64, 0, len(commitments))
+	for _, commitment := range commitments {
+		user, err := models.LookupUserCached(database.Db, commitment.WalletAddr)
+		if err != nil {
+			return len(ids), err
+		}
+		if user == nil || !user.EmailVerified || user.Status != models.UserStatusActive {
+			continue
+		}
+		body := fmt.Sprintf("Hi %s,\n\nThe vote \"%s\" (0x%s) is now in its reveal phase.\n", user.Nickname, v.Title, v.ContractAddr)
+		body += fmt.Sprintf("Your ballot from wallet 0x%s is committed but not revealed yet, it will not be counted until you reveal it with the option and salt you saved when voting.\n", commitment.WalletAddr)
+		if err := utils.DefaultMailer.Send(user.Email, "Reveal your ballot on VotingChain", body); err != nil {
+			log.Printf("Failed to send reveal reminder to user %d: %v", user.ID, err)
+			continue
+		}
+		// 每封邮件发送后立即标记，之后的失败不会导致已发送的提醒重复发送
+		if err := models.MarkCommitmentsReminded(database.Db, []uint64{commitment.ID}); err != nil {
+			return len(ids), err
+		}
+		ids = append(ids, commitment.ID)
+	}
+	return len(ids), nil
+}
+
+// StartRevealReminders 定期检查尚未结束的 commit-reveal 投票，进入揭示阶段后同步承诺并提醒尚未揭示的投票人
+// 状态直接读取链上数据，不依赖元数据同步，interval 为 0 时不启动
+func StartRevealReminders(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			votes, err := models.ListCommitRevealVotesForRemind(database.Db)
+			if err != nil {
+				log.Printf("Failed to list commit-reveal votes for reminders: %v", err)
+				continue
+			}
+			for i := range votes {
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				if err := remindVote(ctx, &votes[i]); err != nil {
+					log.Printf("Failed to remind unrevealed voters of vote %s: %v", votes[i].ContractAddr, err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+func remindVote(ctx context.Context, v *models.Vote) error {
+	info, err := GetVotingInfoFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return err
+	}
+	if int(info.State) != models.VoteStateReveal {
+		return nil
+	}
+	if _, err := SyncCommitments(ctx, v.ContractAddr); err != nil {
+		return err
+	}
+	_, err = RemindUnrevealed(v)
+	return err
+}
+
+// findCommit 在链上的承诺中查找钱包的承诺，没有时返回 nil
+func findCommit(commits []CommitInfo, walletAddr string) *CommitInfo {
+	for i := range commits {
+		if utils.NormalizeHex(commits[i].Voter.Hex()) == utils.NormalizeHex(walletAddr) {
+			return &commits[i]
+		}
+	}
+	return nil
+}
+
+// CreateCommitTx 生成提交承诺的交易，需要在投票阶段发送
+func CreateCommitTx(ctx context.Context, executorWalletAddr, contractAddr string, commitment [32]byte) (*types.Transaction, error) {
+	if commitment == [32]byte{} {
+		return nil, errors.New("Empty commitment")
+	}
+	info, err := GetVotingInfoFromBlockchain(ctx, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	if int(info.State) != models.VoteStateVoting {
+		return nil, errors.New("Vote is not in commit state")
+	}
+	commits, err := GetCommitsFromBlockchain(ctx, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	if findCommit(commits, executorWalletAddr) != nil {
+		return nil, errors.New("Already committed")
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+	return utils.CreateContractMethodCallTx(ctx, client, executorWalletAddr, utils.ContractVotingCommitReveal, contractAddr,
+		"commit", commitment)
+}
+
+// CreateRevealTx 生成揭示选票的交易，需要在揭示阶段发送，option 与 salt 必须与提交的承诺一致
+func CreateRevealTx(ctx context.Context, executorWalletAddr, contractAddr string, option int64, salt [32]byte) (*types.Transaction, error) {
+	info, err := GetVotingInfoFromBlockchain(ctx, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	if int(info.State) != models.VoteStateReveal {
+		return nil, errors.New("Vote is not in reveal state")
+	}
+	commits, err := GetCommitsFromBlockchain(ctx, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	commit := findCommit(commits, executorWalletAddr)
+	if commit == nil {
+		return nil, errors.New("No commitment found for this wallet")
+	}
+	if commit.Revealed {
+		return nil, errors.New("Already revealed")
+	}
+	expected, err := ComputeCommitment(option, salt, executorWalletAddr, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	if expected != commit.Commitment {
+		return nil, errors.New("Option and salt do not match the commitment")
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+	return utils.CreateContractMethodCallTx(ctx, client, executorWalletAddr, utils.ContractVotingCommitReveal, contractAddr,
+		"reveal", big.NewInt(option), salt)
+}
@@ -0,0 +1,195 @@
+package vote
+
+import (
+	"backend/config"
+	"backend/database/models"
+	"backend/tally"
+	"backend/utils"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxDraftTitleLength       = 255  // in characters
+	maxDraftDescriptionLength = 4096 // in characters
+	maxDraftOptions           = 50
+	maxDraftOptionLength      = 255 // in characters
+)
+
+// CheckDraftLimits 保存草稿时只检查长度等硬性限制，草稿允许暂时不完整
+func CheckDraftLimits(draft *models.VoteDraft) error {
+	if utf8.RuneCountInString(draft.Title) > maxDraftTitleLength {
+		return errors.Errorf("Title is too long, at most %d characters", maxDraftTitleLength)
+	}
+	if utf8.RuneCountInString(draft.Description) > maxDraftDescriptionLength {
+		return errors.Errorf("Description is too long, at most %d characters", maxDraftDescriptionLength)
+	}
+	if len(draft.RawTextOptions) > maxDraftOptions {
+		return errors.Errorf("Too many options, at most %d", maxDraftOptions)
+	}
+	for _, option := range draft.RawTextOptions {
+		if utf8.RuneCountInString(option) > maxDraftOptionLength {
+			return errors.Errorf("Option is too long, at most %d characters", maxDraftOptionLength)
+		}
+	}
+	if draft.OptionType != models.VoteOptionTypeCandidate && draft.OptionType != models.VoteOptionTypeRawText {
+		return errors.New("Invalid option_type, must be 0 (candidate) or 1 (raw text)")
+	}
+	return nil
+}
+
+// ValidateDraft 检查草稿是否可以部署，返回发现的所有问题，为空表示可以部署
+func ValidateDraft(draft *models.VoteDraft) []string {
+	var problems []string
+	if err := CheckDraftLimits(draft); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if strings.TrimSpace(draft.Title) == "" {
+		problems = append(problems, "Title cannot be empty")
+	}
+	if draft.CommitReveal && draft.Gasless {
+		problems = append(problems, "A vote cannot be both commit-reveal and gasless")
+	}
+	// 名单与资格规则只能在投票创建之后设置，因此草稿只能用报名限制免 gas 投票的投票人
+	if draft.Gasless && !draft.NeedRegistration {
+		problems = append(problems, "Gasless votes must require registration, otherwise anyone can vote with new wallets for free")
+	}
+
+	switch draft.OptionType {
+	case models.VoteOptionTypeRawText:
+		if len(draft.RawTextOptions) < 2 {
+			problems = append(problems, "Raw text votes need at least 2 options")
+		}
+		seen := make(map[string]bool)
+		for i, option := range draft.RawTextOptions {
+			option = strings.TrimSpace(option)
+			if option == "" {
+				problems = append(problems, fmt.Sprintf("Option #%d cannot be empty", i+1))
+			} else if seen[option] {
+				problems = append(problems, fmt.Sprintf("Option #%d is a duplicate", i+1))
+			}
+			seen[option] = true
+		}
+		if draft.CandidateNeedApproval {
+			problems = append(problems, "Candidate approval only applies to candidate votes")
+		}
+	case models.VoteOptionTypeCandidate:
+		if len(draft.RawTextOptions) > 0 {
+			problems = append(problems, "Candidate votes cannot have raw text options")
+		}
+	}
+
+	// 计划时间可以不设置，设置了就必须按 报名 < 投票开始 < 投票结束 的顺序
+	if draft.RegistrationStartTime != 0 && !draft.NeedRegistration {
+		problems = append(problems, "Registration start time is set but registration is not required")
+	}
+	if draft.RegistrationStartTime != 0 && draft.VotingStartTime != 0 && draft.RegistrationStartTime >= draft.VotingStartTime {
+		problems = append(problems, "Registration must start before voting starts")
+	}
+	if draft.VotingStartTime != 0 && draft.VotingEndTime != 0 && draft.VotingStartTime >= draft.VotingEndTime {
+		problems = append(problems, "Voting must start before it ends")
+	}
+
+	// 候选人投票的选项在报名后才确定，只有文本投票可以检查弃权选项
+	var options []tally.Option
+	if draft.OptionType == models.VoteOptionTypeRawText {
+		for i, option := range draft.RawTextOptions {
+			options = append(options, tally.Option{ID: int64(i) + 1, Label: option})
+		}
+	}
+	if err := draft.TallyConfig.Validate(options, draft.NeedRegistration); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if draft.OptionType == models.VoteOptionTypeCandidate && draft.TallyConfig.AbstainOption != 0 {
+		problems = append(problems, "Abstain option only applies to raw text votes")
+	}
+	return problems
+}
+
+// draftContract 返回草稿需要部署的合约，两种合约的构造参数相同
+func draftContract(draft *models.VoteDraft) string {
+	if draft.CommitReveal {
+		return utils.ContractVotingCommitReveal
+	}
+	return utils.ContractVoting
+}
+
+// draftConstructorArgs 按 Voting 合约构造函数的顺序返回参数
+func draftConstructorArgs(draft *models.VoteDraft) []interface{} {
+	options := draft.RawTextOptions
+	if options == nil {
+		options = []string{}
+	}
+	return []interface{}{
+		common.HexToAddress(config.G.Blockchain.NFTContractAddr),
+		draft.Title,
+		draft.Description,
+		uint8(draft.OptionType),
+		draft.NeedRegistration,
+		draft.CandidateNeedApproval,
+		options,
+	}
+}
+
+// CreateDraftDeploymentTx 创建部署草稿对应 Voting 合约的交易，草稿必须通过 ValidateDraft
+func CreateDraftDeploymentTx(ctx context.Context, executorWalletAddr string, draft *models.VoteDraft) (*types.Transaction, error) {
+	if problems := ValidateDraft(draft); len(problems) > 0 {
+		return nil, errors.Errorf("Draft is not ready to deploy: %s", strings.Join(problems, "; "))
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	tx, err := utils.CreateContractDeploymentTx(ctx, client, executorWalletAddr, draftContract(draft), draftConstructorArgs(draft)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Create contract deployment tx err")
+	}
+	return tx, nil
+}
+
+// VerifyDraftDeployment 等待部署交易上链，确认交易由 executor 发出、部署成功，且部署的正是这份草稿
+// 返回部署出的合约地址（没有 0x 前缀）
+func VerifyDraftDeployment(ctx context.Context, executorWalletAddr string, draft *models.VoteDraft, txHash string) (string, error) {
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return "", errors.Wrapf(err, "New client err")
+	}
+
+	receipt, err := utils.WaitForTransactionReceipt(client, common.HexToHash(txHash))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get transaction receipt")
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful || receipt.ContractAddress == (common.Address{}) {
+		return "", errors.New("Deployment transaction failed")
+	}
+
+	tx, _, err := client.TransactionByHash(ctx, common.HexToHash(txHash))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get transaction")
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to recover transaction sender")
+	}
+	if utils.NormalizeHex(sender.Hex()) != utils.NormalizeHex(executorWalletAddr) {
+		return "", errors.New("Deployment transaction was not sent by current wallet")
+	}
+
+	expected, err := utils.BuildContractDeploymentData(draftContract(draft), draftConstructorArgs(draft)...)
+	if err != nil {
+		return "", err
+	}
+	if tx.To() != nil || !bytes.Equal(tx.Data(), expected) {
+		return "", errors.New("Deployment transaction does not match the draft")
+	}
+
+	return utils.NormalizeHex(receipt.ContractAddress.Hex()), nil
+}
@@ -0,0 +1,136 @@
+package vote
+
+import (
+	"backend/database/models"
+	"backend/utils"
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/pkg/errors"
+	"math/big"
+)
+
+// ERC-20 与 ERC-721 的 balanceOf 签名相同
+const balanceOfABI = `[{"inputs":[{"name":"owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"}]`
+
+// balanceCache 缓存快照区块的余额，固定区块的余额不会再变化，因此不需要过期，只按容量淘汰最久未使用的
+var balanceCache = lru.NewCache[string, *big.Int](100000)
+
+// RuleCheck 一条资格规则的检查结果
+type RuleCheck struct {
+	models.EligibilityRule
+	Balance string `json:"balance"`
+	Passed  bool   `json:"passed"`
+}
+
+// EligibilityResult 钱包的资格检查结果
+type EligibilityResult struct {
+	WalletAddr    string      `json:"wallet_address"`
+	SnapshotBlock uint64      `json:"snapshot_block"`
+	Match         string      `json:"match"`
+	Eligible      bool        `json:"eligible"`
+	Checks        []RuleCheck `json:"checks"`
+}
+
+// Reason 不满足资格时给出的说明
+func (r *EligibilityResult) Reason() string {
+	if r.Eligible {
+		return ""
+	}
+	if r.Match == models.EligibilityMatchAny {
+		return fmt.Sprintf("Wallet 0x%s does not meet any eligibility rule at block %d", r.WalletAddr, r.SnapshotBlock)
+	}
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return fmt.Sprintf("Wallet 0x%s holds %s of %s token 0x%s at block %d, at least %s is required",
+				r.WalletAddr, check.Balance, check.Standard, check.TokenAddr, r.SnapshotBlock, check.minBalance())
+		}
+	}
+	return ""
+}
+
+func (c *RuleCheck) minBalance() string {
+	if c.MinBalance == "" {
+		return "1"
+	}
+	return c.MinBalance
+}
+
+// GetTokenBalanceAtBlock 读取钱包在指定区块持有的代币数量
+func GetTokenBalanceAtBlock(ctx context.Context, tokenAddr, walletAddr string, blockNumber uint64) (*big.Int, error) {
+	key := fmt.Sprintf("%s:%s:%d", utils.NormalizeHex(tokenAddr), utils.NormalizeHex(walletAddr), blockNumber)
+	if balance, ok := balanceCache.Get(key); ok {
+		return balance, nil
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	var balance *big.Int
+	err = utils.CallViewMethodAtBlock(ctx, client, balanceOfABI, tokenAddr, "balanceOf",
+		[]interface{}{common.HexToAddress(walletAddr)}, new(big.Int).SetUint64(blockNumber), &balance)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get balance of token 0x%s", utils.NormalizeHex(tokenAddr))
+	}
+	balanceCache.Add(key, balance)
+	return balance, nil
+}
+
+// CheckEligibility 按投票的资格规则检查钱包，没有规则时总是满足
+func CheckEligibility(ctx context.Context, v *models.Vote, walletAddr string) (*EligibilityResult, error) {
+	e := &v.Eligibility
+	res := &EligibilityResult{
+		WalletAddr:    utils.NormalizeHex(walletAddr),
+		SnapshotBlock: e.SnapshotBlock,
+		Match:         e.Match,
+		Eligible:      true,
+		Checks:        []RuleCheck{},
+	}
+	if !e.Enabled() {
+		return res, nil
+	}
+	if res.Match == "" {
+		res.Match = models.EligibilityMatchAll
+	}
+
+	anyPassed := false
+	for _, rule := range e.Rules {
+		minBalance, err := rule.MinBalanceInt()
+		if err != nil {
+			return nil, err
+		}
+		balance, err := GetTokenBalanceAtBlock(ctx, rule.TokenAddr, walletAddr, e.SnapshotBlock)
+		if err != nil {
+			return nil, err
+		}
+		check := RuleCheck{EligibilityRule: rule, Balance: balance.String(), Passed: balance.Cmp(minBalance) >= 0}
+		anyPassed = anyPassed || check.Passed
+		if !check.Passed {
+			res.Eligible = false
+		}
+		res.Checks = append(res.Checks, check)
+	}
+	if e.MatchAny() {
+		res.Eligible = anyPassed
+	}
+	return res, nil
+}
+
+// CheckSnapshotBlock 检查快照区块已经产生，未来的区块无法查询余额
+func CheckSnapshotBlock(ctx context.Context, blockNumber uint64) error {
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return errors.Wrapf(err, "New client err")
+	}
+	latest, err := client.BlockNumber(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get latest block number")
+	}
+	if blockNumber > latest {
+		return errors.Errorf("Snapshot block %d is after the latest block %d", blockNumber, latest)
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package vote
+
+import (
+	"backend/ballot"
+	"backend/config"
+	"backend/database"
+	"backend/database/models"
+	"backend/merkle"
+	"backend/tally"
+	"backend/utils"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"math/big"
+	"time"
+)
+
+// issuedAt 最多允许超前服务器时间的秒数
+const maxBallotClockSkewSec = 300
+
+// SignedBallot 投票人签名的选票
+type SignedBallot struct {
+	Voter     string `json:"voter"`
+	Option    int64  `json:"option"` // 从 1 开始
+	IssuedAt  int64  `json:"issued_at"`
+	Signature string `json:"signature"`
+}
+
+// VerifyBallot 校验选票的签名、投票状态、选项以及投票人的登记情况，通过后返回待写入的选票
+// 投票必须受报名、名单或资格规则限制，钱包是否满足名单与资格规则由调用者检查，一人一票由 offchain_ballots 的唯一索引保证
+func VerifyBallot(ctx context.Context, v *models.Vote, b *SignedBallot) (*models.OffchainBallot, error) {
+	if !v.Gasless {
+		return nil, errors.New("Vote does not accept signed ballots")
+	}
+	if !common.IsHexAddress(b.Voter) {
+		return nil, errors.New("Invalid voter address")
+	}
+	if b.IssuedAt <= 0 || b.IssuedAt > time.Now().Unix()+maxBallotClockSkewSec {
+		return nil, errors.New("Invalid issued_at")
+	}
+	signer, digest, err := utils.RecoverTypedDataSigner(ballot.TypedData(v.ContractAddr, b.Voter, b.Option, b.IssuedAt), b.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if signer != common.HexToAddress(b.Voter) {
+		return nil, errors.New("Signature does not match the voter")
+	}
+
+	info, err := GetVotingInfoFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+	if int(info.State) != models.VoteStateVoting {
+		return nil, errors.New("Vote is not in voting state")
+	}
+	if err := CheckGaslessRestricted(v, info.NeedRegistration); err != nil {
+		return nil, err
+	}
+	if !hasVotingOption(info, b.Option) {
+		return nil, errors.Errorf("Option #%d does not exist", b.Option)
+	}
+
+	// 与合约的 doVote 相同：候选人不能投票，需要报名的投票只有登记过的投票人可以投票
+	tokens, err := GetVoteTokensFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+	role := ""
+	for _, token := range tokens {
+		if utils.NormalizeHex(token.Owner.Hex()) == utils.NormalizeHex(b.Voter) {
+			role = token.Metadata.Role
+			break
+		}
+	}
+	if role == models.ParticipationRoleCandidate || role == models.ParticipationRolePendingCandidate {
+		return nil, errors.New("Candidates cannot vote")
+	}
+	if info.NeedRegistration && role != models.ParticipationRoleVoter {
+		return nil, errors.New("Voter is not registered")
+	}
+	// 按用户加入名单的成员只有一票，其他钱包已经登记或投票时拒绝
+	_, userID, err := models.GetWalletAllowlistMember(database.Db, v.ContractAddr, b.Voter)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMemberWallet(v, b.Voter, userID, tokens); err != nil {
+		return nil, err
+	}
+
+	leaf, err := ballot.Leaf(b.Voter, b.Option, b.IssuedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OffchainBallot{
+		ContractAddr: v.ContractAddr,
+		WalletAddr:   b.Voter,
+		Option:       b.Option,
+		IssuedAt:     b.IssuedAt,
+		Digest:       digest.Hex(),
+		Signature:    b.Signature,
+		Leaf:         leaf.Hex(),
+	}, nil
+}
+
+// CheckGaslessRestricted 免 gas 投票不花费 gas，任何人都可以用新建的钱包签名投票
+// 因此必须由报名、名单或资格规则之一限制投票人，否则不接受选票
+func CheckGaslessRestricted(v *models.Vote, needRegistration bool) error {
+	if needRegistration || v.Eligibility.Enabled() {
+		return nil
+	}
+	hasAllowlist, err := models.HasVoteAllowlist(database.Db, v.ContractAddr)
+	if err != nil {
+		return err
+	}
+	if !hasAllowlist {
+		return errors.New("Gasless votes must require registration, an allowlist or eligibility rules")
+	}
+	return nil
+}
+
+func hasVotingOption(info *VotingInfo, option int64) bool {
+	for _, o := range info.Options {
+		if o.Id.Int64() == option {
+			return true
+		}
+	}
+	return false
+}
+
+// gaslessTallyBallots 免 gas 投票的选票来自 offchain_ballots，链上 doVote 写入的选项不计入
+// 需要报名的投票中，登记了但没有提交选票的投票人按未投票计入选民
+func gaslessTallyBallots(ctx context.Context, v *models.Vote, info *VotingInfo) ([]tally.Ballot, error) {
+	ballots, err := models.ListOffchainBallots(database.Db, v.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]tally.Ballot, 0, len(ballots))
+	voted := make(map[string]bool)
+	for _, b := range ballots {
+		res = append(res, tally.Ballot{WalletAddr: "0x" + b.WalletAddr, Option: b.Option})
+		voted[b.WalletAddr] = true
+	}
+	if !info.NeedRegistration {
+		return res, nil
+	}
+	tokens, err := GetVoteTokensFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		walletAddr := utils.NormalizeHex(token.Owner.Hex())
+		if token.Metadata.Role == models.ParticipationRoleVoter && !voted[walletAddr] {
+			res = append(res, tally.Ballot{WalletAddr: token.Owner.Hex()})
+		}
+	}
+	return res, nil
+}
+
+// BuildBallotTree 由投票的全部选票构建 Merkle 树
+func BuildBallotTree(ballots []models.OffchainBallot) (*merkle.Tree, error) {
+	leaves := make([]common.Hash, 0, len(ballots))
+	for _, b := range ballots {
+		leaves = append(leaves, common.HexToHash(b.Leaf))
+	}
+	return merkle.New(leaves)
+}
+
+// anchorValues 计算锚定的值：选票的 Merkle 根、选票数与计票结果的哈希
+// 没有任何选票时根为全零、选票数为 0，这样的投票同样可以锚定，证明结果为空
+func anchorValues(ctx context.Context, v *models.Vote) (common.Hash, int, common.Hash, *tally.Result, error) {
+	res, info, err := TallyVote(ctx, v)
+	if err != nil {
+		return common.Hash{}, 0, common.Hash{}, nil, err
+	}
+	if int(info.State) != models.VoteStateEnded {
+		return common.Hash{}, 0, common.Hash{}, nil, errors.New("Vote has not ended")
+	}
+	ballots, err := models.ListOffchainBallots(database.Db, v.ContractAddr)
+	if err != nil {
+		return common.Hash{}, 0, common.Hash{}, nil, err
+	}
+	var root common.Hash
+	if len(ballots) > 0 {
+		tree, err := BuildBallotTree(ballots)
+		if err != nil {
+			return common.Hash{}, 0, common.Hash{}, nil, err
+		}
+		root = tree.Root()
+	}
+	resultHash, err := ballot.ResultHash(res)
+	if err != nil {
+		return common.Hash{}, 0, common.Hash{}, nil, err
+	}
+	return root, len(ballots), resultHash, res, nil
+}
+
+// CreateAnchorTx 投票结束后为 owner 生成锚定交易：计票并计算选票的 Merkle 根
+// 交易上链之后由 VerifyAnchorTx 确认并记录在 votes 表中
+func CreateAnchorTx(ctx context.Context, executorWalletAddr string, v *models.Vote) (*types.Transaction, *tally.Result, error) {
+	if !v.Gasless {
+		return nil, nil, errors.New("Only gasless votes need anchoring")
+	}
+	if config.G.Blockchain.BallotAnchorAddr == "" {
+		return nil, nil, errors.New("Ballot anchor contract is not configured")
+	}
+	if v.OwnerAddr != utils.NormalizeHex(executorWalletAddr) {
+		return nil, nil, errors.New("Only the vote owner can anchor the result")
+	}
+
+	root, count, resultHash, res, err := anchorValues(ctx, v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "New client err")
+	}
+	tx, err := utils.CreateContractMethodCallTx(ctx, client, executorWalletAddr, utils.ContractBallotAnchor, config.G.Blockchain.BallotAnchorAddr,
+		"anchor", common.HexToAddress(v.ContractAddr), [32]byte(root), big.NewInt(int64(count)), [32]byte(resultHash))
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, res, nil
+}
+
+// VerifyAnchorTx 等待锚定交易上链，确认链上记录的锚定与后端的选票和计票结果一致之后写入 votes 表
+func VerifyAnchorTx(ctx context.Context, v *models.Vote, txHash string) error {
+	if !v.Gasless {
+		return errors.New("Only gasless votes need anchoring")
+	}
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return errors.Wrapf(err, "New client err")
+	}
+	receipt, err := utils.WaitForTransactionReceipt(client, common.HexToHash(txHash))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get transaction receipt")
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return errors.New("Anchor transaction failed")
+	}
+
+	anchor, err := GetAnchorFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return err
+	}
+	if anchor.Timestamp.Sign() == 0 {
+		return errors.New("Vote is not anchored on chain")
+	}
+	root, count, resultHash, _, err := anchorValues(ctx, v)
+	if err != nil {
+		return err
+	}
+	if common.Hash(anchor.BallotRoot) != root || anchor.BallotCount.Cmp(big.NewInt(int64(count))) != 0 || common.Hash(anchor.ResultHash) != resultHash {
+		return errors.New("Anchor on chain does not match the ballots and the tally")
+	}
+	return models.SetVoteAnchor(database.Db, v.ContractAddr, root.Hex(), count, resultHash.Hex())
+}
+
+// AnchorInfo 对应 BallotAnchor 合约中的 Anchor，Timestamp 为 0 表示尚未锚定
+type AnchorInfo struct {
+	BallotRoot  [32]byte `json:"ballotRoot"`
+	BallotCount *big.Int `json:"ballotCount"`
+	ResultHash  [32]byte `json:"resultHash"`
+	Timestamp   *big.Int `json:"timestamp"`
+}
+
+func GetAnchorFromBlockchain(ctx context.Context, contractAddr string) (*AnchorInfo, error) {
+	if config.G.Blockchain.BallotAnchorAddr == "" {
+		return nil, errors.New("Ballot anchor contract is not configured")
+	}
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	// 只有一个 tuple 返回值时，abi 会把它解析到结构体的第一个字段
+	var res struct{ Anchor AnchorInfo }
+	err = utils.CallViewMethod(ctx, client, utils.ContractBallotAnchor, config.G.Blockchain.BallotAnchorAddr, "getAnchor",
+		[]interface{}{common.HexToAddress(contractAddr)}, &res)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to call view method")
+	}
+	return &res.Anchor, nil
+}
+
+// BallotProof 选票的 Merkle 包含证明
+type BallotProof struct {
+	Ballot models.OffchainBallot `json:"ballot"`
+	Leaf   string                `json:"leaf"`
+	Proof  []string              `json:"proof"`
+	Root   string                `json:"root"`
+	// 根已经锚定到链上，且与当前选票计算的根一致；投票结束之前根会随新的选票变化
+	Anchored bool `json:"anchored"`
+}
+
+// GetBallotProof 为钱包的选票生成包含证明
+func GetBallotProof(ctx context.Context, v *models.Vote, walletAddr string) (*BallotProof, error) {
+	ballot, err := models.GetOffchainBallot(database.Db, v.ContractAddr, walletAddr)
+	if err != nil {
+		return nil, err
+	}
+	ballots, err := models.ListOffchainBallots(database.Db, v.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := BuildBallotTree(ballots)
+	if err != nil {
+		return nil, err
+	}
+	leaf := common.HexToHash(ballot.Leaf)
+	proof, err := tree.Proof(leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &BallotProof{Ballot: *ballot, Leaf: leaf.Hex(), Proof: make([]string, 0, len(proof)), Root: tree.Root().Hex()}
+	for _, p := range proof {
+		res.Proof = append(res.Proof, p.Hex())
+	}
+	if v.AnchorRoot != "" && config.G.Blockchain.BallotAnchorAddr != "" {
+		anchor, err := GetAnchorFromBlockchain(ctx, v.ContractAddr)
+		if err != nil {
+			return nil, err
+		}
+		res.Anchored = anchor.Timestamp.Sign() != 0 && common.Hash(anchor.BallotRoot) == tree.Root()
+	}
+	return res, nil
+}
@@ -2,6 +2,8 @@ package vote
 
 import (
 	"backend/config"
+	"backend/database"
+	"backend/database/models"
 	"backend/utils"
 	"context"
 	"github.com/ethereum/go-ethereum/common"
@@ -43,3 +45,35 @@ func GetUserRelatedListFromBlockchain(ctx context.Context, walletAddr string) ([
 
 	return res, nil
 }
+
+// toParticipations 将链上的 token 转换为数据库中的索引
+func toParticipations(tokens []NftInfo) []models.VoteParticipation {
+	res := make([]models.VoteParticipation, 0, len(tokens))
+	for _, token := range tokens {
+		p := models.VoteParticipation{
+			TokenID:      token.TokenId.Uint64(),
+			ContractAddr: token.Metadata.VotingContract.Hex(),
+			WalletAddr:   token.Owner.Hex(),
+			Role:         token.Metadata.Role,
+		}
+		if token.Metadata.Option != nil {
+			p.ChosenOption = token.Metadata.Option.Int64()
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// SyncUserParticipations 从链上读取钱包持有的全部投票 NFT，更新数据库中的索引
+func SyncUserParticipations(ctx context.Context, walletAddrs []string) error {
+	for _, walletAddr := range walletAddrs {
+		tokens, err := GetUserRelatedListFromBlockchain(ctx, walletAddr)
+		if err != nil {
+			return err
+		}
+		if err := models.UpsertVoteParticipations(database.Db, toParticipations(tokens)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
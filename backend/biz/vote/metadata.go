@@ -0,0 +1,186 @@
+package vote
+
+import (
+	"backend/config"
+	"backend/database"
+	"backend/database/models"
+	"backend/utils"
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"log"
+	"math/big"
+	"time"
+)
+
+// VotingOption 对应 Voting 合约中的 Option
+type VotingOption struct {
+	Id        *big.Int       `json:"id"`
+	RawText   string         `json:"rawText"`
+	Candidate common.Address `json:"candidate"`
+}
+
+// VotingInfo 对应 Voting 合约中的 Vote，即 getVote 的返回值
+type VotingInfo struct {
+	Version               *big.Int       `json:"version"`
+	Admin                 common.Address `json:"admin"`
+	Title                 string         `json:"title"`
+	Description           string         `json:"description"`
+	OptionType            uint8          `json:"optionType"`
+	NeedRegistration      bool           `json:"needRegistration"`
+	CandidateNeedApproval bool           `json:"candidateNeedApproval"`
+	State                 uint8          `json:"state"`
+	Options               []VotingOption `json:"options"`
+}
+
+func GetVotingInfoFromBlockchain(ctx context.Context, contractAddr string) (*VotingInfo, error) {
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	// 只有一个 tuple 返回值时，abi 会把它解析到结构体的第一个字段
+	var res struct{ Vote VotingInfo }
+	err = utils.CallViewMethod(ctx, client, utils.ContractVoting, contractAddr, "getVote", []interface{}{}, &res)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to call view method")
+	}
+	return &res.Vote, nil
+}
+
+func GetVoteTokensFromBlockchain(ctx context.Context, contractAddr string) ([]NftInfo, error) {
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+
+	var res []NftInfo
+	err = utils.CallViewMethod(
+		ctx,
+		client,
+		utils.ContractVotingNFT,
+		config.G.Blockchain.NFTContractAddr,
+		"getAllTokensByVotingContract",
+		[]interface{}{common.HexToAddress(contractAddr)},
+		&res,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to call view method")
+	}
+	return res, nil
+}
+
+// SyncVoteMetadata 从链上读取投票的标题、状态与投票数，写入 votes 表的缓存字段，同时更新该投票的 token 索引
+func SyncVoteMetadata(ctx context.Context, contractAddr string) (*models.Vote, error) {
+	info, err := GetVotingInfoFromBlockchain(ctx, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := GetVoteTokensFromBlockchain(ctx, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &models.Vote{
+		Title:            info.Title,
+		Description:      info.Description,
+		OptionType:       int(info.OptionType),
+		NeedRegistration: info.NeedRegistration,
+		State:            int(info.State),
+		Participants:     len(tokens),
+	}
+	v, err := models.GetVoteByContractAddr(database.Db, contractAddr)
+	if err != nil {
+		return nil, err
+	}
+	if v.Gasless {
+		ballots, err := models.CountOffchainBallots(database.Db, contractAddr)
+		if err != nil {
+			return nil, err
+		}
+		meta.Turnout = int(ballots)
+	} else {
+		for _, token := range tokens {
+			// option 从 1 开始，0 表示尚未投票
+			if token.Metadata.Option != nil && token.Metadata.Option.Sign() != 0 {
+				meta.Turnout++
+			}
+		}
+	}
+
+	if err := models.UpdateVoteMetadata(database.Db, contractAddr, meta); err != nil {
+		return nil, err
+	}
+	if err := models.UpsertVoteParticipations(database.Db, toParticipations(tokens)); err != nil {
+		return nil, err
+	}
+	if v.CommitReveal {
+		if _, err := SyncCommitments(ctx, contractAddr); err != nil {
+			return nil, err
+		}
+	}
+	return meta, nil
+}
+
+// maxMetaSyncBackoff 同步失败或投票长期停留在 Init 状态时，两次同步之间的最长间隔
+const maxMetaSyncBackoff = time.Hour
+
+// metaSyncBackoff 单个投票的退避状态
+type metaSyncBackoff struct {
+	delay time.Duration
+	next  time.Time
+}
+
+// StartMetadataSync 定期刷新尚未结束的投票的链上信息，interval 为 0 时不启动
+// 同步失败，或者投票停留在 Init 状态没有变化时，该投票的同步间隔翻倍，最长为 maxMetaSyncBackoff；同步到变化后恢复
+func StartMetadataSync(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		backoff := make(map[string]*metaSyncBackoff)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			votes, err := models.ListVotesForMetaSync(database.Db)
+			if err != nil {
+				log.Printf("Failed to list votes for metadata sync: %v", err)
+				continue
+			}
+
+			now := time.Now()
+			pending := make(map[string]bool)
+			for _, v := range votes {
+				pending[v.ContractAddr] = true
+				b := backoff[v.ContractAddr]
+				if b != nil && now.Before(b.next) {
+					continue
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				meta, err := SyncVoteMetadata(ctx, v.ContractAddr)
+				cancel()
+				if err != nil {
+					log.Printf("Failed to sync metadata of vote %s: %v", v.ContractAddr, err)
+				}
+				idle := err == nil && v.MetaSyncTime != 0 && v.State == models.VoteStateInit && meta.State == models.VoteStateInit
+				if err == nil && !idle {
+					delete(backoff, v.ContractAddr)
+					continue
+				}
+				if b == nil {
+					b = &metaSyncBackoff{delay: interval}
+					backoff[v.ContractAddr] = b
+				}
+				b.delay = min(b.delay*2, maxMetaSyncBackoff)
+				b.next = now.Add(b.delay)
+			}
+			// 已经结束或被删除的投票不再需要退避状态
+			for addr := range backoff {
+				if !pending[addr] {
+					delete(backoff, addr)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,119 @@
+package vote
+
+import (
+	"backend/config"
+	"backend/database/models"
+	"backend/receipt"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// voteTxLocation 投票交易在链上的位置
+type voteTxLocation struct {
+	TxHash      common.Hash
+	BlockNumber uint64
+	BlockHash   common.Hash
+}
+
+// voteTxCache 缓存 投票合约:投票人 -> 投票交易的位置，选项只写入一次，避免每次生成回执都重新二分查找
+var voteTxCache = lru.NewCache[string, voteTxLocation](10000)
+
+// locateVoteTx 返回投票人的投票交易位置，缓存的交易不在原来的区块中时（发生了重组）重新查找
+func locateVoteTx(ctx context.Context, client *ethclient.Client, walletAddr, contractAddr string) (voteTxLocation, error) {
+	key := utils.NormalizeHex(contractAddr) + ":" + utils.NormalizeHex(walletAddr)
+	if loc, ok := voteTxCache.Get(key); ok {
+		txReceipt, err := client.TransactionReceipt(ctx, loc.TxHash)
+		if err == nil && txReceipt.BlockHash == loc.BlockHash {
+			return loc, nil
+		}
+		voteTxCache.Remove(key)
+	}
+
+	tx, block, err := receipt.FindVoteTx(ctx, client, config.G.Blockchain.NFTContractAddr, walletAddr, contractAddr)
+	if err != nil {
+		return voteTxLocation{}, err
+	}
+	loc := voteTxLocation{TxHash: tx.Hash(), BlockNumber: block.NumberU64(), BlockHash: block.Hash()}
+	voteTxCache.Add(key, loc)
+	return loc, nil
+}
+
+// GetVoteReceipt 从链上生成回执，依次尝试 walletAddrs 中的钱包，返回第一个已经投票的投票人的回执
+func GetVoteReceipt(ctx context.Context, v *models.Vote, walletAddrs []string) (*receipt.Receipt, error) {
+	if v.Gasless {
+		return nil, errors.New("Gasless votes have no vote transaction, use the ballot proof instead")
+	}
+	tokens, err := GetVoteTokensFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var walletAddr string
+	var token *NftInfo
+	err = errors.New("Wallet is not a voter of this vote")
+	for _, w := range walletAddrs {
+		for i := range tokens {
+			if utils.NormalizeHex(tokens[i].Owner.Hex()) != utils.NormalizeHex(w) || tokens[i].Metadata.Role != models.ParticipationRoleVoter {
+				continue
+			}
+			if tokens[i].Metadata.Option == nil || tokens[i].Metadata.Option.Sign() == 0 {
+				err = errors.New("Wallet has not voted yet")
+				continue
+			}
+			walletAddr, token = w, &tokens[i]
+			break
+		}
+		if token != nil {
+			break
+		}
+	}
+	if token == nil {
+		return nil, err
+	}
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, errors.Wrapf(err, "New client err")
+	}
+	loc, err := locateVoteTx(ctx, client, walletAddr, v.ContractAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &receipt.Receipt{
+		Version:      receipt.Version,
+		ChainID:      config.G.Blockchain.ChainID,
+		NFTContract:  common.HexToAddress(config.G.Blockchain.NFTContractAddr).Hex(),
+		VoteContract: common.HexToAddress(v.ContractAddr).Hex(),
+		Voter:        common.HexToAddress(walletAddr).Hex(),
+		TokenID:      token.TokenId.Uint64(),
+		Option:       token.Metadata.Option.Int64(),
+		TxHash:       loc.TxHash.Hex(),
+		BlockNumber:  loc.BlockNumber,
+		BlockHash:    loc.BlockHash.Hex(),
+		IssuedAt:     time.Now().Unix(),
+	}, nil
+}
+
+// Attest 签名回执
+func Attest(r *receipt.Receipt) (*receipt.Attestation, error) {
+	signer, err := utils.AttesterAddr()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode receipt")
+	}
+	signature, err := utils.SignAttestation(string(payload))
+	if err != nil {
+		return nil, err
+	}
+	return &receipt.Attestation{Payload: string(payload), Signer: signer.Hex(), Signature: signature}, nil
+}
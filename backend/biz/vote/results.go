@@ -0,0 +1,140 @@
+package vote
+
+import (
+	"backend/database"
+	"backend/database/models"
+	"backend/tally"
+	"backend/utils"
+	"context"
+	"fmt"
+)
+
+// TallyOptions 将链上的选项转换为计票的选项，候选人选项以钱包地址作为名称
+func TallyOptions(info *VotingInfo) []tally.Option {
+	options := make([]tally.Option, 0, len(info.Options))
+	for _, o := range info.Options {
+		label := o.RawText
+		if int(info.OptionType) == models.VoteOptionTypeCandidate {
+			label = o.Candidate.Hex()
+		}
+		options = append(options, tally.Option{ID: o.Id.Int64(), Label: label})
+	}
+	return options
+}
+
+// excludeIneligible 去掉不在名单中、或不满足资格规则的钱包的选票与登记，并返回每个被去掉的钱包的说明
+// 合约本身不检查名单与资格，直接调用合约的钱包可以绕过后端的检查，因此计票时需要再检查一次
+// 按用户加入名单的成员只计一票：优先保留已投出的选票，其次是最早的登记
+func excludeIneligible(ctx context.Context, v *models.Vote, ballots []tally.Ballot) ([]tally.Ballot, []string, error) {
+	hasAllowlist, err := models.HasVoteAllowlist(database.Db, v.ContractAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasAllowlist && !v.Eligibility.Enabled() {
+		return ballots, nil, nil
+	}
+	kept := make([]tally.Ballot, 0, len(ballots))
+	var excluded []string
+	memberBallot := make(map[uint64]int) // 用户 ID -> kept 中的下标
+	for _, ballot := range ballots {
+		var userID uint64
+		if hasAllowlist {
+			var allowed bool
+			allowed, userID, err = models.GetWalletAllowlistMember(database.Db, v.ContractAddr, ballot.WalletAddr)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !allowed {
+				excluded = append(excluded, fmt.Sprintf("Wallet 0x%s is not on the allowlist of this vote", utils.NormalizeHex(ballot.WalletAddr)))
+				continue
+			}
+		}
+		res, err := CheckEligibility(ctx, v, ballot.WalletAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !res.Eligible {
+			excluded = append(excluded, res.Reason())
+			continue
+		}
+		if userID != 0 {
+			if i, ok := memberBallot[userID]; ok {
+				dropped := ballot
+				if kept[i].Option == 0 && ballot.Option != 0 {
+					dropped, kept[i] = kept[i], ballot
+				}
+				excluded = append(excluded, fmt.Sprintf("Wallet 0x%s belongs to the same allowlisted member as 0x%s, only one ballot per member is counted",
+					utils.NormalizeHex(dropped.WalletAddr), utils.NormalizeHex(kept[i].WalletAddr)))
+				continue
+			}
+			memberBallot[userID] = len(kept)
+		}
+		kept = append(kept, ballot)
+	}
+	return kept, excluded, nil
+}
+
+// TallyVote 从 VotingNFT 读取选票，并按投票的计票规则统计
+// 只有角色为 voter 的 token 是选票，候选人不能投票
+// commit-reveal 投票只有揭示之后才会写入选项，未揭示的承诺按已登记但未投票处理
+// 免 gas 投票使用提交给后端的签名选票
+// 不在名单中或不满足资格规则的钱包、以及同一名单成员多余的钱包不计入结果，也不计入法定人数，结果的说明中列出被去掉的钱包
+func TallyVote(ctx context.Context, v *models.Vote) (*tally.Result, *VotingInfo, error) {
+	info, err := GetVotingInfoFromBlockchain(ctx, v.ContractAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	in := &tally.Input{Options: TallyOptions(info), NeedRegistration: info.NeedRegistration}
+	if v.Gasless {
+		in.Ballots, err = gaslessTallyBallots(ctx, v, info)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		tokens, err := GetVoteTokensFromBlockchain(ctx, v.ContractAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, token := range tokens {
+			if token.Metadata.Role != models.ParticipationRoleVoter {
+				continue
+			}
+			ballot := tally.Ballot{WalletAddr: token.Owner.Hex()}
+			if token.Metadata.Option != nil {
+				ballot.Option = token.Metadata.Option.Int64()
+			}
+			in.Ballots = append(in.Ballots, ballot)
+		}
+	}
+
+	var excluded []string
+	in.Ballots, excluded, err = excludeIneligible(ctx, v, in.Ballots)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := tally.Count(&v.TallyConfig, in)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(excluded) > 0 {
+		res.Explanation = append(res.Explanation,
+			fmt.Sprintf("%d wallets are not eligible or repeat an allowlisted member, their ballots are not counted", len(excluded)))
+		res.Explanation = append(res.Explanation, excluded...)
+	}
+	if v.CommitReveal {
+		commits, err := SyncCommitments(ctx, v.ContractAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		unrevealed := 0
+		for _, commit := range commits {
+			if !commit.Revealed {
+				unrevealed++
+			}
+		}
+		res.Explanation = append(res.Explanation,
+			fmt.Sprintf("Secret ballot: %d commitments, %d not revealed and not counted", len(commits), unrevealed))
+	}
+	return res, info, nil
+}
@@ -0,0 +1,64 @@
+// verify-receipt 离线校验投票回执的证明：只连接 config.json 中的 RPC 节点，不需要数据库与后端服务
+// 用法：verify-receipt -signer 0x... attestation.json
+package main
+
+import (
+	"backend/receipt"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("verify-receipt", flag.ExitOnError)
+	signer := fs.String("signer", "", "Trusted attester address, required, e.g. the trusted_signer returned by /votes/receipt/verify")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *signer == "" {
+		fmt.Fprintln(os.Stderr, "Usage: verify-receipt -signer 0x... attestation.json")
+		return 2
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read attestation: %v\n", err)
+		return 2
+	}
+	// 接受 /votes/:addr/receipt 的完整响应，或者其中的 attestation
+	var wrapper struct {
+		Attestation *receipt.Attestation `json:"attestation"`
+	}
+	var att receipt.Attestation
+	if err := json.Unmarshal(data, &wrapper); err == nil && wrapper.Attestation != nil {
+		att = *wrapper.Attestation
+	} else if err := json.Unmarshal(data, &att); err != nil || att.Payload == "" {
+		fmt.Fprintln(os.Stderr, "Invalid attestation file")
+		return 2
+	}
+
+	r, checks, err := receipt.Verify(context.Background(), &att, *signer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to verify attestation: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Vote %s, voter %s, token #%d, option #%d, tx %s\n",
+		r.VoteContract, r.Voter, r.TokenID, r.Option, r.TxHash)
+	for _, c := range checks {
+		mark := "OK  "
+		if !c.Passed {
+			mark = "FAIL"
+		}
+		fmt.Printf("[%s] %-12s %s\n", mark, c.Name, c.Detail)
+	}
+	if !receipt.Valid(checks) {
+		fmt.Println("Attestation is NOT valid")
+		return 1
+	}
+	fmt.Println("Attestation is valid")
+	return 0
+}
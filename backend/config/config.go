@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/pkg/errors"
 	"os"
+	"testing"
 )
 
 type Config struct {
@@ -13,6 +14,12 @@ type Config struct {
 		JWTSecret   string `json:"jwtSecret"`
 		JWTExpireHr int    `json:"jwtExpireHr"` // in hours
 		JWTKey      string `json:"jwtKey"`      // 你可以通过更换 key 使先前的 JWT Token 失效
+		// 信任的反向代理地址，只有来自这些地址的请求才会读取 X-Forwarded-For，为空表示不信任任何代理
+		TrustedProxies []string `json:"trustedProxies"`
+		// 用户角色查询缓存的有效期，0 表示不缓存
+		RoleCacheTTLSec int `json:"roleCacheTtlSec"`
+		// 签发投票回执证明使用的私钥（十六进制），对应的地址需要公开给验证者，为空表示不签发
+		AttestationKey string `json:"attestationKey"`
 	} `json:"server"`
 	Db struct {
 		Host     string `json:"host"`
@@ -25,9 +32,63 @@ type Config struct {
 		RPCHost         string `json:"rpcHost"`
 		ChainID         int64  `json:"chainID"`
 		RootUserEmail   string `json:"rootUserEmail"`
-		RootUserAddr    string `json:"rootUserAddr"`
 		NFTContractAddr string `json:"nftContractAddr"`
+		// 开启后，admin 与 root 的接口权限会以链上的 isAdministrator / ROOT_ROLE 为准，并自动修复数据库中的角色
+		ChainRoleCheck       bool `json:"chainRoleCheck"`
+		ChainRoleCacheTTLSec int  `json:"chainRoleCacheTtlSec"`
+		// 定期刷新尚未结束的投票在链上的标题、状态与投票数，用于列表的筛选与排序，0 表示只在创建与手动刷新时同步
+		VoteMetaSyncSec int `json:"voteMetaSyncSec"`
+		// 部署的 BallotAnchor 合约地址，用于锚定免 gas 投票的结果，为空时免 gas 投票无法锚定
+		BallotAnchorAddr string `json:"ballotAnchorAddr"`
 	} `json:"blockchain"`
+	RateLimit struct {
+		Enabled bool          `json:"enabled"`
+		Auth    RateLimitRule `json:"auth"`  // /auth/gen, /auth/verify, /auth/register, /auth/info
+		Write   RateLimitRule `json:"write"` // 其余所有非 GET 请求
+		Read    RateLimitRule `json:"read"`  // 需要查询链上数据的公开 GET 请求，例如名称解析
+	} `json:"rateLimit"`
+	Governance struct {
+		// admin 变更需要的审批数，0 表示不启用审批，root 可以直接构建交易
+		AdminChangeThreshold int `json:"adminChangeThreshold"`
+		// 有权审批 admin 变更的钱包地址
+		AdminChangeApprovers []string `json:"adminChangeApprovers"`
+	} `json:"governance"`
+	Email struct {
+		Mailer       string `json:"mailer"`  // smtp 或 log，log 只把邮件写入 logFile，用于开发环境
+		LogFile      string `json:"logFile"` // 为空则输出到标准日志
+		From         string `json:"from"`
+		SMTPHost     string `json:"smtpHost"`
+		SMTPPort     int    `json:"smtpPort"`
+		SMTPUser     string `json:"smtpUser"`
+		SMTPPassword string `json:"smtpPassword"`
+		// 邮件中验证链接指向的前端页面，token 会以 ?token= 的形式附加在后面，页面应当调用 /auth/email/verify-link
+		// 为空则邮件中只包含验证码
+		VerifyURL       string `json:"verifyUrl"`
+		VerifyExpireMin int    `json:"verifyExpireMin"`
+		// 开启后，邮箱未验证的用户不能报名成为投票人或候选人
+		RequireVerifiedForVoting bool `json:"requireVerifiedForVoting"`
+		// 检查 commit-reveal 投票是否进入揭示阶段并提醒尚未揭示的投票人的间隔，0 表示不提醒
+		RevealRemindSec int `json:"revealRemindSec"`
+	} `json:"email"`
+	ENS struct {
+		// ENS 兼容的注册表合约地址，可以是本地开发链上部署的 NameRegistry，为空表示不启用名称解析
+		RegistryAddr string `json:"registryAddr"`
+		CacheTTLSec  int    `json:"cacheTtlSec"`
+	} `json:"ens"`
+	Storage struct {
+		LocalDir string `json:"localDir"` // 上传文件（头像等）保存的目录，默认为 ./uploads
+	} `json:"storage"`
+	// 角色 -> 权限列表，列出的角色会覆盖默认的权限映射，"*" 表示全部权限
+	Permissions map[string][]string `json:"permissions"`
+}
+
+// RateLimitRule 令牌桶参数，rate 为每秒补充的令牌数，burst 为桶容量，rate 为 0 表示不限制
+// 钱包维度的限制只作用于携带有效 JWT 的请求
+type RateLimitRule struct {
+	IPRate      float64 `json:"ipRate"`
+	IPBurst     int     `json:"ipBurst"`
+	WalletRate  float64 `json:"walletRate"`
+	WalletBurst int     `json:"walletBurst"`
 }
 
 var G Config
@@ -35,6 +96,10 @@ var G Config
 func init() {
 	err := readConfig()
 	if err != nil {
+		// 单元测试不依赖 config.json，缺少时使用零值配置
+		if testing.Testing() && errors.Is(err, os.ErrNotExist) {
+			return
+		}
 		panic(err)
 	}
 }
@@ -54,6 +119,12 @@ func readConfig() error {
 	return nil
 }
 
+// Initialized 系统是否已经完成初始化（VotingNFT 合约已部署）
+// root 可以有多个，且可以在链上转移，因此不再以某个 root 钱包作为初始化标志
+func Initialized() bool {
+	return G.Blockchain.NFTContractAddr != ""
+}
+
 func SaveConfig() {
 	file, _ := json.MarshalIndent(G, "", "  ")
 	_ = os.WriteFile("./config.json", file, 0644)
@@ -19,5 +19,65 @@ func Migrate() error {
 		return errors.Wrapf(err, "Failed to migrate Vote model")
 	}
 
+	// 自动迁移（如果 sessions 表不存在则创建）
+	err = Db.AutoMigrate(&models.Session{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate Session model")
+	}
+
+	// 自动迁移（如果 user_wallets 表不存在则创建）
+	err = Db.AutoMigrate(&models.UserWallet{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate UserWallet model")
+	}
+
+	// 自动迁移（如果 admin_proposals 与 proposal_approvals 表不存在则创建）
+	err = Db.AutoMigrate(&models.AdminProposal{}, &models.ProposalApproval{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate AdminProposal model")
+	}
+
+	// 自动迁移（如果 email_verifications 表不存在则创建）
+	err = Db.AutoMigrate(&models.EmailVerification{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate EmailVerification model")
+	}
+
+	// 自动迁移（如果 vote_drafts 与 vote_draft_shares 表不存在则创建）
+	err = Db.AutoMigrate(&models.VoteDraft{}, &models.VoteDraftShare{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate VoteDraft model")
+	}
+
+	// 自动迁移（如果 vote_reports 表不存在则创建）
+	err = Db.AutoMigrate(&models.VoteReport{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate VoteReport model")
+	}
+
+	// 自动迁移（如果 vote_participations 表不存在则创建）
+	err = Db.AutoMigrate(&models.VoteParticipation{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate VoteParticipation model")
+	}
+
+	// 自动迁移（如果 vote_commitments 表不存在则创建）
+	err = Db.AutoMigrate(&models.VoteCommitment{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate VoteCommitment model")
+	}
+
+	// 自动迁移（如果 vote_allowlist_entries 表不存在则创建）
+	err = Db.AutoMigrate(&models.VoteAllowlistEntry{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate VoteAllowlistEntry model")
+	}
+
+	// 自动迁移（如果 offchain_ballots 表不存在则创建）
+	err = Db.AutoMigrate(&models.OffchainBallot{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to migrate OffchainBallot model")
+	}
+
 	return nil
 }
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	EmailPurposeRegister = "register" // 验证注册时填写的邮箱
+	EmailPurposeChange   = "change"   // 验证新邮箱，通过后替换用户当前的邮箱
+)
+
+// EmailCodeMaxAttempts 验证码最多可以尝试的次数，超过后需要重新发送
+const EmailCodeMaxAttempts = 5
+
+// EmailVerification 结构体对应 email_verifications 表，记录一次邮箱验证
+// 链接中的 token 与验证码都只保存 HMAC 签名，使用一次后即失效
+type EmailVerification struct {
+	ID         uint64 `gorm:"primaryKey" json:"id"`
+	UserID     uint64 `gorm:"index;not null" json:"user_id"`
+	Email      string `gorm:"type:VARCHAR(50);not null" json:"email"`
+	Purpose    string `gorm:"type:VARCHAR(20);not null" json:"purpose"`
+	TokenHash  string `gorm:"type:VARCHAR(64);unique;not null" json:"-"`
+	CodeHash   string `gorm:"type:VARCHAR(64);not null" json:"-"`
+	Attempts   int    `gorm:"not null;default:0" json:"attempts"`
+	ExpireTime int64  `gorm:"not null" json:"expire_time"`
+	UsedTime   int64  `gorm:"not null;default:0" json:"used_time"` // 0 表示未使用，被新的验证取代时也会写入
+	CreateTime int64  `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// TableName 指定 EmailVerification 结构体对应的表名
+func (EmailVerification) TableName() string {
+	return "email_verifications"
+}
+
+func (v *EmailVerification) Usable() bool {
+	return v.UsedTime == 0 && time.Now().Unix() < v.ExpireTime && v.Attempts < EmailCodeMaxAttempts
+}
+
+// InsertEmailVerification 写入新的验证，同一用户之前未使用的验证会一并作废
+func InsertEmailVerification(db *gorm.DB, verification *EmailVerification) error {
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&EmailVerification{}).
+			Where("user_id = ? AND used_time = 0", verification.UserID).
+			Update("used_time", time.Now().Unix()).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to expire previous email verifications")
+		}
+		err = tx.Create(verification).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to insert email verification")
+		}
+		return nil
+	})
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to create email verification")
+	}
+	return nil
+}
+
+func GetEmailVerificationByTokenHash(db *gorm.DB, tokenHash string) (*EmailVerification, error) {
+	var verification EmailVerification
+	err := db.Where("token_hash = ?", tokenHash).First(&verification).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get email verification")
+	}
+	return &verification, nil
+}
+
+// GetPendingEmailVerification 查询用户最近一次未使用的验证，没有时返回 nil
+func GetPendingEmailVerification(db *gorm.DB, userID uint64) (*EmailVerification, error) {
+	var verifications []EmailVerification
+	err := db.Where("user_id = ? AND used_time = 0", userID).Order("id desc").Limit(1).Find(&verifications).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get pending email verification")
+	}
+	if len(verifications) == 0 {
+		return nil, nil
+	}
+	return &verifications[0], nil
+}
+
+func IncreaseEmailVerificationAttempts(db *gorm.DB, id uint64) error {
+	err := db.Model(&EmailVerification{}).Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to update email verification attempts")
+	}
+	return nil
+}
+
+// ConsumeEmailVerification 使用一次验证，并把验证过的邮箱写回用户
+// 注册验证要求用户当前的邮箱没有被修改过；邮箱变更验证会替换用户的邮箱
+func ConsumeEmailVerification(db *gorm.DB, verification *EmailVerification) error {
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&EmailVerification{}).
+			Where("id = ? AND used_time = 0", verification.ID).
+			Update("used_time", time.Now().Unix())
+		if res.Error != nil {
+			return errors.Wrapf(res.Error, "failed to mark email verification as used")
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("verification has already been used")
+		}
+
+		st := tx.Model(&User{}).Where("id = ?", verification.UserID)
+		if verification.Purpose == EmailPurposeRegister {
+			st = st.Where("email = ?", verification.Email)
+		}
+		res = st.Updates(map[string]interface{}{"email": verification.Email, "email_verified": true})
+		if res.Error != nil {
+			return errors.Wrapf(res.Error, "failed to update user email, the email may be in use")
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("user email has changed since the verification was sent")
+		}
+		return nil
+	})
+
+	InvalidateUserCacheByUserID(verification.UserID)
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to consume email verification")
+	}
+	return nil
+}
+
+// EmailInUse 检查邮箱是否已被其他用户使用
+func EmailInUse(db *gorm.DB, email string, exceptUserID uint64) (bool, error) {
+	var count int64
+	err := db.Model(&User{}).Where("email = ? AND id != ?", email, exceptUserID).Count(&count).Error
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to query user email")
+	}
+	return count > 0, nil
+}
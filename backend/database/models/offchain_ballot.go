@@ -0,0 +1,83 @@
+package models
+
+import (
+	"backend/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrBallotExists 钱包已经在该投票中提交过选票
+var ErrBallotExists = errors.New("Wallet has already voted")
+
+// OffchainBallot 结构体对应 offchain_ballots 表，保存免 gas 投票中经过验证的 EIP-712 选票
+// 每个钱包在每个投票中只能有一张选票，提交之后不能修改
+type OffchainBallot struct {
+	ID           uint64 `gorm:"primaryKey" json:"id"`
+	ContractAddr string `gorm:"type:VARCHAR(100);uniqueIndex:idx_ballot_vote_wallet;not null" json:"contract_address"`
+	WalletAddr   string `gorm:"type:VARCHAR(100);uniqueIndex:idx_ballot_vote_wallet;not null" json:"wallet_address"`
+	Option       int64  `gorm:"not null" json:"option"`
+	IssuedAt     int64  `gorm:"not null" json:"issued_at"`                // 选票中签名的时间戳
+	Digest       string `gorm:"type:VARCHAR(100);not null" json:"digest"` // EIP-712 摘要
+	Signature    string `gorm:"type:VARCHAR(200);not null" json:"signature"`
+	Leaf         string `gorm:"type:VARCHAR(100);not null" json:"leaf"` // Merkle 树中的叶子
+	CreateTime   int64  `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// TableName 指定 OffchainBallot 结构体对应的表名
+func (OffchainBallot) TableName() string {
+	return "offchain_ballots"
+}
+
+// InsertOffchainBallot 写入选票，钱包已经投过票时返回 ErrBallotExists
+func InsertOffchainBallot(db *gorm.DB, ballot *OffchainBallot) error {
+	ballot.ContractAddr = utils.NormalizeHex(ballot.ContractAddr)
+	ballot.WalletAddr = utils.NormalizeHex(ballot.WalletAddr)
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(ballot)
+	if res.Error != nil {
+		return errors.Wrapf(res.Error, "failed to insert offchain ballot")
+	}
+	if res.RowsAffected == 0 {
+		return ErrBallotExists
+	}
+	return nil
+}
+
+func GetOffchainBallot(db *gorm.DB, contractAddr, walletAddr string) (*OffchainBallot, error) {
+	var ballot OffchainBallot
+	err := db.Where("contract_addr = ? AND wallet_addr = ?", utils.NormalizeHex(contractAddr), utils.NormalizeHex(walletAddr)).
+		First(&ballot).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get offchain ballot")
+	}
+	return &ballot, nil
+}
+
+func ListOffchainBallots(db *gorm.DB, contractAddr string) ([]OffchainBallot, error) {
+	var ballots []OffchainBallot
+	err := db.Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).Order("id asc").Find(&ballots).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list offchain ballots")
+	}
+	return ballots, nil
+}
+
+func CountOffchainBallots(db *gorm.DB, contractAddr string) (int64, error) {
+	var count int64
+	err := db.Model(&OffchainBallot{}).Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to count offchain ballots")
+	}
+	return count, nil
+}
+
+// SetVoteAnchor 记录锚定到链上的选票 Merkle 根，锚定交易上链、VerifyAnchorTx 确认链上的锚定与选票和计票结果一致之后写入
+func SetVoteAnchor(db *gorm.DB, contractAddr, root string, ballots int, resultHash string) error {
+	err := db.Model(&Vote{}).Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).
+		Select("anchor_root", "anchor_ballots", "anchor_result_hash").
+		Updates(&Vote{AnchorRoot: root, AnchorBallots: ballots, AnchorResultHash: resultHash}).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to set vote anchor")
+	}
+	return nil
+}
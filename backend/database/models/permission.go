@@ -0,0 +1,95 @@
+package models
+
+import (
+	"backend/config"
+	"backend/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// 权限名称，路由通过 middlewares.RequirePermission 声明所需的权限
+const (
+	PermSelfManage     = "self:manage"     // 修改自己的资料、管理关联钱包、查看自己参与的投票
+	PermVoteCreate     = "vote:create"     // 创建投票
+	PermVoteModerate   = "vote:moderate"   // 处理举报，修改投票的可见性
+	PermUserRead       = "user:read"       // 查看用户列表
+	PermUserEmailRead  = "user:email:read" // 查看其他用户的邮箱
+	PermUserSuspend    = "user:suspend"    // 停用、恢复用户
+	PermAdminRead      = "admin:read"      // 查看管理员列表
+	PermAdminPropose   = "admin:propose"   // 发起 admin 变更提议
+	PermAdminManage    = "admin:manage"    // 增删、同步管理员，链上交易仍然需要签名钱包拥有 ROOT_ROLE
+	PermRootManage     = "root:manage"     // 授予、撤销 ROOT_ROLE
+	PermRoleManage     = "role:manage"     // 设置 auditor、support 等非链上角色
+	PermSessionRead    = "session:read"    // 查看任意用户的会话
+	PermSessionManage  = "session:manage"  // 吊销任意用户的会话
+	PermSettingsRead   = "settings:read"   // 查看系统设置，例如报名是否要求验证邮箱
+	PermSettingsManage = "settings:manage" // 修改系统设置
+
+	PermAll = "*" // 拥有全部权限
+)
+
+// 不在链上体现的角色，可以由 root 直接设置
+const (
+	RoleAuditor = "auditor" // 只读审计
+	RoleSupport = "support" // 客服，可以协助用户处理会话
+)
+
+// defaultRolePermissions 在配置文件没有覆盖对应角色时使用，与原先 root > admin > user 的层级保持一致
+var defaultRolePermissions = map[string][]string{
+	RoleUser:    {PermSelfManage},
+	RoleAdmin:   {PermSelfManage, PermVoteCreate, PermVoteModerate, PermUserRead, PermUserEmailRead, PermAdminPropose, PermSettingsRead, PermSettingsManage},
+	RoleAuditor: {PermSelfManage, PermUserRead, PermUserEmailRead, PermAdminRead, PermSessionRead, PermSettingsRead},
+	RoleSupport: {PermSelfManage, PermUserRead, PermUserEmailRead, PermSessionRead, PermSessionManage},
+	RoleRoot:    {PermAll},
+}
+
+// RolePermissions 返回角色拥有的权限，配置文件 permissions 中列出的角色覆盖默认值
+func RolePermissions(role string) []string {
+	if perms, ok := config.G.Permissions[role]; ok {
+		return perms
+	}
+	return defaultRolePermissions[role]
+}
+
+// IsAssignableRole 判断角色是否可以通过接口直接设置，admin 与 root 必须通过链上交易变更
+func IsAssignableRole(role string) bool {
+	return role == RoleUser || role == RoleAuditor || role == RoleSupport
+}
+
+// RoleHasPermissions 判断角色是否同时拥有所有给定的权限
+func RoleHasPermissions(role string, perms ...string) bool {
+	granted := make(map[string]bool)
+	for _, p := range RolePermissions(role) {
+		granted[p] = true
+	}
+	if granted[PermAll] {
+		return true
+	}
+	for _, p := range perms {
+		if !granted[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// EffectiveRole 返回钱包在接口层面的角色
+// 附属钱包可以代表用户访问接口，但链上的 admin / root 权限只在主钱包上，因此附属钱包最多视为 user
+func EffectiveRole(user *User, walletAddr string) string {
+	if user.WalletAddr != utils.NormalizeHex(walletAddr) && (user.Role == RoleAdmin || user.Role == RoleRoot) {
+		return RoleUser
+	}
+	return user.Role
+}
+
+// UserHasPermissions 检查钱包对应的用户是否同时拥有所有给定的权限
+func UserHasPermissions(db *gorm.DB, walletAddr string, perms ...string) (bool, error) {
+	user, err := LookupUserCached(db, walletAddr)
+	if err != nil {
+		return false, err
+	}
+	if user == nil {
+		return false, errors.New("user not registered")
+	}
+	return RoleHasPermissions(EffectiveRole(user, walletAddr), perms...), nil
+}
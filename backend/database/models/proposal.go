@@ -0,0 +1,200 @@
+package models
+
+import (
+	"backend/utils"
+	"fmt"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const (
+	ProposalActionAddAdmin    = "add_admin"
+	ProposalActionRemoveAdmin = "remove_admin"
+)
+
+const (
+	ProposalStatusPending   = "pending"   // 等待审批
+	ProposalStatusApproved  = "approved"  // 审批数达到阈值，可以构建交易
+	ProposalStatusExecuting = "executing" // 已经构建交易，等待上链
+	ProposalStatusExecuted  = "executed"  // 交易已上链
+	ProposalStatusCancelled = "cancelled" // 被发起人或 root 取消
+)
+
+// AdminProposal 结构体对应 admin_proposals 表，记录一次 admin 变更的提议
+type AdminProposal struct {
+	ID           uint64 `gorm:"primaryKey" json:"id"`
+	Action       string `gorm:"type:VARCHAR(20);not null" json:"action"`
+	TargetAddr   string `gorm:"type:VARCHAR(100);index;not null" json:"target_address"`
+	ProposerAddr string `gorm:"type:VARCHAR(100);not null" json:"proposer_address"`
+	Reason       string `gorm:"type:VARCHAR(1024);not null" json:"reason"`
+	Status       string `gorm:"type:VARCHAR(20);index;not null" json:"status"`
+	Threshold    int    `gorm:"not null" json:"threshold"` // 提议创建时的审批阈值，之后修改配置不影响已有提议
+	TxHash       string `gorm:"type:VARCHAR(100);not null;default:''" json:"tx_hash"`
+	CreateTime   int64  `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime   int64  `gorm:"autoUpdateTime" json:"update_time"`
+
+	Approvals []ProposalApproval `gorm:"foreignKey:ProposalID" json:"approvals,omitempty"`
+}
+
+// ProposalApproval 结构体对应 proposal_approvals 表，每个审批人对每个提议最多一条
+type ProposalApproval struct {
+	ID           uint64 `gorm:"primaryKey" json:"id"`
+	ProposalID   uint64 `gorm:"uniqueIndex:idx_proposal_approver;not null" json:"proposal_id"`
+	ApproverAddr string `gorm:"type:VARCHAR(100);uniqueIndex:idx_proposal_approver;not null" json:"approver_address"`
+	Signature    string `gorm:"type:VARCHAR(200);not null" json:"signature"`
+	CreateTime   int64  `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// TableName 指定 AdminProposal 结构体对应的表名
+func (AdminProposal) TableName() string {
+	return "admin_proposals"
+}
+
+// TableName 指定 ProposalApproval 结构体对应的表名
+func (ProposalApproval) TableName() string {
+	return "proposal_approvals"
+}
+
+// ApprovalMessage 审批人需要签名的消息
+func (p *AdminProposal) ApprovalMessage() string {
+	return fmt.Sprintf("Approve proposal #%d: %s 0x%s", p.ID, p.Action, p.TargetAddr)
+}
+
+func InsertAdminProposal(db *gorm.DB, proposal *AdminProposal) error {
+	proposal.TargetAddr = utils.NormalizeHex(proposal.TargetAddr)
+	proposal.ProposerAddr = utils.NormalizeHex(proposal.ProposerAddr)
+	proposal.Status = ProposalStatusPending
+	err := db.Create(proposal).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to insert admin proposal")
+	}
+	log.Printf("Inserted new admin proposal: %v", proposal)
+	return nil
+}
+
+func GetAdminProposalByID(db *gorm.DB, id uint64) (*AdminProposal, error) {
+	var proposal AdminProposal
+	err := db.Preload("Approvals").Where("id = ?", id).First(&proposal).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get admin proposal")
+	}
+	return &proposal, nil
+}
+
+// HasOpenAdminProposal 检查同一目标、同一操作是否已有未完成的提议
+func HasOpenAdminProposal(db *gorm.DB, action, targetAddr string) (bool, error) {
+	var count int64
+	err := db.Model(&AdminProposal{}).
+		Where("action = ? AND target_addr = ? AND status IN ?", action, utils.NormalizeHex(targetAddr),
+			[]string{ProposalStatusPending, ProposalStatusApproved, ProposalStatusExecuting}).
+		Count(&count).Error
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to query admin proposals")
+	}
+	return count > 0, nil
+}
+
+// PageQueryAdminProposals 分页查询提议，status 为空则查询所有
+func PageQueryAdminProposals(db *gorm.DB, page, pageSize int, status string) ([]AdminProposal, int64, error) {
+	st := db.Model(&AdminProposal{})
+	if status != "" {
+		st = st.Where("status = ?", status)
+	}
+
+	var count int64
+	err := st.Count(&count).Error
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to count admin proposals")
+	}
+
+	var proposals []AdminProposal
+	err = st.Preload("Approvals").Order("create_time desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&proposals).Error
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to query admin proposals")
+	}
+	return proposals, count, nil
+}
+
+// ApproveAdminProposal 记录一次审批，审批数达到阈值时将提议标记为 approved
+func ApproveAdminProposal(db *gorm.DB, proposal *AdminProposal, approverAddr, signature string) error {
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&ProposalApproval{
+			ProposalID:   proposal.ID,
+			ApproverAddr: utils.NormalizeHex(approverAddr),
+			Signature:    utils.NormalizeHex(signature),
+		}).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to insert approval, the wallet may have approved already")
+		}
+
+		var count int64
+		err = tx.Model(&ProposalApproval{}).Where("proposal_id = ?", proposal.ID).Count(&count).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to count approvals")
+		}
+		if count >= int64(proposal.Threshold) {
+			err = tx.Model(&AdminProposal{}).
+				Where("id = ? AND status = ?", proposal.ID, ProposalStatusPending).
+				Update("status", ProposalStatusApproved).Error
+			if err != nil {
+				return errors.Wrapf(err, "failed to update proposal status")
+			}
+		}
+		return nil
+	})
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to approve admin proposal")
+	}
+	return nil
+}
+
+// ProposalClaimLease 构建交易后提议保持 executing 的时间，超过后允许重新构建，避免放弃的交易让提议永远无法执行
+const ProposalClaimLease = 10 * time.Minute
+
+// ClaimAdminProposal 构建交易前在同一条 UPDATE 中检查并占用提议，并发的构建只有一个能成功
+func ClaimAdminProposal(db *gorm.DB, id uint64) error {
+	now := time.Now()
+	res := db.Model(&AdminProposal{}).
+		Where("id = ? AND (status = ? OR (status = ? AND update_time < ?))", id,
+			ProposalStatusApproved, ProposalStatusExecuting, now.Add(-ProposalClaimLease).Unix()).
+		Updates(map[string]interface{}{"status": ProposalStatusExecuting, "update_time": now.Unix()})
+	if res.Error != nil {
+		return errors.Wrapf(res.Error, "failed to claim admin proposal")
+	}
+	if res.RowsAffected == 0 {
+		return errors.Errorf("proposal %d is not approved, or its transaction is being built by another request", id)
+	}
+	return nil
+}
+
+// LatestExecutedAdminProposalAction 目标钱包最近一次已执行的提议的操作，没有时返回空字符串
+func LatestExecutedAdminProposalAction(db *gorm.DB, targetAddr string) (string, error) {
+	var proposals []AdminProposal
+	err := db.Where("target_addr = ? AND status = ?", utils.NormalizeHex(targetAddr), ProposalStatusExecuted).
+		Order("update_time desc, id desc").Limit(1).Find(&proposals).Error
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to query admin proposals")
+	}
+	if len(proposals) == 0 {
+		return "", nil
+	}
+	return proposals[0].Action, nil
+}
+
+// UpdateAdminProposalStatus 将提议从 fromStatus 变更为 toStatus，状态不符时返回错误
+func UpdateAdminProposalStatus(db *gorm.DB, id uint64, fromStatus []string, toStatus, txHash string) error {
+	updates := map[string]interface{}{"status": toStatus, "update_time": time.Now().Unix()}
+	if txHash != "" {
+		updates["tx_hash"] = utils.NormalizeHex(txHash)
+	}
+	res := db.Model(&AdminProposal{}).Where("id = ? AND status IN ?", id, fromStatus).Updates(updates)
+	if res.Error != nil {
+		return errors.Wrapf(res.Error, "failed to update proposal status")
+	}
+	if res.RowsAffected == 0 {
+		return errors.Errorf("proposal %d is not in status %v", id, fromStatus)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"backend/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+// sessionTouchInterval 限制 last_seen_time 的刷新频率，避免每个请求都写库
+const sessionTouchInterval = 60 // in seconds
+
+// Session 结构体对应 sessions 表，每次 /auth/verify 签发 JWT 时写入一条
+type Session struct {
+	ID           uint64 `gorm:"primaryKey" json:"id"`
+	WalletAddr   string `gorm:"type:VARCHAR(100);index;not null" json:"wallet_address"` // 钱包地址, 没有 0x 前缀
+	IP           string `gorm:"type:VARCHAR(64);not null" json:"ip"`
+	UserAgent    string `gorm:"type:VARCHAR(512);not null" json:"user_agent"`
+	CreateTime   int64  `gorm:"autoCreateTime" json:"create_time"`
+	LastSeenTime int64  `gorm:"not null" json:"last_seen_time"`
+	RevokeTime   int64  `gorm:"not null;default:0" json:"revoke_time"` // 0 表示未吊销
+}
+
+// TableName 指定 Session 结构体对应的表名
+func (Session) TableName() string {
+	return "sessions"
+}
+
+func (s *Session) Revoked() bool {
+	return s.RevokeTime != 0
+}
+
+func InsertSession(db *gorm.DB, session *Session) error {
+	session.WalletAddr = utils.NormalizeHex(session.WalletAddr)
+	if len(session.UserAgent) > 512 {
+		session.UserAgent = session.UserAgent[:512]
+	}
+	session.LastSeenTime = time.Now().Unix()
+	err := db.Create(session).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to insert session")
+	}
+	return nil
+}
+
+func GetSessionByID(db *gorm.DB, id uint64) (*Session, error) {
+	var session Session
+	err := db.Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get session")
+	}
+	return &session, nil
+}
+
+func BatchGetSessionsByIDs(db *gorm.DB, ids []uint64) (map[uint64]*Session, error) {
+	res := make(map[uint64]*Session)
+	if len(ids) == 0 {
+		return res, nil
+	}
+	var sessions []Session
+	err := db.Where("id IN ?", ids).Find(&sessions).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get sessions")
+	}
+	for i := range sessions {
+		res[sessions[i].ID] = &sessions[i]
+	}
+	return res, nil
+}
+
+// ListActiveSessionsByWalletAddrs 查询若干钱包地址下所有未吊销的会话，最近活跃的在前
+func ListActiveSessionsByWalletAddrs(db *gorm.DB, walletAddrs []string) ([]Session, error) {
+	var sessions []Session
+	err := db.Where("wallet_addr IN ? AND revoke_time = 0", normalizeHexList(walletAddrs)).
+		Order("last_seen_time desc").Find(&sessions).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list sessions")
+	}
+	return sessions, nil
+}
+
+// ListSessionsByWalletAddrs 查询若干钱包地址下的全部会话，包括已吊销的，最近创建的在前
+func ListSessionsByWalletAddrs(db *gorm.DB, walletAddrs []string) ([]Session, error) {
+	var sessions []Session
+	err := db.Where("wallet_addr IN ?", normalizeHexList(walletAddrs)).
+		Order("create_time desc").Find(&sessions).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list sessions")
+	}
+	return sessions, nil
+}
+
+// TouchSession 刷新会话的 last_seen_time，距离上次刷新不足 sessionTouchInterval 时不写库
+func TouchSession(db *gorm.DB, session *Session) error {
+	now := time.Now().Unix()
+	if now-session.LastSeenTime < sessionTouchInterval {
+		return nil
+	}
+	err := db.Model(&Session{}).Where("id = ?", session.ID).Update("last_seen_time", now).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to touch session")
+	}
+	session.LastSeenTime = now
+	return nil
+}
+
+// RevokeSession 吊销指定会话
+// walletAddrs 不为空时，仅当会话属于其中某个钱包时才会吊销
+// 返回值表示是否有会话被吊销
+func RevokeSession(db *gorm.DB, id uint64, walletAddrs []string) (bool, error) {
+	st := db.Model(&Session{}).Where("id = ? AND revoke_time = 0", id)
+	if len(walletAddrs) > 0 {
+		st = st.Where("wallet_addr IN ?", normalizeHexList(walletAddrs))
+	}
+	res := st.Update("revoke_time", time.Now().Unix())
+	if res.Error != nil {
+		return false, errors.Wrapf(res.Error, "failed to revoke session")
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// RevokeAllSessionsByWalletAddr 吊销钱包地址下的所有会话，返回被吊销的数量
+func RevokeAllSessionsByWalletAddr(db *gorm.DB, walletAddr string) (int64, error) {
+	res := db.Model(&Session{}).
+		Where("wallet_addr = ? AND revoke_time = 0", utils.NormalizeHex(walletAddr)).
+		Update("revoke_time", time.Now().Unix())
+	if res.Error != nil {
+		return 0, errors.Wrapf(res.Error, "failed to revoke sessions")
+	}
+	return res.RowsAffected, nil
+}
+
+func normalizeHexList(list []string) []string {
+	res := make([]string, 0, len(list))
+	for _, item := range list {
+		res = append(res, utils.NormalizeHex(item))
+	}
+	return res
+}
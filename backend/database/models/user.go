@@ -2,19 +2,28 @@ package models
 
 import (
 	"backend/utils"
+	"fmt"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
 	"log"
+	"strings"
+	"time"
 )
 
 // User 结构体对应 users 表
 type User struct {
-	ID         uint64 `gorm:"primaryKey" json:"id"`
-	Email      string `gorm:"type:VARCHAR(50);unique;not null" json:"email"`
-	Nickname   string `gorm:"type:VARCHAR(255);not null" json:"nickname"`
-	Role       string `gorm:"type:VARCHAR(10);not null" json:"role"`
-	WalletAddr string `gorm:"type:VARCHAR(100);unique;not null" json:"wallet_address"` // 钱包地址, 没有 0x 前缀
-	CreateTime int64  `gorm:"autoCreateTime" json:"create_time"`
+	ID            uint64   `gorm:"primaryKey" json:"id"`
+	Email         string   `gorm:"type:VARCHAR(50);unique;not null" json:"email"`
+	EmailVerified bool     `gorm:"not null;default:false" json:"email_verified"`
+	Nickname      string   `gorm:"type:VARCHAR(255);not null" json:"nickname"`
+	Bio           string   `gorm:"type:VARCHAR(2048);not null;default:''" json:"bio"`
+	Links         []string `gorm:"type:VARCHAR(2048);serializer:json" json:"links"`
+	Avatar        string   `gorm:"type:VARCHAR(200);not null;default:''" json:"avatar"`       // 头像在 utils.Storage 中的 key，空表示没有头像
+	AvatarThumb   string   `gorm:"type:VARCHAR(200);not null;default:''" json:"avatar_thumb"` // 头像缩略图的 key
+	Role          string   `gorm:"type:VARCHAR(10);not null" json:"role"`
+	WalletAddr    string   `gorm:"type:VARCHAR(100);unique;not null" json:"wallet_address"` // 钱包地址, 没有 0x 前缀
+	Status        string   `gorm:"type:VARCHAR(20);not null;default:'active'" json:"status"`
+	CreateTime    int64    `gorm:"autoCreateTime" json:"create_time"`
 }
 
 const (
@@ -24,6 +33,12 @@ const (
 	RoleRoot  = "root"
 )
 
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended" // 被 root 停用，所有需要登录的接口都会拒绝访问
+	UserStatusDeleted   = "deleted"   // 用户已注销，个人信息已被匿名化，钱包已被释放
+)
+
 const (
 	StateUnverified = "unverified" // 表示用户未登录或者 JWT Token 无效
 	StateVerified   = "verified"   // 表示用户已拥有有效的 JWT Token，但未注册
@@ -39,11 +54,15 @@ func InsertUser(db *gorm.DB, user *User) error {
 	if user.Role == "" {
 		user.Role = RoleUser
 	}
+	if user.Status == "" {
+		user.Status = UserStatusActive
+	}
 	user.WalletAddr = utils.NormalizeHex(user.WalletAddr)
 	err := db.Create(user).Error
 	if err != nil {
 		return errors.Wrapf(err, "failed to insert user")
 	}
+	InvalidateUserCache(user.WalletAddr)
 	log.Printf("Inserted new user: %v", user)
 	return nil
 }
@@ -66,23 +85,36 @@ func GetUserByWalletAddr(db *gorm.DB, walletAddr string) (*User, error) {
 	return &user, nil
 }
 
+// UserHasRole 检查钱包对应的用户是否拥有指定角色
+// 新的路由应当使用 UserHasPermissions，按权限而不是角色层级进行判断
 func UserHasRole(db *gorm.DB, walletAddr, role string) (bool, error) {
-	user, err := GetUserByWalletAddr(db, walletAddr)
+	user, err := LookupUserCached(db, walletAddr)
 	if err != nil {
 		return false, err
 	}
-	switch user.Role {
+	if user == nil {
+		return false, errors.New("user not registered")
+	}
+	return RoleIncludes(EffectiveRole(user, walletAddr), role)
+}
+
+// RoleIncludes 按 root > admin > user 的层级判断 userRole 是否包含 role
+func RoleIncludes(userRole, role string) (bool, error) {
+	if role == userRole {
+		return true, nil
+	}
+	switch userRole {
 	case RoleRoot:
 		// root user has all roles
 		return true, nil
 	case RoleAdmin:
 		// admin user has admin and user roles
 		return role == RoleAdmin || role == RoleUser, nil
-	case RoleUser:
-		// normal user has only user role
+	case RoleUser, RoleAuditor, RoleSupport:
+		// normal user has only user role, auditor and support are users with extra permissions
 		return role == RoleUser, nil
 	default:
-		return false, errors.Errorf("unknown user role '%s'", user.Role)
+		return false, errors.Errorf("unknown user role '%s'", userRole)
 	}
 }
 
@@ -91,9 +123,34 @@ func UpdateUserByWalletAddr(db *gorm.DB, walletAddr, nickname string) error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to update user")
 	}
+	InvalidateUserCache(walletAddr)
 	return nil
 }
 
+// UpdateUserProfileByWalletAddr 更新简介与外部链接，调用前应当已经过滤
+func UpdateUserProfileByWalletAddr(db *gorm.DB, walletAddr, bio string, links []string) error {
+	err := db.Model(&User{}).Where("wallet_addr = ?", walletAddr).
+		Select("bio", "links").Updates(&User{Bio: bio, Links: links}).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to update user profile")
+	}
+	InvalidateUserCache(walletAddr)
+	return nil
+}
+
+// SetUserAvatarByWalletAddr 设置头像，avatar 与 thumb 为空表示删除头像
+func SetUserAvatarByWalletAddr(db *gorm.DB, walletAddr, avatar, thumb string) error {
+	err := db.Model(&User{}).Where("wallet_addr = ?", walletAddr).
+		Updates(map[string]interface{}{"avatar": avatar, "avatar_thumb": thumb}).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to set user avatar")
+	}
+	InvalidateUserCache(walletAddr)
+	return nil
+}
+
+// SyncAdminListByWalletAddrList 按链上 admin 列表同步数据库中的角色
+// 只有主钱包可以携带 admin 身份，链上为附属钱包授予的 admin 不会体现在数据库中
 func SyncAdminListByWalletAddrList(db *gorm.DB, walletAddrList []string) error {
 	// start transaction
 	outerErr := db.Transaction(func(tx *gorm.DB) error {
@@ -115,17 +172,155 @@ func SyncAdminListByWalletAddrList(db *gorm.DB, walletAddrList []string) error {
 		return nil
 	})
 
+	ClearUserCache()
 	if outerErr != nil {
 		return errors.Wrapf(outerErr, "failed to sync admin list")
 	}
 	return nil
 }
 
+// SyncRootListByWalletAddrList 按链上 ROOT_ROLE 成员同步数据库中的 root 角色
+// 不在列表中的 root 会降级为 user，之后应当再调用 SyncAdminListByWalletAddrList 恢复其 admin 身份
+func SyncRootListByWalletAddrList(db *gorm.DB, walletAddrList []string) error {
+	walletAddrList = normalizeHexList(walletAddrList)
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		st := tx.Model(&User{}).Where("role = ?", RoleRoot)
+		if len(walletAddrList) > 0 {
+			st = st.Where("wallet_addr NOT IN ?", walletAddrList)
+		}
+		err := st.Update("role", RoleUser).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to demote root users")
+		}
+
+		if len(walletAddrList) > 0 {
+			err = tx.Model(&User{}).Where("wallet_addr IN ?", walletAddrList).Update("role", RoleRoot).Error
+			if err != nil {
+				return errors.Wrapf(err, "failed to update root users")
+			}
+		}
+		return nil
+	})
+
+	ClearUserCache()
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to sync root list")
+	}
+	return nil
+}
+
 func SetUserRoleByWalletAddr(db *gorm.DB, walletAddr, role string) error {
 	walletAddr = utils.NormalizeHex(walletAddr)
 	err := db.Model(&User{}).Where("wallet_addr = ?", walletAddr).Update("role", role).Error
 	if err != nil {
 		return errors.Wrapf(err, "failed to set user role")
 	}
+	InvalidateUserCache(walletAddr)
 	return nil
 }
+
+// PageQueryUsers 分页查询用户
+// role、status 为空则不过滤，search 对邮箱和昵称做模糊匹配
+// 按 create_time 排序，asc 为 false 时最新的在前
+func PageQueryUsers(db *gorm.DB, page, pageSize int, role, status, search string, asc bool) ([]User, int64, error) {
+	st := db.Model(&User{})
+	if role != "" {
+		st = st.Where("role = ?", role)
+	}
+	if status != "" {
+		st = st.Where("status = ?", status)
+	}
+	if search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		st = st.Where("email LIKE ? OR nickname LIKE ?", pattern, pattern)
+	}
+
+	var count int64
+	err := st.Count(&count).Error
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to count users")
+	}
+
+	order := "create_time desc, id desc"
+	if asc {
+		order = "create_time asc, id asc"
+	}
+	var users []User
+	err = st.Order(order).Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to query users")
+	}
+	return users, count, nil
+}
+
+func SetUserStatusByWalletAddr(db *gorm.DB, walletAddr, status string) error {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	err := db.Model(&User{}).Where("wallet_addr = ?", walletAddr).Update("status", status).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to set user status")
+	}
+	InvalidateUserCache(walletAddr)
+	return nil
+}
+
+// AnonymizeUser 注销用户：清除个人信息，释放主钱包与附属钱包，吊销所有会话并清空其中的 IP 与 UA
+// 记录本身保留，避免其他表中的引用失效；钱包释放后可以重新注册
+func AnonymizeUser(db *gorm.DB, user *User) error {
+	walletAddrs, err := ListAllWalletAddrsOfUser(db, user)
+	if err != nil {
+		return err
+	}
+
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"email":          fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+			"email_verified": false,
+			"nickname":       "Deleted user",
+			"bio":            "",
+			"links":          nil,
+			"avatar":         "",
+			"avatar_thumb":   "",
+			"role":           RoleUser,
+			"status":         UserStatusDeleted,
+			"wallet_addr":    fmt.Sprintf("deleted-%d", user.ID),
+		}).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to anonymize user")
+		}
+
+		err = tx.Where("user_id = ?", user.ID).Delete(&UserWallet{}).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete user wallets")
+		}
+
+		err = tx.Where("user_id = ?", user.ID).Delete(&EmailVerification{}).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete email verifications")
+		}
+
+		err = tx.Model(&Session{}).Where("wallet_addr IN ? AND revoke_time = 0", walletAddrs).
+			Update("revoke_time", time.Now().Unix()).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to revoke sessions")
+		}
+		err = tx.Model(&Session{}).Where("wallet_addr IN ?", walletAddrs).
+			Updates(map[string]interface{}{"ip": "", "user_agent": ""}).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to clear sessions")
+		}
+		return nil
+	})
+
+	InvalidateUserCache(walletAddrs...)
+	InvalidateUserCacheByUserID(user.ID)
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to delete account")
+	}
+	log.Printf("Anonymized user %d", user.ID)
+	return nil
+}
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
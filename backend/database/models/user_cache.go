@@ -0,0 +1,146 @@
+package models
+
+import (
+	"backend/config"
+	"backend/utils"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// userCache 进程内的用户查询缓存，key 为主钱包或附属钱包地址
+// 用于 RequirePermission / RequireRole / /auth/state 这类每个请求都要执行的查询
+// 未注册的钱包也会被缓存，InsertUser 等写操作会使相关条目失效
+// 多实例部署时，其他实例的修改只能等 TTL 过期后生效
+// 缓存按 LRU 淘汰，最多保留 maxUserCacheEntries 个钱包，任意钱包的查询都不会让缓存无限增长
+// version 在每次失效时递增，查询开始后发生过失效的结果不会写入缓存，避免把失效前读到的旧数据写回
+var userCache = struct {
+	mu      sync.Mutex
+	entries lru.BasicLRU[string, userCacheEntry]
+	version uint64
+	hits    atomic.Int64
+	misses  atomic.Int64
+}{entries: lru.NewBasicLRU[string, userCacheEntry](maxUserCacheEntries)}
+
+const maxUserCacheEntries = 10000
+
+type userCacheEntry struct {
+	user     *User // nil 表示钱包未注册
+	expireAt time.Time
+}
+
+// UserCacheStats 缓存命中统计
+type UserCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+	TTLSec  int   `json:"ttl_sec"`
+}
+
+func userCacheTTL() time.Duration {
+	return time.Duration(config.G.Server.RoleCacheTTLSec) * time.Second
+}
+
+// LookupUserCached 通过主钱包或附属钱包查询用户，结果会被缓存
+// 钱包未注册时返回 nil, nil
+// 返回的 User 是副本，可以随意修改
+func LookupUserCached(db *gorm.DB, walletAddr string) (*User, error) {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	ttl := userCacheTTL()
+
+	userCache.mu.Lock()
+	version := userCache.version
+	entry, ok := userCache.entries.Get(walletAddr)
+	userCache.mu.Unlock()
+	if ttl > 0 && ok && time.Now().Before(entry.expireAt) {
+		userCache.hits.Add(1)
+		return copyUser(entry.user), nil
+	}
+	userCache.misses.Add(1)
+
+	user, err := GetUserByAnyWalletAddr(db, walletAddr)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		user = nil
+	}
+
+	if ttl > 0 {
+		userCache.mu.Lock()
+		if userCache.version == version {
+			userCache.entries.Add(walletAddr, userCacheEntry{user: copyUser(user), expireAt: time.Now().Add(ttl)})
+		}
+		userCache.mu.Unlock()
+	}
+	return user, nil
+}
+
+// InvalidateUserCache 使与给定钱包相关的缓存失效
+// 钱包属于某个用户时，该用户所有钱包的缓存都会失效
+func InvalidateUserCache(walletAddrs ...string) {
+	userCache.mu.Lock()
+	defer userCache.mu.Unlock()
+	userCache.version++
+
+	userIDs := make(map[uint64]bool)
+	for _, walletAddr := range walletAddrs {
+		walletAddr = utils.NormalizeHex(walletAddr)
+		if entry, ok := userCache.entries.Peek(walletAddr); ok && entry.user != nil {
+			userIDs[entry.user.ID] = true
+		}
+		userCache.entries.Remove(walletAddr)
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+	removeUserCacheEntries(func(user *User) bool { return userIDs[user.ID] })
+}
+
+// InvalidateUserCacheByUserID 使某个用户所有钱包的缓存失效
+func InvalidateUserCacheByUserID(userID uint64) {
+	userCache.mu.Lock()
+	defer userCache.mu.Unlock()
+	userCache.version++
+	removeUserCacheEntries(func(user *User) bool { return user.ID == userID })
+}
+
+// removeUserCacheEntries 删除属于匹配用户的缓存，调用者需要持有锁
+func removeUserCacheEntries(match func(user *User) bool) {
+	for _, key := range userCache.entries.Keys() {
+		if entry, ok := userCache.entries.Peek(key); ok && entry.user != nil && match(entry.user) {
+			userCache.entries.Remove(key)
+		}
+	}
+}
+
+// ClearUserCache 清空全部缓存，用于批量修改角色之后
+func ClearUserCache() {
+	userCache.mu.Lock()
+	userCache.version++
+	userCache.entries.Purge()
+	userCache.mu.Unlock()
+}
+
+func GetUserCacheStats() UserCacheStats {
+	userCache.mu.Lock()
+	entries := userCache.entries.Len()
+	userCache.mu.Unlock()
+	return UserCacheStats{
+		Hits:    userCache.hits.Load(),
+		Misses:  userCache.misses.Load(),
+		Entries: entries,
+		TTLSec:  config.G.Server.RoleCacheTTLSec,
+	}
+}
+
+func copyUser(user *User) *User {
+	if user == nil {
+		return nil
+	}
+	u := *user
+	return &u
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"backend/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"log"
+)
+
+// UserWallet 结构体对应 user_wallets 表，记录关联到某个用户的附属钱包
+// 用户的主钱包始终保存在 users.wallet_addr 中，不会出现在本表
+// 链上的 admin / root 权限只认主钱包，附属钱包在接口层面只拥有 user 权限
+type UserWallet struct {
+	ID         uint64 `gorm:"primaryKey" json:"id"`
+	UserID     uint64 `gorm:"index;not null" json:"user_id"`
+	WalletAddr string `gorm:"type:VARCHAR(100);unique;not null" json:"wallet_address"` // 钱包地址, 没有 0x 前缀
+	CreateTime int64  `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// TableName 指定 UserWallet 结构体对应的表名
+func (UserWallet) TableName() string {
+	return "user_wallets"
+}
+
+func InsertUserWallet(db *gorm.DB, wallet *UserWallet) error {
+	wallet.WalletAddr = utils.NormalizeHex(wallet.WalletAddr)
+	err := db.Create(wallet).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to insert user wallet")
+	}
+	InvalidateUserCache(wallet.WalletAddr)
+	InvalidateUserCacheByUserID(wallet.UserID)
+	log.Printf("Linked wallet %s to user %d", wallet.WalletAddr, wallet.UserID)
+	return nil
+}
+
+func ListUserWalletsByUserID(db *gorm.DB, userID uint64) ([]UserWallet, error) {
+	var wallets []UserWallet
+	err := db.Where("user_id = ?", userID).Order("create_time asc").Find(&wallets).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list user wallets")
+	}
+	return wallets, nil
+}
+
+func DeleteUserWallet(db *gorm.DB, userID uint64, walletAddr string) (bool, error) {
+	res := db.Where("user_id = ? AND wallet_addr = ?", userID, utils.NormalizeHex(walletAddr)).Delete(&UserWallet{})
+	if res.Error != nil {
+		return false, errors.Wrapf(res.Error, "failed to delete user wallet")
+	}
+	InvalidateUserCache(walletAddr)
+	InvalidateUserCacheByUserID(userID)
+	return res.RowsAffected > 0, nil
+}
+
+// WalletAddrInUse 检查钱包地址是否已被注册为主钱包或已关联到某个用户
+func WalletAddrInUse(db *gorm.DB, walletAddr string) (bool, error) {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	exists, err := UserExists(db, walletAddr)
+	if err != nil || exists {
+		return exists, err
+	}
+	var count int64
+	err = db.Model(&UserWallet{}).Where("wallet_addr = ?", walletAddr).Count(&count).Error
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to query user wallet")
+	}
+	return count > 0, nil
+}
+
+// GetUserByAnyWalletAddr 通过主钱包或附属钱包查询用户
+func GetUserByAnyWalletAddr(db *gorm.DB, walletAddr string) (*User, error) {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	var user User
+	err := db.Where("wallet_addr = ?", walletAddr).
+		Or("id = (?)", db.Model(&UserWallet{}).Select("user_id").Where("wallet_addr = ?", walletAddr)).
+		First(&user).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get user")
+	}
+	return &user, nil
+}
+
+// BatchGetUsersByAnyWalletAddrs 通过主钱包或附属钱包批量查询用户，返回 钱包地址 -> 用户
+// 未注册的钱包不会出现在结果中；查询次数与钱包数量无关
+func BatchGetUsersByAnyWalletAddrs(db *gorm.DB, walletAddrs []string) (map[string]*User, error) {
+	walletAddrs = normalizeHexList(walletAddrs)
+	res := make(map[string]*User)
+	if len(walletAddrs) == 0 {
+		return res, nil
+	}
+
+	var wallets []UserWallet
+	err := db.Where("wallet_addr IN ?", walletAddrs).Find(&wallets).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query user wallets")
+	}
+	userIDs := make([]uint64, 0, len(wallets))
+	for _, w := range wallets {
+		userIDs = append(userIDs, w.UserID)
+	}
+
+	var users []User
+	st := db.Where("wallet_addr IN ?", walletAddrs)
+	if len(userIDs) > 0 {
+		st = st.Or("id IN ?", userIDs)
+	}
+	err = st.Find(&users).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query users")
+	}
+
+	byID := make(map[uint64]*User)
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+		res[users[i].WalletAddr] = &users[i]
+	}
+	for _, w := range wallets {
+		if user, ok := byID[w.UserID]; ok {
+			res[w.WalletAddr] = user
+		}
+	}
+	return res, nil
+}
+
+// ResolvePrimaryWalletAddr 将附属钱包解析为用户的主钱包
+// 钱包未注册也未关联时原样返回
+func ResolvePrimaryWalletAddr(db *gorm.DB, walletAddr string) (string, error) {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	user, err := LookupUserCached(db, walletAddr)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return walletAddr, nil
+	}
+	return user.WalletAddr, nil
+}
+
+// ListAllWalletAddrsOfUser 返回用户的全部钱包地址，主钱包在前
+func ListAllWalletAddrsOfUser(db *gorm.DB, user *User) ([]string, error) {
+	wallets, err := ListUserWalletsByUserID(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{user.WalletAddr}
+	for _, w := range wallets {
+		res = append(res, w.WalletAddr)
+	}
+	return res, nil
+}
+
+// SetPrimaryWalletAddr 将用户的某个附属钱包设为主钱包，原主钱包变为附属钱包
+func SetPrimaryWalletAddr(db *gorm.DB, user *User, walletAddr string) error {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&UserWallet{}).
+			Where("user_id = ? AND wallet_addr = ?", user.ID, walletAddr).
+			Update("wallet_addr", user.WalletAddr)
+		if res.Error != nil {
+			return errors.Wrapf(res.Error, "failed to update user wallet")
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("wallet is not linked to the user")
+		}
+		err := tx.Model(&User{}).Where("id = ?", user.ID).Update("wallet_addr", walletAddr).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to update primary wallet")
+		}
+		return nil
+	})
+	InvalidateUserCacheByUserID(user.ID)
+	InvalidateUserCache(user.WalletAddr, walletAddr)
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to set primary wallet")
+	}
+	user.WalletAddr = walletAddr
+	return nil
+}
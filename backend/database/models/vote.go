@@ -1,10 +1,12 @@
 package models
 
 import (
+	"backend/tally"
 	"backend/utils"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
 	"log"
+	"time"
 )
 
 // Vote 结构体对应 votes 表
@@ -12,7 +14,62 @@ type Vote struct {
 	ID           uint64 `gorm:"primaryKey" json:"id"`
 	ContractAddr string `gorm:"type:VARCHAR(100);unique;not null" json:"contract_address"`
 	OwnerAddr    string `gorm:"type:VARCHAR(100);not null" json:"owner_address"`
-	CreateTime   int64  `gorm:"autoCreateTime" json:"create_time"`
+	// 从草稿部署的投票会带上草稿中的计划时间，0 表示未设置
+	RegistrationStartTime int64 `gorm:"not null;default:0" json:"registration_start_time"`
+	VotingStartTime       int64 `gorm:"not null;default:0" json:"voting_start_time"`
+	VotingEndTime         int64 `gorm:"not null;default:0" json:"voting_end_time"`
+	// 使用 VotingCommitReveal 合约，选票先提交承诺，揭示之后才写入 VotingNFT
+	CommitReveal bool `gorm:"not null;default:false" json:"commit_reveal"`
+	// 免 gas 投票：选票是签名后提交给后端的 EIP-712 消息，结束后由 owner 将 Merkle 根锚定到 BallotAnchor 合约
+	Gasless          bool   `gorm:"not null;default:false" json:"gasless"`
+	AnchorRoot       string `gorm:"type:VARCHAR(100);not null;default:''" json:"anchor_root"` // 为空表示尚未锚定，没有选票时为全零
+	AnchorBallots    int    `gorm:"not null;default:0" json:"anchor_ballots"`
+	AnchorResultHash string `gorm:"type:VARCHAR(100);not null;default:''" json:"anchor_result_hash"`
+	// 可见性由 admin 与 root 维护，owner 始终可以看到自己的投票
+	// 审核人与审核备注是内部信息，不直接序列化，只在接口层返回给有审核权限的用户
+	Visibility     string `gorm:"type:VARCHAR(20);index;not null;default:'listed'" json:"visibility"`
+	ModeratorAddr  string `gorm:"type:VARCHAR(100);not null;default:''" json:"-"` // 最近一次修改可见性的钱包
+	ModerationNote string `gorm:"type:VARCHAR(1024);not null;default:''" json:"-"`
+	ModerationTime int64  `gorm:"not null;default:0" json:"moderation_time"`
+	// 以下字段是链上信息的缓存，用于筛选、搜索与排序，MetaSyncTime 为 0 表示尚未同步
+	Title            string `gorm:"type:VARCHAR(255);not null;default:''" json:"title"`
+	Description      string `gorm:"type:TEXT" json:"description"`
+	OptionType       int    `gorm:"not null;default:0" json:"option_type"`
+	NeedRegistration bool   `gorm:"not null;default:false" json:"need_registration"`
+	State            int    `gorm:"index;not null;default:0" json:"state"`
+	Participants     int    `gorm:"not null;default:0" json:"participants"`  // 持有该投票 NFT 的钱包数，包括候选人
+	Turnout          int    `gorm:"index;not null;default:0" json:"turnout"` // 已投出的票数
+	MetaSyncTime     int64  `gorm:"not null;default:0" json:"meta_sync_time"`
+	// 计票规则，投票结束之前 owner 可以修改
+	TallyConfig tally.Config `gorm:"type:TEXT;serializer:json" json:"tally_config"`
+	// 登记与投票的资格规则，由后端在生成交易时检查
+	Eligibility Eligibility `gorm:"type:TEXT;serializer:json" json:"eligibility"`
+	CreateTime  int64       `gorm:"autoCreateTime" json:"create_time"`
+}
+
+const (
+	VoteVisibilityListed   = "listed"   // 出现在公开列表中
+	VoteVisibilityUnlisted = "unlisted" // 不出现在公开列表中，但知道地址仍然可以访问
+	VoteVisibilityArchived = "archived" // 已归档，不出现在公开列表中，知道地址仍然可以访问
+	VoteVisibilityRemoved  = "removed"  // 已移除，只有 owner 与管理员可以访问
+)
+
+const (
+	VoteStateInit         = 0 // 对应 Voting 合约中的 State.Init
+	VoteStateRegistration = 1
+	VoteStateVoting       = 2
+	VoteStateEnded        = 3
+	VoteStateReveal       = 4 // 只有 commit-reveal 投票有，位于 Voting 与 Ended 之间，此时 Voting 为提交承诺阶段
+)
+
+// IsVoteVisibility 判断是否为合法的可见性
+func IsVoteVisibility(visibility string) bool {
+	switch visibility {
+	case VoteVisibilityListed, VoteVisibilityUnlisted, VoteVisibilityArchived, VoteVisibilityRemoved:
+		return true
+	default:
+		return false
+	}
 }
 
 // TableName 指定 User 结构体对应的表名
@@ -23,6 +80,9 @@ func (Vote) TableName() string {
 func InsertVote(db *gorm.DB, vote *Vote) error {
 	vote.ContractAddr = utils.NormalizeHex(vote.ContractAddr)
 	vote.OwnerAddr = utils.NormalizeHex(vote.OwnerAddr)
+	if vote.Visibility == "" {
+		vote.Visibility = VoteVisibilityListed
+	}
 	err := db.Create(vote).Error
 	if err != nil {
 		return errors.Wrapf(err, "failed to insert vote")
@@ -31,43 +91,81 @@ func InsertVote(db *gorm.DB, vote *Vote) error {
 	return nil
 }
 
-// PageQueryVotes 分页查询投票
-// page 页码，从 1 开始
-// pageSize 每页大小
-// owner 投票 owner 地址, 为空则查询所有
-func PageQueryVotes(db *gorm.DB, page, pageSize int, owner string) ([]Vote, error) {
-	var votes []Vote
-	// order by create time desc
-	st := db.Model(&Vote{})
-	if owner != "" {
-		st = st.Where("owner_addr = ?", utils.NormalizeHex(owner))
+func GetVoteByContractAddr(db *gorm.DB, contractAddr string) (*Vote, error) {
+	contractAddr = utils.NormalizeHex(contractAddr)
+	var vote Vote
+	err := db.Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).First(&vote).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get vote by contract address")
 	}
-	err := st.Order("create_time desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&votes).Error
+	return &vote, nil
+}
+
+// ListVotesByOwnerAddrs 查询若干钱包地址创建的全部投票
+func ListVotesByOwnerAddrs(db *gorm.DB, ownerAddrs []string) ([]Vote, error) {
+	var votes []Vote
+	err := db.Where("owner_addr IN ?", normalizeHexList(ownerAddrs)).Order("create_time desc").Find(&votes).Error
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to query votes")
 	}
 	return votes, nil
 }
 
-func CountVotes(db *gorm.DB, owner string) (int64, error) {
-	var count int64
-	st := db.Model(&Vote{})
-	if owner != "" {
-		st = st.Where("owner_addr = ?", utils.NormalizeHex(owner))
+// SetVoteVisibility 修改投票的可见性，并记录操作人与备注
+func SetVoteVisibility(db *gorm.DB, contractAddr, visibility, moderatorAddr, note string) error {
+	res := db.Model(&Vote{}).Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).Updates(map[string]interface{}{
+		"visibility":      visibility,
+		"moderator_addr":  utils.NormalizeHex(moderatorAddr),
+		"moderation_note": note,
+		"moderation_time": time.Now().Unix(),
+	})
+	if res.Error != nil {
+		return errors.Wrapf(res.Error, "failed to set vote visibility")
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("vote not found")
 	}
-	err := st.Count(&count).Error
+	log.Printf("Vote %s visibility set to %s by %s", contractAddr, visibility, moderatorAddr)
+	return nil
+}
+
+// UpdateVoteMetadata 保存从链上读取的投票信息
+func UpdateVoteMetadata(db *gorm.DB, contractAddr string, meta *Vote) error {
+	meta.MetaSyncTime = time.Now().Unix()
+	err := db.Model(&Vote{}).Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).
+		Select("title", "description", "option_type", "need_registration", "state", "participants", "turnout", "meta_sync_time").
+		Updates(meta).Error
 	if err != nil {
-		return 0, errors.Wrapf(err, "failed to count votes")
+		return errors.Wrapf(err, "failed to update vote metadata")
 	}
-	return count, nil
+	return nil
 }
 
-func GetVoteByContractAddr(db *gorm.DB, contractAddr string) (*Vote, error) {
-	contractAddr = utils.NormalizeHex(contractAddr)
-	var vote Vote
-	err := db.Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).First(&vote).Error
+// ListVotesForMetaSync 列出需要刷新链上信息的投票：从未同步过的，以及尚未结束的
+func ListVotesForMetaSync(db *gorm.DB) ([]Vote, error) {
+	var votes []Vote
+	err := db.Where("meta_sync_time = 0 OR state <> ?", VoteStateEnded).Order("meta_sync_time asc").Find(&votes).Error
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get vote by contract address")
+		return nil, errors.Wrapf(err, "failed to list votes for metadata sync")
 	}
-	return &vote, nil
+	return votes, nil
+}
+
+// ListCommitRevealVotesForRemind 列出可能处于揭示阶段的 commit-reveal 投票，即缓存的状态尚未结束的
+func ListCommitRevealVotesForRemind(db *gorm.DB) ([]Vote, error) {
+	var votes []Vote
+	err := db.Where("commit_reveal = ? AND state <> ?", true, VoteStateEnded).Find(&votes).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list commit-reveal votes")
+	}
+	return votes, nil
+}
+
+func SetVoteTallyConfig(db *gorm.DB, contractAddr string, cfg *tally.Config) error {
+	err := db.Model(&Vote{}).Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).
+		Select("tally_config").Updates(&Vote{TallyConfig: *cfg}).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to set vote tally config")
+	}
+	return nil
 }
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"backend/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// MaxVoteAllowlistEntries 每个投票的名单最多的条目数
+const MaxVoteAllowlistEntries = 10000
+
+// VoteAllowlistEntry 结构体对应 vote_allowlist_entries 表，名单不为空时只有名单中的成员可以登记与投票
+// 每条记录是一个钱包或一个注册用户，按用户加入时该用户的全部钱包都可以使用
+type VoteAllowlistEntry struct {
+	ID           uint64 `gorm:"primaryKey" json:"id"`
+	ContractAddr string `gorm:"type:VARCHAR(100);uniqueIndex:idx_allowlist_member;not null" json:"contract_address"`
+	WalletAddr   string `gorm:"type:VARCHAR(100);uniqueIndex:idx_allowlist_member;not null;default:''" json:"wallet_address"` // 按钱包加入，否则为空
+	UserID       uint64 `gorm:"uniqueIndex:idx_allowlist_member;not null;default:0" json:"user_id"`                           // 按用户加入，否则为 0
+	Email        string `gorm:"type:VARCHAR(50);not null;default:''" json:"email"`                                            // 上传时的邮箱，只用于展示
+	CreateTime   int64  `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// TableName 指定 VoteAllowlistEntry 结构体对应的表名
+func (VoteAllowlistEntry) TableName() string {
+	return "vote_allowlist_entries"
+}
+
+// SaveVoteAllowlist 写入投票的名单，replace 为 true 时先清空原有名单，已存在的成员会被跳过
+func SaveVoteAllowlist(db *gorm.DB, contractAddr string, entries []VoteAllowlistEntry, replace bool) error {
+	contractAddr = utils.NormalizeHex(contractAddr)
+	for i := range entries {
+		entries[i].ContractAddr = contractAddr
+		entries[i].WalletAddr = utils.NormalizeHex(entries[i].WalletAddr)
+	}
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			err := tx.Where("contract_addr = ?", contractAddr).Delete(&VoteAllowlistEntry{}).Error
+			if err != nil {
+				return errors.Wrapf(err, "failed to clear vote allowlist")
+			}
+		}
+		if len(entries) > 0 {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&entries, 500).Error
+			if err != nil {
+				return errors.Wrapf(err, "failed to insert vote allowlist entries")
+			}
+		}
+		var count int64
+		err := tx.Model(&VoteAllowlistEntry{}).Where("contract_addr = ?", contractAddr).Count(&count).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to count vote allowlist entries")
+		}
+		if count > MaxVoteAllowlistEntries {
+			return errors.Errorf("Allowlist can have at most %d members", MaxVoteAllowlistEntries)
+		}
+		return nil
+	})
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to save vote allowlist")
+	}
+	return nil
+}
+
+func ListVoteAllowlist(db *gorm.DB, contractAddr string) ([]VoteAllowlistEntry, error) {
+	var entries []VoteAllowlistEntry
+	err := db.Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).Order("id asc").Find(&entries).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list vote allowlist")
+	}
+	return entries, nil
+}
+
+// HasVoteAllowlist 投票是否设置了名单
+func HasVoteAllowlist(db *gorm.DB, contractAddr string) (bool, error) {
+	var count int64
+	err := db.Model(&VoteAllowlistEntry{}).Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).Limit(1).Count(&count).Error
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to check vote allowlist")
+	}
+	return count > 0, nil
+}
+
+// IsWalletAllowlisted 判断钱包本身、或者钱包所属的用户是否在名单中
+func IsWalletAllowlisted(db *gorm.DB, contractAddr, walletAddr string) (bool, error) {
+	allowed, _, err := GetWalletAllowlistMember(db, contractAddr, walletAddr)
+	return allowed, err
+}
+
+// GetWalletAllowlistMember 判断钱包是否在名单中；钱包所属的用户按用户加入名单时同时返回用户 ID，否则为 0
+// 按用户加入的成员，用户的全部钱包共用一个成员资格，只能投一票
+func GetWalletAllowlistMember(db *gorm.DB, contractAddr, walletAddr string) (bool, uint64, error) {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	st := db.Model(&VoteAllowlistEntry{}).Where("contract_addr = ?", utils.NormalizeHex(contractAddr))
+	user, err := LookupUserCached(db, walletAddr)
+	if err != nil {
+		return false, 0, err
+	}
+	if user != nil {
+		st = st.Where("(wallet_addr = ? OR user_id = ?)", walletAddr, user.ID)
+	} else {
+		st = st.Where("wallet_addr = ?", walletAddr)
+	}
+	var userIDs []uint64
+	if err := st.Pluck("user_id", &userIDs).Error; err != nil {
+		return false, 0, errors.Wrapf(err, "failed to check vote allowlist")
+	}
+	for _, userID := range userIDs {
+		if userID != 0 {
+			return true, userID, nil
+		}
+	}
+	return len(userIDs) > 0, 0, nil
+}
+
+// BatchGetVerifiedUsersByEmails 按已验证的邮箱批量查询用户，返回 小写邮箱 -> 用户
+// 未验证的邮箱可能被他人抢先填写，不能用来识别成员
+func BatchGetVerifiedUsersByEmails(db *gorm.DB, emails []string) (map[string]*User, error) {
+	res := make(map[string]*User)
+	if len(emails) == 0 {
+		return res, nil
+	}
+	var users []User
+	err := db.Where("email IN ? AND email_verified = ? AND status = ?", emails, true, UserStatusActive).Find(&users).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query users by emails")
+	}
+	for i := range users {
+		res[strings.ToLower(users[i].Email)] = &users[i]
+	}
+	return res, nil
+}
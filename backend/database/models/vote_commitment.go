@@ -0,0 +1,93 @@
+package models
+
+import (
+	"backend/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// VoteCommitment 结构体对应 vote_commitments 表，是 commit-reveal 投票链上承诺的索引
+// 只保存承诺的哈希，选项与 salt 由投票人自己保存，后端不知道未揭示的选择
+type VoteCommitment struct {
+	ID           uint64 `gorm:"primaryKey" json:"id"`
+	ContractAddr string `gorm:"type:VARCHAR(100);uniqueIndex:idx_commitment_vote_wallet;not null" json:"contract_address"`
+	WalletAddr   string `gorm:"type:VARCHAR(100);uniqueIndex:idx_commitment_vote_wallet;index;not null" json:"wallet_address"`
+	Commitment   string `gorm:"type:VARCHAR(100);not null" json:"commitment"`
+	Revealed     bool   `gorm:"not null;default:false" json:"revealed"`
+	RemindTime   int64  `gorm:"not null;default:0" json:"remind_time"` // 最近一次提醒揭示的时间，0 表示未提醒
+	SyncTime     int64  `gorm:"not null;default:0" json:"sync_time"`
+}
+
+// TableName 指定 VoteCommitment 结构体对应的表名
+func (VoteCommitment) TableName() string {
+	return "vote_commitments"
+}
+
+// UpsertVoteCommitments 按 (投票, 钱包) 写入或更新承诺，不会覆盖提醒时间
+func UpsertVoteCommitments(db *gorm.DB, commitments []VoteCommitment) error {
+	if len(commitments) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	for i := range commitments {
+		commitments[i].ContractAddr = utils.NormalizeHex(commitments[i].ContractAddr)
+		commitments[i].WalletAddr = utils.NormalizeHex(commitments[i].WalletAddr)
+		commitments[i].SyncTime = now
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "contract_addr"}, {Name: "wallet_addr"}},
+		DoUpdates: clause.AssignmentColumns([]string{"commitment", "revealed", "sync_time"}),
+	}).Create(&commitments).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to upsert vote commitments")
+	}
+	return nil
+}
+
+func GetVoteCommitment(db *gorm.DB, contractAddr, walletAddr string) (*VoteCommitment, error) {
+	var commitment VoteCommitment
+	err := db.Where("contract_addr = ? AND wallet_addr = ?", utils.NormalizeHex(contractAddr), utils.NormalizeHex(walletAddr)).
+		First(&commitment).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get vote commitment")
+	}
+	return &commitment, nil
+}
+
+// CountVoteCommitments 返回投票的承诺数与已揭示数
+func CountVoteCommitments(db *gorm.DB, contractAddr string) (int64, int64, error) {
+	var res struct {
+		Committed int64
+		Revealed  int64
+	}
+	err := db.Model(&VoteCommitment{}).Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).
+		Select("COUNT(*) AS committed, COALESCE(SUM(revealed), 0) AS revealed").Scan(&res).Error
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to count vote commitments")
+	}
+	return res.Committed, res.Revealed, nil
+}
+
+// ListUnremindedCommitments 列出尚未揭示、也还没有提醒过的承诺
+func ListUnremindedCommitments(db *gorm.DB, contractAddr string) ([]VoteCommitment, error) {
+	var commitments []VoteCommitment
+	err := db.Where("contract_addr = ? AND revealed = ? AND remind_time = 0", utils.NormalizeHex(contractAddr), false).
+		Find(&commitments).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list unreminded commitments")
+	}
+	return commitments, nil
+}
+
+func MarkCommitmentsReminded(db *gorm.DB, ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := db.Model(&VoteCommitment{}).Where("id IN ?", ids).Update("remind_time", time.Now().Unix()).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to mark commitments reminded")
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"backend/tally"
+	"backend/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const (
+	VoteOptionTypeCandidate = 0 // 对应 Voting 合约中的 OptionType.Candidate
+	VoteOptionTypeRawText   = 1 // 对应 Voting 合约中的 OptionType.RawText
+)
+
+const (
+	DraftStatusDraft    = "draft"    // 可以编辑
+	DraftStatusDeployed = "deployed" // 已部署并写入 votes 表，不能再编辑
+)
+
+// VoteDraft 结构体对应 vote_drafts 表，保存尚未部署的投票
+// 除 schedule 外的字段与 Voting 合约的构造参数一一对应
+type VoteDraft struct {
+	ID                    uint64   `gorm:"primaryKey" json:"id"`
+	OwnerAddr             string   `gorm:"type:VARCHAR(100);index;not null" json:"owner_address"`
+	Title                 string   `gorm:"type:VARCHAR(255);not null" json:"title"`
+	Description           string   `gorm:"type:TEXT" json:"description"`
+	OptionType            int      `gorm:"not null;default:0" json:"option_type"`
+	NeedRegistration      bool     `gorm:"not null;default:false" json:"need_registration"`
+	CandidateNeedApproval bool     `gorm:"not null;default:false" json:"candidate_need_approval"`
+	CommitReveal          bool     `gorm:"not null;default:false" json:"commit_reveal"`
+	Gasless               bool     `gorm:"not null;default:false" json:"gasless"`
+	RawTextOptions        []string `gorm:"type:TEXT;serializer:json" json:"raw_text_options"`
+	// 计划时间只保存在后端，合约的状态仍然需要 owner 手动推进，0 表示未设置
+	RegistrationStartTime int64 `gorm:"not null;default:0" json:"registration_start_time"`
+	VotingStartTime       int64 `gorm:"not null;default:0" json:"voting_start_time"`
+	VotingEndTime         int64 `gorm:"not null;default:0" json:"voting_end_time"`
+	// 计票规则只保存在后端，部署时写入 votes 表
+	TallyConfig  tally.Config `gorm:"type:TEXT;serializer:json" json:"tally_config"`
+	Status       string       `gorm:"type:VARCHAR(20);not null;default:'draft'" json:"status"`
+	ContractAddr string       `gorm:"type:VARCHAR(100);not null;default:''" json:"contract_address"` // 部署后的合约地址
+	CreateTime   int64        `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime   int64        `gorm:"autoUpdateTime" json:"update_time"`
+
+	Shares []VoteDraftShare `gorm:"foreignKey:DraftID" json:"shares,omitempty"`
+}
+
+// VoteDraftShare 结构体对应 vote_draft_shares 表，被分享的 admin 可以查看与编辑草稿
+type VoteDraftShare struct {
+	ID         uint64 `gorm:"primaryKey" json:"id"`
+	DraftID    uint64 `gorm:"uniqueIndex:idx_draft_wallet;not null" json:"draft_id"`
+	WalletAddr string `gorm:"type:VARCHAR(100);uniqueIndex:idx_draft_wallet;not null" json:"wallet_address"`
+	CreateTime int64  `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// TableName 指定 VoteDraft 结构体对应的表名
+func (VoteDraft) TableName() string {
+	return "vote_drafts"
+}
+
+// TableName 指定 VoteDraftShare 结构体对应的表名
+func (VoteDraftShare) TableName() string {
+	return "vote_draft_shares"
+}
+
+// CanAccess 草稿的 owner 与被分享的钱包可以访问草稿
+func (d *VoteDraft) CanAccess(walletAddr string) bool {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	if d.OwnerAddr == walletAddr {
+		return true
+	}
+	for _, share := range d.Shares {
+		if share.WalletAddr == walletAddr {
+			return true
+		}
+	}
+	return false
+}
+
+func InsertVoteDraft(db *gorm.DB, draft *VoteDraft) error {
+	draft.OwnerAddr = utils.NormalizeHex(draft.OwnerAddr)
+	draft.Status = DraftStatusDraft
+	err := db.Omit("Shares").Create(draft).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to insert vote draft")
+	}
+	log.Printf("Inserted new vote draft: %d", draft.ID)
+	return nil
+}
+
+func GetVoteDraftByID(db *gorm.DB, id uint64) (*VoteDraft, error) {
+	var draft VoteDraft
+	err := db.Preload("Shares").Where("id = ?", id).First(&draft).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get vote draft")
+	}
+	return &draft, nil
+}
+
+// ListVoteDraftsByWalletAddr 查询钱包创建的以及分享给它的草稿，最近修改的在前
+func ListVoteDraftsByWalletAddr(db *gorm.DB, walletAddr string, status string) ([]VoteDraft, error) {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	st := db.Preload("Shares").
+		Where("owner_addr = ? OR id IN (?)", walletAddr,
+			db.Model(&VoteDraftShare{}).Select("draft_id").Where("wallet_addr = ?", walletAddr))
+	if status != "" {
+		st = st.Where("status = ?", status)
+	}
+	var drafts []VoteDraft
+	err := st.Order("update_time desc").Find(&drafts).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list vote drafts")
+	}
+	return drafts, nil
+}
+
+// UpdateVoteDraft 保存草稿的可编辑字段，只有 draft 状态的草稿可以修改
+func UpdateVoteDraft(db *gorm.DB, draft *VoteDraft) error {
+	res := db.Model(&VoteDraft{}).Where("id = ? AND status = ?", draft.ID, DraftStatusDraft).
+		Select("title", "description", "option_type", "need_registration", "candidate_need_approval", "commit_reveal", "gasless",
+			"raw_text_options", "registration_start_time", "voting_start_time", "voting_end_time", "tally_config", "update_time").
+		Updates(&VoteDraft{
+			Title:                 draft.Title,
+			Description:           draft.Description,
+			OptionType:            draft.OptionType,
+			NeedRegistration:      draft.NeedRegistration,
+			CandidateNeedApproval: draft.CandidateNeedApproval,
+			CommitReveal:          draft.CommitReveal,
+			Gasless:               draft.Gasless,
+			RawTextOptions:        draft.RawTextOptions,
+			RegistrationStartTime: draft.RegistrationStartTime,
+			VotingStartTime:       draft.VotingStartTime,
+			VotingEndTime:         draft.VotingEndTime,
+			TallyConfig:           draft.TallyConfig,
+			UpdateTime:            time.Now().Unix(),
+		})
+	if res.Error != nil {
+		return errors.Wrapf(res.Error, "failed to update vote draft")
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("vote draft is not editable")
+	}
+	return nil
+}
+
+func DeleteVoteDraft(db *gorm.DB, id uint64) error {
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND status = ?", id, DraftStatusDraft).Delete(&VoteDraft{})
+		if res.Error != nil {
+			return errors.Wrapf(res.Error, "failed to delete vote draft")
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("vote draft is not deletable")
+		}
+		err := tx.Where("draft_id = ?", id).Delete(&VoteDraftShare{}).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete vote draft shares")
+		}
+		return nil
+	})
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to delete vote draft")
+	}
+	return nil
+}
+
+func ShareVoteDraft(db *gorm.DB, draftID uint64, walletAddr string) error {
+	err := db.Create(&VoteDraftShare{DraftID: draftID, WalletAddr: utils.NormalizeHex(walletAddr)}).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to share vote draft, it may have been shared already")
+	}
+	return nil
+}
+
+func UnshareVoteDraft(db *gorm.DB, draftID uint64, walletAddr string) (bool, error) {
+	res := db.Where("draft_id = ? AND wallet_addr = ?", draftID, utils.NormalizeHex(walletAddr)).Delete(&VoteDraftShare{})
+	if res.Error != nil {
+		return false, errors.Wrapf(res.Error, "failed to unshare vote draft")
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// MarkVoteDraftDeployed 部署确认后，把草稿写入 votes 表并标记为已部署
+func MarkVoteDraftDeployed(db *gorm.DB, draft *VoteDraft, vote *Vote) error {
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&VoteDraft{}).Where("id = ? AND status = ?", draft.ID, DraftStatusDraft).
+			Updates(map[string]interface{}{
+				"status":        DraftStatusDeployed,
+				"contract_addr": utils.NormalizeHex(vote.ContractAddr),
+				"update_time":   time.Now().Unix(),
+			})
+		if res.Error != nil {
+			return errors.Wrapf(res.Error, "failed to update vote draft")
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("vote draft has already been deployed")
+		}
+		return InsertVote(tx, vote)
+	})
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to mark vote draft deployed")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"backend/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"math/big"
+)
+
+const (
+	TokenStandardERC20  = "erc20"
+	TokenStandardERC721 = "erc721"
+)
+
+const (
+	EligibilityMatchAll = "all" // 必须满足全部规则
+	EligibilityMatchAny = "any" // 满足任意一条规则即可
+)
+
+// MaxEligibilityRules 每个投票最多的规则数，每条规则在检查时都是一次 balanceOf 调用
+const MaxEligibilityRules = 10
+
+// EligibilityRule 要求钱包在快照区块持有至少 MinBalance 的代币
+type EligibilityRule struct {
+	Standard  string `json:"standard"`
+	TokenAddr string `json:"token_address"`
+	// 十进制整数，使用代币的最小单位（ERC-20 不考虑 decimals），为空表示 1
+	MinBalance string `json:"min_balance"`
+}
+
+// MinBalanceInt 返回最小持有量，Validate 之后调用不会出错
+func (r *EligibilityRule) MinBalanceInt() (*big.Int, error) {
+	if r.MinBalance == "" {
+		return big.NewInt(1), nil
+	}
+	n, ok := new(big.Int).SetString(r.MinBalance, 10)
+	if !ok || n.Sign() <= 0 {
+		return nil, errors.Errorf("Invalid min balance %q", r.MinBalance)
+	}
+	return n, nil
+}
+
+// Eligibility 投票的资格规则，保存在 votes 表中，没有规则时任何人都可以登记与投票
+type Eligibility struct {
+	SnapshotBlock uint64            `json:"snapshot_block"` // 按该区块的余额判断，之后的转账不影响资格
+	Match         string            `json:"match"`          // all 或 any，为空表示 all
+	Rules         []EligibilityRule `json:"rules"`
+}
+
+// Enabled 是否设置了资格规则
+func (e *Eligibility) Enabled() bool {
+	return len(e.Rules) > 0
+}
+
+// MatchAny 是否满足任意一条规则即可
+func (e *Eligibility) MatchAny() bool {
+	return e.Match == EligibilityMatchAny
+}
+
+// Validate 检查规则是否合法，并规范化代币地址
+func (e *Eligibility) Validate() error {
+	if !e.Enabled() {
+		return nil
+	}
+	if len(e.Rules) > MaxEligibilityRules {
+		return errors.Errorf("At most %d eligibility rules", MaxEligibilityRules)
+	}
+	if e.Match != "" && e.Match != EligibilityMatchAll && e.Match != EligibilityMatchAny {
+		return errors.Errorf("Unknown match mode %q", e.Match)
+	}
+	if e.SnapshotBlock == 0 {
+		return errors.New("Snapshot block is required")
+	}
+	for i := range e.Rules {
+		rule := &e.Rules[i]
+		if rule.Standard != TokenStandardERC20 && rule.Standard != TokenStandardERC721 {
+			return errors.Errorf("Unknown token standard %q", rule.Standard)
+		}
+		if !common.IsHexAddress(rule.TokenAddr) {
+			return errors.Errorf("Invalid token address %q", rule.TokenAddr)
+		}
+		rule.TokenAddr = utils.NormalizeHex(rule.TokenAddr)
+		if _, err := rule.MinBalanceInt(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func SetVoteEligibility(db *gorm.DB, contractAddr string, eligibility *Eligibility) error {
+	err := db.Model(&Vote{}).Where("contract_addr = ?", utils.NormalizeHex(contractAddr)).
+		Select("eligibility").Updates(&Vote{Eligibility: *eligibility}).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to set vote eligibility")
+	}
+	return nil
+}
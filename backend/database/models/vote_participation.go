@@ -0,0 +1,112 @@
+package models
+
+import (
+	"backend/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const (
+	ParticipationRoleVoter            = "voter"             // 对应 Voting 合约中的 UserVoteRoleVoter
+	ParticipationRoleCandidate        = "candidate"         // 对应 Voting 合约中的 UserVoteRoleCandidate
+	ParticipationRolePendingCandidate = "pending_candidate" // 对应 Voting 合约中的 UserVoteRolePendingCandidate
+)
+
+// VoteParticipation 结构体对应 vote_participations 表，是链上投票 NFT 的索引，每个 token 一条
+type VoteParticipation struct {
+	ID           uint64 `gorm:"primaryKey" json:"id"`
+	TokenID      uint64 `gorm:"uniqueIndex;not null" json:"token_id"`
+	ContractAddr string `gorm:"type:VARCHAR(100);index;not null" json:"contract_address"`
+	WalletAddr   string `gorm:"type:VARCHAR(100);index;not null" json:"wallet_address"` // token 的持有者
+	Role         string `gorm:"type:VARCHAR(20);not null" json:"role"`
+	ChosenOption int64  `gorm:"not null;default:0" json:"option"` // 从 1 开始，0 表示尚未投票
+	SyncTime     int64  `gorm:"not null;default:0" json:"sync_time"`
+}
+
+// TableName 指定 VoteParticipation 结构体对应的表名
+func (VoteParticipation) TableName() string {
+	return "vote_participations"
+}
+
+// UpsertVoteParticipations 按 token id 写入或更新索引
+func UpsertVoteParticipations(db *gorm.DB, participations []VoteParticipation) error {
+	if len(participations) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	for i := range participations {
+		participations[i].ContractAddr = utils.NormalizeHex(participations[i].ContractAddr)
+		participations[i].WalletAddr = utils.NormalizeHex(participations[i].WalletAddr)
+		participations[i].SyncTime = now
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"contract_addr", "wallet_addr", "role", "chosen_option", "sync_time"}),
+	}).Create(&participations).Error
+	if err != nil {
+		return errors.Wrapf(err, "failed to upsert vote participations")
+	}
+	return nil
+}
+
+// ParticipatedVote 用户参与的投票，附带用户在其中的 token、角色与选择
+type ParticipatedVote struct {
+	Vote
+	TokenID      uint64 `json:"token_id"`
+	Role         string `json:"role"`
+	ChosenOption int64  `json:"option"`
+}
+
+// MyVoteQuery 查询用户参与的投票
+type MyVoteQuery struct {
+	WalletAddrs []string // 用户的全部钱包
+	Roles       []string // 为空则不过滤
+	NeedsVote   bool     // 只返回需要用户操作的：正在投票且尚未投票（或提交承诺）的，以及揭示阶段尚未揭示的
+}
+
+func (q *MyVoteQuery) apply(db *gorm.DB) *gorm.DB {
+	walletAddrs := make([]string, 0, len(q.WalletAddrs))
+	for _, walletAddr := range q.WalletAddrs {
+		walletAddrs = append(walletAddrs, utils.NormalizeHex(walletAddr))
+	}
+	// 被移除的投票只有 owner 可以看到
+	st := db.Table("vote_participations AS p").
+		Joins("JOIN votes ON votes.contract_addr = p.contract_addr").
+		Where("p.wallet_addr IN ?", walletAddrs).
+		Where("(votes.visibility <> ? OR votes.owner_addr IN ?)", VoteVisibilityRemoved, walletAddrs)
+	if len(q.Roles) > 0 {
+		st = st.Where("p.role IN ?", q.Roles)
+	}
+	if q.NeedsVote {
+		// Where 会修改同一个 *gorm.DB，两个子查询必须分别构建
+		commitments := func() *gorm.DB {
+			return db.Session(&gorm.Session{NewDB: true}).Table("vote_commitments AS c").
+				Select("1").Where("c.contract_addr = p.contract_addr AND c.wallet_addr = p.wallet_addr")
+		}
+		committedAny := commitments()
+		committedUnrevealed := commitments().Where("c.revealed = ?", false)
+		st = st.Where("p.role = ? AND p.chosen_option = 0", ParticipationRoleVoter).
+			Where("(votes.state = ? AND NOT EXISTS (?)) OR (votes.state = ? AND EXISTS (?))",
+				VoteStateVoting, committedAny, VoteStateReveal, committedUnrevealed)
+	}
+	return st
+}
+
+// PageQueryMyVotes 分页查询用户参与的投票，最近获得 token 的在前
+func PageQueryMyVotes(db *gorm.DB, q *MyVoteQuery, page, pageSize int) ([]ParticipatedVote, int64, error) {
+	var count int64
+	err := q.apply(db).Count(&count).Error
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to count participated votes")
+	}
+
+	var votes []ParticipatedVote
+	err = q.apply(db).Select("votes.*, p.token_id, p.role, p.chosen_option").
+		Order("p.token_id desc").Offset((page - 1) * pageSize).Limit(pageSize).Scan(&votes).Error
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to query participated votes")
+	}
+	return votes, count, nil
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"backend/utils"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	VoteSortNewest  = "newest"  // create_time desc
+	VoteSortTurnout = "turnout" // turnout desc，相同时较新的在前
+)
+
+// VoteQuery 投票列表的查询条件，零值表示不过滤
+type VoteQuery struct {
+	Owner            string
+	Visibilities     []string
+	States           []int
+	OptionType       *int
+	NeedRegistration *bool
+	CreatedFrom      int64 // create_time >= CreatedFrom
+	CreatedTo        int64 // create_time < CreatedTo
+	// 参与情况筛选：Participated 非 nil 时，true 只返回 ParticipantWallets 持有 token 的投票，false 排除这些投票
+	Participated       *bool
+	ParticipantWallets []string
+	Keyword            string // 在缓存的标题与描述中搜索
+	Sort               string // newest 或 turnout，为空时为 newest
+}
+
+// VoteCursor 游标分页的位置，记录上一页最后一条的排序键
+// 以 (排序字段, id) 作为键，翻页期间新增的投票不会导致重复或遗漏
+type VoteCursor struct {
+	Sort       string `json:"s"`
+	Turnout    int    `json:"t,omitempty"`
+	CreateTime int64  `json:"c"`
+	ID         uint64 `json:"i"`
+}
+
+// Encode 将游标编码为不透明的字符串
+func (c *VoteCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeVoteCursor(s string) (*VoteCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor VoteCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+func voteCursorOf(v *Vote, sort string) *VoteCursor {
+	return &VoteCursor{Sort: sort, Turnout: v.Turnout, CreateTime: v.CreateTime, ID: v.ID}
+}
+
+// IsVoteSort 判断是否为合法的排序方式
+func IsVoteSort(sort string) bool {
+	return sort == "" || sort == VoteSortNewest || sort == VoteSortTurnout
+}
+
+func (q *VoteQuery) sort() string {
+	if q.Sort == "" {
+		return VoteSortNewest
+	}
+	return q.Sort
+}
+
+// apply 添加过滤条件，不包括排序与分页
+func (q *VoteQuery) apply(st *gorm.DB) *gorm.DB {
+	if q.Owner != "" {
+		st = st.Where("owner_addr = ?", utils.NormalizeHex(q.Owner))
+	}
+	if len(q.Visibilities) > 0 {
+		st = st.Where("visibility IN ?", q.Visibilities)
+	}
+	if len(q.States) > 0 {
+		st = st.Where("state IN ?", q.States)
+	}
+	if q.OptionType != nil {
+		st = st.Where("option_type = ?", *q.OptionType)
+	}
+	if q.NeedRegistration != nil {
+		st = st.Where("need_registration = ?", *q.NeedRegistration)
+	}
+	if q.CreatedFrom > 0 {
+		st = st.Where("create_time >= ?", q.CreatedFrom)
+	}
+	if q.CreatedTo > 0 {
+		st = st.Where("create_time < ?", q.CreatedTo)
+	}
+	if q.Participated != nil {
+		walletAddrs := make([]string, 0, len(q.ParticipantWallets))
+		for _, walletAddr := range q.ParticipantWallets {
+			walletAddrs = append(walletAddrs, utils.NormalizeHex(walletAddr))
+		}
+		participated := st.Session(&gorm.Session{NewDB: true}).Model(&VoteParticipation{}).
+			Select("contract_addr").Where("wallet_addr IN ?", walletAddrs)
+		if *q.Participated {
+			st = st.Where("contract_addr IN (?)", participated)
+		} else {
+			st = st.Where("contract_addr NOT IN (?)", participated)
+		}
+	}
+	if q.Keyword != "" {
+		pattern := "%" + escapeLike(q.Keyword) + "%"
+		st = st.Where("(title LIKE ? OR description LIKE ?)", pattern, pattern)
+	}
+	return st
+}
+
+func (q *VoteQuery) order(st *gorm.DB) *gorm.DB {
+	if q.sort() == VoteSortTurnout {
+		return st.Order("turnout desc").Order("create_time desc").Order("id desc")
+	}
+	return st.Order("create_time desc").Order("id desc")
+}
+
+// PageQueryVotes 按页码分页查询投票，page 从 1 开始
+func PageQueryVotes(db *gorm.DB, q *VoteQuery, page, pageSize int) ([]Vote, error) {
+	var votes []Vote
+	err := q.order(q.apply(db.Model(&Vote{}))).Offset((page - 1) * pageSize).Limit(pageSize).Find(&votes).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query votes")
+	}
+	return votes, nil
+}
+
+// CursorQueryVotes 按游标分页查询投票，cursor 为 nil 表示第一页
+// 返回本页的投票与下一页的游标，没有更多数据时游标为 nil
+// 按 turnout 排序时，翻页期间票数被刷新的投票可能移动到已翻过的位置
+func CursorQueryVotes(db *gorm.DB, q *VoteQuery, cursor *VoteCursor, pageSize int) ([]Vote, *VoteCursor, error) {
+	sort := q.sort()
+	st := q.apply(db.Model(&Vote{}))
+	if cursor != nil {
+		if cursor.Sort != sort {
+			return nil, nil, errors.New("cursor does not match the sort")
+		}
+		if sort == VoteSortTurnout {
+			st = st.Where("(turnout < ? OR (turnout = ? AND (create_time < ? OR (create_time = ? AND id < ?))))",
+				cursor.Turnout, cursor.Turnout, cursor.CreateTime, cursor.CreateTime, cursor.ID)
+		} else {
+			st = st.Where("(create_time < ? OR (create_time = ? AND id < ?))",
+				cursor.CreateTime, cursor.CreateTime, cursor.ID)
+		}
+	}
+
+	// 多取一条用于判断是否还有下一页
+	var votes []Vote
+	err := q.order(st).Limit(pageSize + 1).Find(&votes).Error
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to query votes")
+	}
+	if len(votes) <= pageSize {
+		return votes, nil, nil
+	}
+	votes = votes[:pageSize]
+	return votes, voteCursorOf(&votes[pageSize-1], sort), nil
+}
+
+func CountVotes(db *gorm.DB, q *VoteQuery) (int64, error) {
+	var count int64
+	err := q.apply(db.Model(&Vote{})).Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to count votes")
+	}
+	return count, nil
+}
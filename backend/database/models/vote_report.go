@@ -0,0 +1,125 @@
+package models
+
+import (
+	"backend/utils"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const (
+	ReportReasonSpam  = "spam"
+	ReportReasonAbuse = "abuse"
+	ReportReasonTest  = "test" // 测试投票，不应出现在公开列表中
+	ReportReasonOther = "other"
+)
+
+const (
+	ReportStatusOpen      = "open"      // 等待处理
+	ReportStatusResolved  = "resolved"  // 已处理，通常伴随可见性的修改
+	ReportStatusDismissed = "dismissed" // 举报不成立
+)
+
+// VoteReport 结构体对应 vote_reports 表，用户对投票的举报
+type VoteReport struct {
+	ID           uint64 `gorm:"primaryKey" json:"id"`
+	ContractAddr string `gorm:"type:VARCHAR(100);index;not null" json:"contract_address"`
+	ReporterAddr string `gorm:"type:VARCHAR(100);index;not null" json:"reporter_address"` // 举报人的主钱包
+	Reason       string `gorm:"type:VARCHAR(20);not null" json:"reason"`
+	Detail       string `gorm:"type:VARCHAR(1024);not null;default:''" json:"detail"`
+	Status       string `gorm:"type:VARCHAR(20);index;not null" json:"status"`
+	ResolverAddr string `gorm:"type:VARCHAR(100);not null;default:''" json:"resolver_address"`
+	ResolveNote  string `gorm:"type:VARCHAR(1024);not null;default:''" json:"resolve_note"`
+	CreateTime   int64  `gorm:"autoCreateTime" json:"create_time"`
+	ResolveTime  int64  `gorm:"not null;default:0" json:"resolve_time"`
+}
+
+// TableName 指定 VoteReport 结构体对应的表名
+func (VoteReport) TableName() string {
+	return "vote_reports"
+}
+
+// IsReportReason 判断是否为合法的举报原因
+func IsReportReason(reason string) bool {
+	switch reason {
+	case ReportReasonSpam, ReportReasonAbuse, ReportReasonTest, ReportReasonOther:
+		return true
+	default:
+		return false
+	}
+}
+
+// InsertVoteReport 创建举报，同一个用户对同一个投票最多只有一条未处理的举报
+func InsertVoteReport(db *gorm.DB, report *VoteReport) error {
+	report.ContractAddr = utils.NormalizeHex(report.ContractAddr)
+	report.ReporterAddr = utils.NormalizeHex(report.ReporterAddr)
+	report.Status = ReportStatusOpen
+	outerErr := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&VoteReport{}).
+			Where("contract_addr = ? AND reporter_addr = ? AND status = ?", report.ContractAddr, report.ReporterAddr, ReportStatusOpen).
+			Count(&count).Error
+		if err != nil {
+			return errors.Wrapf(err, "failed to count open reports")
+		}
+		if count > 0 {
+			return errors.New("you have already reported this vote")
+		}
+		return tx.Create(report).Error
+	})
+	if outerErr != nil {
+		return errors.Wrapf(outerErr, "failed to insert vote report")
+	}
+	log.Printf("Inserted new vote report: %d", report.ID)
+	return nil
+}
+
+func GetVoteReportByID(db *gorm.DB, id uint64) (*VoteReport, error) {
+	var report VoteReport
+	err := db.Where("id = ?", id).First(&report).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get vote report")
+	}
+	return &report, nil
+}
+
+// PageQueryVoteReports 分页查询举报，最早的在前，status 与 contractAddr 为空则不过滤
+func PageQueryVoteReports(db *gorm.DB, page, pageSize int, status, contractAddr string) ([]VoteReport, int64, error) {
+	st := db.Model(&VoteReport{})
+	if status != "" {
+		st = st.Where("status = ?", status)
+	}
+	if contractAddr != "" {
+		st = st.Where("contract_addr = ?", utils.NormalizeHex(contractAddr))
+	}
+
+	var count int64
+	err := st.Count(&count).Error
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to count vote reports")
+	}
+
+	var reports []VoteReport
+	err = st.Order("create_time asc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&reports).Error
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to query vote reports")
+	}
+	return reports, count, nil
+}
+
+// CloseVoteReports 处理同一个投票下所有未处理的举报，返回处理的数量
+func CloseVoteReports(db *gorm.DB, contractAddr, status, resolverAddr, note string) (int64, error) {
+	res := db.Model(&VoteReport{}).
+		Where("contract_addr = ? AND status = ?", utils.NormalizeHex(contractAddr), ReportStatusOpen).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"resolver_addr": utils.NormalizeHex(resolverAddr),
+			"resolve_note":  note,
+			"resolve_time":  time.Now().Unix(),
+		})
+	if res.Error != nil {
+		return 0, errors.Wrapf(res.Error, "failed to close vote reports")
+	}
+	return res.RowsAffected, nil
+}
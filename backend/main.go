@@ -1,7 +1,9 @@
 package main
 
 import (
+	"backend/biz/vote"
 	"backend/config"
+	"backend/database"
 	"backend/database/models"
 	"backend/middlewares"
 	"backend/routers"
@@ -13,7 +15,19 @@ import (
 )
 
 func main() {
+	// 已初始化的系统在启动时补齐新增的表和字段
+	if config.Initialized() {
+		if err := database.Migrate(); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		vote.StartMetadataSync(time.Duration(config.G.Blockchain.VoteMetaSyncSec) * time.Second)
+		vote.StartRevealReminders(time.Duration(config.G.Email.RevealRemindSec) * time.Second)
+	}
+
 	r := gin.Default()
+	if err := r.SetTrustedProxies(config.G.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{config.G.Server.CORSHost}, // 允许前端的 URL
@@ -23,6 +37,9 @@ func main() {
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour, // 12小时内不需要重复请求 CORS
 	}))
+	r.Use(middlewares.RateLimitWrites("write", config.G.RateLimit.Write))
+	authLimit := middlewares.RateLimit("auth", config.G.RateLimit.Auth)
+	readLimit := middlewares.RateLimit("read", config.G.RateLimit.Read)
 
 	// System Initialization
 	r.GET("/init", routers.CheckInitStatus)          // Check if the system is initialized
@@ -30,26 +47,121 @@ func main() {
 	r.POST("/init-exec", routers.InitRootUser)       // Execute the transaction to deploy NFT contract
 
 	// Auth
-	r.GET("/auth/state", routers.GetUserState)                                               // Get current user state
-	r.POST("/auth/info", routers.BatchGetUserInfo)                                           // Get user info by wallet address
-	r.POST("/auth/gen", routers.GenAuthChallenge)                                            // Generate a challenge for user to sign
-	r.POST("/auth/verify", routers.VerifyAuthChallenge)                                      // Verify the signature and generate JWT token
-	r.POST("/auth/register", middlewares.RequireRole(models.RoleVoid), routers.RegisterUser) // Create an account for specified wallet address
-	r.POST("/auth/update", middlewares.RequireRole(models.RoleUser), routers.UpdateUserInfo) // Update user info
+	r.GET("/auth/state", routers.GetUserState)                                                           // Get current user state
+	r.POST("/auth/info", authLimit, routers.BatchGetUserInfo)                                            // Get user info by wallet address
+	r.POST("/auth/gen", authLimit, routers.GenAuthChallenge)                                             // Generate a challenge for user to sign
+	r.POST("/auth/verify", authLimit, routers.VerifyAuthChallenge)                                       // Verify the signature and generate JWT token
+	r.POST("/auth/register", authLimit, middlewares.RequirePermission(), routers.RegisterUser)           // Create an account for specified wallet address
+	r.POST("/auth/update", middlewares.RequirePermission(models.PermSelfManage), routers.UpdateUserInfo) // Update user info
+
+	// Account
+	r.GET("/auth/export", middlewares.RequirePermission(models.PermSelfManage), routers.ExportMyData)        // Export personal data as a JSON archive
+	r.DELETE("/auth/account", middlewares.RequirePermission(models.PermSelfManage), routers.DeleteMyAccount) // Delete current account, DB record is anonymized
+
+	// Profile
+	r.POST("/auth/avatar", middlewares.RequirePermission(models.PermSelfManage), routers.UploadAvatar)   // Upload avatar, thumbnail is generated
+	r.DELETE("/auth/avatar", middlewares.RequirePermission(models.PermSelfManage), routers.DeleteAvatar) // Delete avatar
+	r.GET("/files/*key", routers.GetFile)                                                                // Get uploaded files such as avatars
+
+	// Email verification
+	r.POST("/auth/email/send", middlewares.RequirePermission(models.PermSelfManage), routers.SendEmailVerification)     // Send a verification email for current or new email
+	r.POST("/auth/email/verify-code", middlewares.RequirePermission(models.PermSelfManage), routers.VerifyEmailByCode)  // Verify email by the code in the email
+	r.POST("/auth/email/verify-link", authLimit, routers.VerifyEmailByToken)                                            // Verify email by the token in the link
+	r.GET("/admin/settings/email", middlewares.RequirePermission(models.PermSettingsRead), routers.GetEmailSettings)    // Get email verification settings
+	r.POST("/admin/settings/email", middlewares.RequirePermission(models.PermSettingsManage), routers.SetEmailSettings) // Require verified email for vote registration
+
+	// Name resolution
+	r.GET("/ens/resolve", readLimit, routers.ResolveName)  // Resolve a name to wallet address
+	r.GET("/ens/lookup", readLimit, routers.LookupAddress) // Lookup the name of a wallet address
+
+	// User directory
+	r.GET("/users", middlewares.RequirePermission(models.PermUserRead), routers.ListUsers)                   // Page query users with filters
+	r.POST("/users/suspend", middlewares.RequirePermission(models.PermUserSuspend), routers.SuspendUser)     // Suspend a user
+	r.POST("/users/unsuspend", middlewares.RequirePermission(models.PermUserSuspend), routers.UnsuspendUser) // Unsuspend a user
+
+	// Wallet
+	r.GET("/auth/wallets", middlewares.RequirePermission(models.PermSelfManage), routers.ListMyWallets)                    // List wallets of current user
+	r.POST("/auth/wallets/link-gen", middlewares.RequirePermission(models.PermSelfManage), routers.GenLinkWalletChallenge) // Generate a challenge for both wallets to sign
+	r.POST("/auth/wallets/link-exec", middlewares.RequirePermission(models.PermSelfManage), routers.LinkWallet)            // Verify both signatures and link the wallet
+	r.POST("/auth/wallets/unlink", middlewares.RequirePermission(models.PermSelfManage), routers.UnlinkWallet)             // Unlink a secondary wallet
+	r.POST("/auth/wallets/primary", middlewares.RequirePermission(models.PermSelfManage), routers.SetPrimaryWallet)        // Set a linked wallet as primary
+
+	// Session
+	r.GET("/auth/sessions", middlewares.RequirePermission(), routers.ListMySessions)                                          // List sessions of current wallet
+	r.DELETE("/auth/sessions/:id", middlewares.RequirePermission(), routers.RevokeMySession)                                  // Revoke a session of current wallet
+	r.GET("/admin/sessions", middlewares.RequirePermission(models.PermSessionRead), routers.ListSessionsByWallet)             // List sessions of any wallet
+	r.DELETE("/admin/sessions/:id", middlewares.RequirePermission(models.PermSessionManage), routers.RevokeSessionByID)       // Revoke any session
+	r.POST("/admin/sessions/revoke", middlewares.RequirePermission(models.PermSessionManage), routers.RevokeSessionsByWallet) // Revoke all sessions of a wallet
 
 	// Role
-	r.GET("/admin/list", middlewares.RequireRole(models.RoleRoot), routers.GetAdminList)              // Get the list of admins
-	r.POST("/admin/sync", middlewares.RequireRole(models.RoleRoot), routers.SyncAdminList)            // Sync admin list
-	r.POST("/admin/add-build", middlewares.RequireRole(models.RoleRoot), routers.GenAddAdminTx)       // Add admin gen contract
-	r.POST("/admin/add-exec", middlewares.RequireRole(models.RoleRoot), routers.AddAdmin)             // Add admin to db
-	r.POST("/admin/remove-build", middlewares.RequireRole(models.RoleRoot), routers.GenRemoveAdminTx) // Remove admin gen contract
-	r.POST("/admin/remove-exec", middlewares.RequireRole(models.RoleRoot), routers.RemoveAdmin)       // Remove admin to db
+	r.GET("/admin/list", middlewares.RequirePermission(models.PermAdminRead), routers.GetAdminList)                // Get the list of admins
+	r.POST("/admin/sync", middlewares.RequirePermission(models.PermAdminManage), routers.SyncAdminList)            // Sync admin list
+	r.POST("/admin/add-build", middlewares.RequirePermission(models.PermAdminManage), routers.GenAddAdminTx)       // Add admin gen contract
+	r.POST("/admin/add-exec", middlewares.RequirePermission(models.PermAdminManage), routers.AddAdmin)             // Add admin to db
+	r.POST("/admin/remove-build", middlewares.RequirePermission(models.PermAdminManage), routers.GenRemoveAdminTx) // Remove admin gen contract
+	r.POST("/admin/remove-exec", middlewares.RequirePermission(models.PermAdminManage), routers.RemoveAdmin)       // Remove admin to db
+	r.POST("/admin/role-set", middlewares.RequirePermission(models.PermRoleManage), routers.SetUserRole)           // Set a non-chain role such as auditor or support
+	r.GET("/admin/role-cache", middlewares.RequirePermission(models.PermAdminRead), routers.GetRoleCacheStats)     // Get hit/miss metrics of role lookup cache
+
+	// Admin change proposals
+	r.POST("/admin/proposals/create", middlewares.RequirePermission(models.PermAdminPropose), routers.CreateAdminProposal) // Propose an admin change
+	r.POST("/admin/proposals/approve", middlewares.RequirePermission(models.PermSelfManage), routers.ApproveAdminProposal) // Approve a proposal by signing it
+	r.POST("/admin/proposals/cancel", middlewares.RequirePermission(models.PermAdminPropose), routers.CancelAdminProposal) // Cancel an open proposal
+	r.POST("/admin/proposals/page", middlewares.RequirePermission(models.PermSelfManage), routers.PageQueryAdminProposals) // Page query proposals and approval history
+	r.GET("/admin/proposals/:id", middlewares.RequirePermission(models.PermSelfManage), routers.GetAdminProposal)          // Get a proposal with its approvals
+
+	// Root
+	r.GET("/admin/roots", middlewares.RequirePermission(models.PermAdminRead), routers.GetRootList)                   // Get the list of root holders
+	r.POST("/admin/root-grant-build", middlewares.RequirePermission(models.PermRootManage), routers.GenGrantRootTx)   // Grant ROOT_ROLE gen contract
+	r.POST("/admin/root-grant-exec", middlewares.RequirePermission(models.PermRootManage), routers.GrantRoot)         // Grant root in db
+	r.POST("/admin/root-revoke-build", middlewares.RequirePermission(models.PermRootManage), routers.GenRevokeRootTx) // Revoke ROOT_ROLE gen contract
+	r.POST("/admin/root-revoke-exec", middlewares.RequirePermission(models.PermRootManage), routers.RevokeRoot)       // Revoke root in db
 
 	// Vote
-	r.GET("/votes/nft-addr", routers.GetNftContractAddr)                                      // Get NFT contract address
-	r.POST("/votes/create", middlewares.RequireRole(models.RoleAdmin), routers.CreateVote)    // Create a vote in DB
-	r.POST("/votes/page", routers.PageQueryVotes)                                             // Page query votes
-	r.POST("/votes/mine", middlewares.RequireRole(models.RoleUser), routers.PageQueryMyVotes) // Page query votes
+	r.GET("/votes/nft-addr", routers.GetNftContractAddr)                                                                            // Get NFT contract address
+	r.POST("/votes/create", middlewares.RequirePermission(models.PermVoteCreate), routers.CreateVote)                               // Create a vote in DB
+	r.POST("/votes/page", routers.PageQueryVotes)                                                                                   // Page query votes
+	r.POST("/votes/register-check", middlewares.RequirePermission(models.PermSelfManage), routers.CheckVoteRegistration)            // Check if current user can register as voter or candidate
+	r.POST("/votes/mine", middlewares.RequirePermission(models.PermSelfManage), routers.PageQueryMyVotes)                           // Page query votes
+	r.GET("/votes/info/:address", routers.GetVoteInfo)                                                                              // Get a vote, removed votes are only visible to owner and moderators
+	r.POST("/votes/report", middlewares.RequirePermission(models.PermSelfManage), routers.ReportVote)                               // Report a vote to moderators
+	r.POST("/votes/sync-meta", middlewares.RequirePermission(models.PermSelfManage), routers.SyncVoteMetadata)                      // Refresh cached title, state and turnout of a vote from chain, owner or moderators only
+	r.GET("/votes/:addr/candidates", readLimit, routers.ListVoteCandidates)                                                         // List pending or approved candidates with profiles
+	r.POST("/votes/candidates/approve-build", middlewares.RequirePermission(models.PermSelfManage), routers.GenApproveCandidatesTx) // Gen the sequence of approveCandidate txs for owner
+	r.GET("/votes/:addr/results", readLimit, routers.GetVoteResults)                                                                // Tally ballots by the counting rule of the vote, leaving out ineligible wallets
+	r.POST("/votes/tally-config", middlewares.RequirePermission(models.PermSelfManage), routers.SetVoteTallyConfig)                 // Set quorum, threshold and tie break rules before voting starts
+	r.POST("/votes/commit-build", middlewares.RequirePermission(models.PermSelfManage), routers.GenCommitTx)                        // Gen the commit tx of a secret ballot, with a fresh salt when option is given
+	r.POST("/votes/reveal-build", middlewares.RequirePermission(models.PermSelfManage), routers.GenRevealTx)                        // Gen the reveal tx after checking option and salt against the commitment
+	r.GET("/votes/:addr/commitments", routers.GetVoteCommitments)                                                                   // Count committed and revealed ballots of a commit-reveal vote
+	r.GET("/votes/:addr/eligibility", readLimit, routers.GetVoteEligibility)                                                        // Check a wallet against the token-gated eligibility rules at the snapshot block
+	r.POST("/votes/eligibility", middlewares.RequirePermission(models.PermSelfManage), routers.SetVoteEligibility)                  // Set ERC-20 / ERC-721 holding rules before voting starts
+	r.POST("/votes/register-build", middlewares.RequirePermission(models.PermSelfManage), routers.GenRegisterVoterTx)               // Gen the registerVoter tx for an eligible wallet
+	r.POST("/votes/vote-build", middlewares.RequirePermission(models.PermSelfManage), routers.GenVoteTx)                            // Gen the doVote tx for an eligible wallet
+	r.POST("/votes/allowlist", middlewares.RequirePermission(models.PermSelfManage), routers.UploadVoteAllowlist)                   // Upload the CSV / JSON allowlist of wallets and member emails before voting starts
+	r.GET("/votes/:addr/allowlist", middlewares.RequirePermission(models.PermSelfManage), routers.GetVoteAllowlist)                 // List allowlisted members with their registration and voting status
+	r.GET("/votes/:addr/ballot-typed-data", routers.GetBallotTypedData)                                                             // Get the EIP-712 ballot to sign for a gasless vote
+	r.POST("/votes/ballots", routers.SubmitBallot)                                                                                  // Submit a signed gasless ballot, the signature identifies the voter
+	r.GET("/votes/:addr/ballots/proof", routers.GetBallotProof)                                                                     // Get the Merkle inclusion proof of a wallet's gasless ballot
+	r.POST("/votes/anchor-build", middlewares.RequirePermission(models.PermSelfManage), routers.GenAnchorTx)                        // Gen the tx anchoring the ballot Merkle root and tally after the vote ends
+	r.POST("/votes/anchor-exec", middlewares.RequirePermission(models.PermSelfManage), routers.AnchorVote)                          // Check the mined anchor against the ballots and tally, then record it
+	r.GET("/votes/:addr/receipt", middlewares.RequirePermission(models.PermSelfManage), routers.GetVoteReceipt)                     // Get the vote receipt of current user with a signed attestation
+	r.POST("/votes/receipt/verify", routers.VerifyVoteReceipt)                                                                      // Verify a receipt attestation against the current chain state
+
+	// 投票审核
+	r.POST("/admin/moderation/reports/page", middlewares.RequirePermission(models.PermVoteModerate), routers.PageQueryVoteReports) // Page query the report queue
+	r.POST("/admin/moderation/reports/resolve", middlewares.RequirePermission(models.PermVoteModerate), routers.ResolveVoteReport) // Resolve or dismiss open reports of a vote
+	r.POST("/admin/moderation/visibility", middlewares.RequirePermission(models.PermVoteModerate), routers.SetVoteVisibility)      // Set visibility of a vote
+
+	// Vote drafts
+	r.GET("/votes/drafts", middlewares.RequirePermission(models.PermVoteCreate), routers.ListVoteDrafts)                     // List drafts owned by or shared with current wallet
+	r.GET("/votes/drafts/:id", middlewares.RequirePermission(models.PermVoteCreate), routers.GetVoteDraft)                   // Preview a draft with validation problems
+	r.POST("/votes/drafts/create", middlewares.RequirePermission(models.PermVoteCreate), routers.CreateVoteDraft)            // Create a draft
+	r.POST("/votes/drafts/update", middlewares.RequirePermission(models.PermVoteCreate), routers.UpdateVoteDraft)            // Save a draft
+	r.POST("/votes/drafts/delete", middlewares.RequirePermission(models.PermVoteCreate), routers.DeleteVoteDraft)            // Delete a draft
+	r.POST("/votes/drafts/share", middlewares.RequirePermission(models.PermVoteCreate), routers.ShareVoteDraft)              // Share a draft with a co-admin
+	r.POST("/votes/drafts/unshare", middlewares.RequirePermission(models.PermVoteCreate), routers.UnshareVoteDraft)          // Stop sharing a draft
+	r.POST("/votes/drafts/deploy-build", middlewares.RequirePermission(models.PermVoteCreate), routers.GenDeployVoteDraftTx) // Validate a draft and gen deployment tx
+	r.POST("/votes/drafts/deploy-exec", middlewares.RequirePermission(models.PermVoteCreate), routers.DeployVoteDraft)       // Confirm deployment and move draft into votes
 
 	log.Printf("Server started at http://localhost:%d", config.G.Server.Port)
 	err := r.Run(fmt.Sprintf(":%d", config.G.Server.Port)) // 运行 HTTP 服务器
@@ -0,0 +1,88 @@
+// Package merkle 构建与 OpenZeppelin MerkleProof 兼容的 Merkle 树
+// 相邻节点按字节序排序之后再拼接哈希，因此证明中不需要记录左右位置
+package merkle
+
+import (
+	"bytes"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// Tree 由叶子哈希构建的 Merkle 树，叶子按字节序排序，与输入顺序无关
+type Tree struct {
+	layers [][]common.Hash // layers[0] 为排序后的叶子，最后一层为根
+}
+
+// New 构建 Merkle 树，叶子不能为空
+func New(leaves []common.Hash) (*Tree, error) {
+	if len(leaves) == 0 {
+		return nil, errors.New("Merkle tree needs at least one leaf")
+	}
+	layer := make([]common.Hash, len(leaves))
+	copy(layer, leaves)
+	sort.Slice(layer, func(i, j int) bool { return bytes.Compare(layer[i][:], layer[j][:]) < 0 })
+
+	t := &Tree{layers: [][]common.Hash{layer}}
+	for len(layer) > 1 {
+		next := make([]common.Hash, 0, (len(layer)+1)/2)
+		for i := 0; i < len(layer); i += 2 {
+			if i+1 == len(layer) {
+				// 落单的节点直接提升到上一层
+				next = append(next, layer[i])
+				continue
+			}
+			next = append(next, HashPair(layer[i], layer[i+1]))
+		}
+		t.layers = append(t.layers, next)
+		layer = next
+	}
+	return t, nil
+}
+
+// Root 返回树根
+func (t *Tree) Root() common.Hash {
+	return t.layers[len(t.layers)-1][0]
+}
+
+// Proof 返回叶子的包含证明，叶子不在树中时返回错误
+func (t *Tree) Proof(leaf common.Hash) ([]common.Hash, error) {
+	index := -1
+	for i, l := range t.layers[0] {
+		if l == leaf {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, errors.New("Leaf is not in the tree")
+	}
+
+	proof := []common.Hash{}
+	for _, layer := range t.layers[:len(t.layers)-1] {
+		sibling := index ^ 1
+		if sibling < len(layer) {
+			proof = append(proof, layer[sibling])
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// Verify 按 OpenZeppelin MerkleProof.verify 的规则校验证明
+func Verify(root, leaf common.Hash, proof []common.Hash) bool {
+	computed := leaf
+	for _, p := range proof {
+		computed = HashPair(computed, p)
+	}
+	return computed == root
+}
+
+// HashPair 对两个节点排序后拼接哈希
+func HashPair(a, b common.Hash) common.Hash {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return crypto.Keccak256Hash(a[:], b[:])
+}
@@ -0,0 +1,153 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"testing"
+)
+
+func testLeaves(n int) []common.Hash {
+	leaves := make([]common.Hash, 0, n)
+	for i := 0; i < n; i++ {
+		leaves = append(leaves, crypto.Keccak256Hash([]byte(fmt.Sprintf("leaf-%d", i))))
+	}
+	return leaves
+}
+
+// processProof 按 OpenZeppelin MerkleProof.processProof 独立实现：较小的节点在前拼接后哈希
+func processProof(leaf common.Hash, proof []common.Hash) common.Hash {
+	computed := leaf
+	for _, p := range proof {
+		if bytes.Compare(computed[:], p[:]) < 0 {
+			computed = crypto.Keccak256Hash(computed[:], p[:])
+		} else {
+			computed = crypto.Keccak256Hash(p[:], computed[:])
+		}
+	}
+	return computed
+}
+
+func TestProofsVerify(t *testing.T) {
+	// 包括奇数个叶子，落单的节点直接提升到上一层
+	for _, n := range []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 16, 17, 33} {
+		t.Run(fmt.Sprintf("%d leaves", n), func(t *testing.T) {
+			leaves := testLeaves(n)
+			tree, err := New(leaves)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, leaf := range leaves {
+				proof, err := tree.Proof(leaf)
+				if err != nil {
+					t.Fatalf("leaf %d: %v", i, err)
+				}
+				if !Verify(tree.Root(), leaf, proof) {
+					t.Fatalf("leaf %d: proof does not verify", i)
+				}
+				if got := processProof(leaf, proof); got != tree.Root() {
+					t.Fatalf("leaf %d: OpenZeppelin processProof gives %s, root is %s", i, got.Hex(), tree.Root().Hex())
+				}
+			}
+		})
+	}
+}
+
+func TestSingleLeaf(t *testing.T) {
+	leaf := testLeaves(1)[0]
+	tree, err := New([]common.Hash{leaf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root() != leaf {
+		t.Fatalf("root = %s, want the leaf itself", tree.Root().Hex())
+	}
+	proof, err := tree.Proof(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof) != 0 {
+		t.Fatalf("proof has %d nodes, want 0", len(proof))
+	}
+}
+
+func TestThreeLeavesLayout(t *testing.T) {
+	leaves := testLeaves(3)
+	tree, err := New(leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorted := append([]common.Hash{}, tree.layers[0]...)
+	want := HashPair(HashPair(sorted[0], sorted[1]), sorted[2])
+	if tree.Root() != want {
+		t.Fatalf("root = %s, want %s", tree.Root().Hex(), want.Hex())
+	}
+	// 落单的叶子只需要兄弟子树的根
+	proof, err := tree.Proof(sorted[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof) != 1 || proof[0] != HashPair(sorted[0], sorted[1]) {
+		t.Fatalf("unexpected proof %v", proof)
+	}
+}
+
+func TestRootIgnoresLeafOrder(t *testing.T) {
+	leaves := testLeaves(5)
+	a, err := New(leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := make([]common.Hash, len(leaves))
+	for i, leaf := range leaves {
+		reversed[len(leaves)-1-i] = leaf
+	}
+	b, err := New(reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Root() != b.Root() {
+		t.Fatalf("roots differ: %s and %s", a.Root().Hex(), b.Root().Hex())
+	}
+}
+
+func TestHashPairIsSorted(t *testing.T) {
+	a, b := testLeaves(2)[0], testLeaves(2)[1]
+	if HashPair(a, b) != HashPair(b, a) {
+		t.Fatal("HashPair should not depend on argument order")
+	}
+	lo, hi := a, b
+	if bytes.Compare(lo[:], hi[:]) > 0 {
+		lo, hi = hi, lo
+	}
+	if want := crypto.Keccak256Hash(append(lo.Bytes(), hi.Bytes()...)); HashPair(a, b) != want {
+		t.Fatalf("HashPair = %s, want keccak256(lo || hi) %s", HashPair(a, b).Hex(), want.Hex())
+	}
+}
+
+func TestRejects(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Fatal("New should reject an empty tree")
+	}
+
+	leaves := testLeaves(4)
+	tree, err := New(leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Proof(common.Hash{1}); err == nil {
+		t.Fatal("Proof should reject a leaf that is not in the tree")
+	}
+	proof, err := tree.Proof(leaves[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Verify(tree.Root(), leaves[1], proof) {
+		t.Fatal("proof of one leaf should not verify another leaf")
+	}
+	proof[0][0] ^= 1
+	if Verify(tree.Root(), leaves[0], proof) {
+		t.Fatal("tampered proof should not verify")
+	}
+}
@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"backend/config"
+	"backend/utils"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+)
+
+// Limiter 所有限流中间件共用的状态存储，可以在启动时替换为其他实现
+var Limiter utils.RateLimiter = utils.NewMemoryRateLimiter()
+
+// RateLimit 按客户端 IP 与钱包地址分别进行令牌桶限流
+// name 用于区分不同规则的桶，同一个 IP 在不同规则下互不影响
+// 钱包地址只取自已验证的 JWT，未登录的请求只按 IP 限流
+// 请求体中的 wallet_address 可以被任何人伪造，用它限流会让攻击者耗尽他人的令牌，使其无法登录
+func RateLimit(name string, rule config.RateLimitRule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.G.RateLimit.Enabled {
+			c.Next()
+			return
+		}
+
+		ok, wait := Limiter.Allow(fmt.Sprintf("%s:ip:%s", name, c.ClientIP()), rule.IPRate, rule.IPBurst)
+		if ok && rule.WalletRate > 0 {
+			if walletAddr := rateLimitWalletAddr(c); walletAddr != "" {
+				ok, wait = Limiter.Allow(fmt.Sprintf("%s:wallet:%s", name, walletAddr), rule.WalletRate, rule.WalletBurst)
+			}
+		}
+
+		if !ok {
+			c.Header("Retry-After", fmt.Sprint(int64(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please retry later"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimitWrites 只对非只读请求限流
+func RateLimitWrites(name string, rule config.RateLimitRule) gin.HandlerFunc {
+	limit := RateLimit(name, rule)
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+		default:
+			limit(c)
+		}
+	}
+}
+
+func rateLimitWalletAddr(c *gin.Context) string {
+	walletAddr, err := DecodeWalletAddrFromHeader(c)
+	if err != nil {
+		return ""
+	}
+	return utils.NormalizeHex(walletAddr)
+}
@@ -1,15 +1,23 @@
 package middlewares
 
 import (
+	"backend/biz/nft"
+	"backend/config"
 	"backend/database"
 	"backend/database/models"
 	"backend/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"log"
 	"net/http"
+	"strings"
 )
 
-const KeyWalletAddr = "wallet_addr"
+const (
+	KeyWalletAddr     = "wallet_addr"      // 发起请求（签名登录）的钱包
+	KeyUserWalletAddr = "user_wallet_addr" // 该钱包所属用户的主钱包，未关联时与 KeyWalletAddr 相同
+	KeySessionID      = "session_id"
+)
 
 func GetWalletAddr(c *gin.Context) string {
 	walletAddr, ok := c.Get(KeyWalletAddr)
@@ -19,51 +27,190 @@ func GetWalletAddr(c *gin.Context) string {
 	return walletAddr.(string)
 }
 
+// GetUserWalletAddr 获取当前请求所属用户的主钱包地址，用于读写用户维度的数据
+func GetUserWalletAddr(c *gin.Context) string {
+	walletAddr, ok := c.Get(KeyUserWalletAddr)
+	if !ok {
+		return GetWalletAddr(c)
+	}
+	return walletAddr.(string)
+}
+
+func GetSessionID(c *gin.Context) uint64 {
+	sessionID, ok := c.Get(KeySessionID)
+	if !ok {
+		return 0
+	}
+	return sessionID.(uint64)
+}
+
 func DecodeWalletAddrFromHeader(c *gin.Context) (string, error) {
+	walletAddr, _, err := decodeSessionFromHeader(c)
+	return walletAddr, err
+}
+
+func decodeSessionFromHeader(c *gin.Context) (string, uint64, error) {
 	token := c.GetHeader("Authorization")
 	if token == "" || len(token) < 7 || token[:7] != "Bearer " {
-		return "", errors.New("header empty or format invalid")
+		return "", 0, errors.New("header empty or format invalid")
 	}
 
 	// Bearer token
 	token = token[7:]
 
-	walletAddr, err := utils.VerifyJWT(token)
+	walletAddr, sessionID, err := utils.VerifyJWTSession(token)
 	if err != nil {
-		return "", errors.Wrap(err, "verify jwt failed")
+		return "", 0, errors.Wrap(err, "verify jwt failed")
 	}
 
-	return walletAddr, nil
+	return walletAddr, sessionID, nil
+}
+
+// AuthenticateSession 解析请求头中的 JWT，并确认对应的会话仍然有效
+// 会话有效时会刷新其 last_seen_time
+func AuthenticateSession(c *gin.Context) (string, *models.Session, error) {
+	walletAddr, sessionID, err := decodeSessionFromHeader(c)
+	if err != nil {
+		return "", nil, err
+	}
+
+	session, err := models.GetSessionByID(database.Db, sessionID)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "session not found")
+	}
+	if session.WalletAddr != utils.NormalizeHex(walletAddr) {
+		return "", nil, errors.New("session does not belong to token wallet")
+	}
+	if session.Revoked() {
+		return "", nil, errors.New("session has been revoked, please re-login")
+	}
+
+	if err := models.TouchSession(database.Db, session); err != nil {
+		log.Printf("Failed to touch session %d: %v", session.ID, err)
+	}
+	return walletAddr, session, nil
 }
 
 // RequireRole 从请求头中获取钱包地址，并检查是否有权限
+// 新的路由应当使用 RequirePermission
 func RequireRole(role string) func(c *gin.Context) {
+	// check role
+	// 这里的逻辑是，如果接口显示不需要 role，那么只要是钱包地址有效即可访问，不需要该钱包在数据库中有记录，例如 register 接口
+	// 如果接口需要 role，那么需要在数据库中有记录，并且有对应的 role
+	if role == "" {
+		return requireAuth(nil, "")
+	}
+	return requireAuth(func(userRole string) (bool, error) {
+		return models.RoleIncludes(userRole, role)
+	}, "User does not have role: "+role)
+}
+
+// RequirePermission 从请求头中获取钱包地址，并检查用户是否拥有全部给定的权限
+// 不传入任何权限时，只要求钱包地址有效，不需要该钱包在数据库中有记录
+func RequirePermission(perms ...string) func(c *gin.Context) {
+	if len(perms) == 0 {
+		return requireAuth(nil, "")
+	}
+	return requireAuth(func(userRole string) (bool, error) {
+		return models.RoleHasPermissions(userRole, perms...), nil
+	}, "User does not have permission: "+strings.Join(perms, ", "))
+}
+
+// roleCheck 判断用户的角色是否满足接口的要求
+type roleCheck func(userRole string) (bool, error)
+
+// checkUserRole 查询钱包对应用户的角色并交给 check 判断
+// 开启 chainRoleCheck 时，只有依靠 admin / root 角色才能通过的请求会再以链上数据确认一次
+// 数据库中的角色已经拒绝的请求直接返回，不查询链上，RPC 不可用时仍然是 403 而不是 500
+func checkUserRole(c *gin.Context, walletAddr string, check roleCheck) (bool, error) {
+	user, err := models.LookupUserCached(database.Db, walletAddr)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check role")
+	}
+	if user == nil {
+		return false, nil
+	}
+
+	role := models.EffectiveRole(user, walletAddr)
+	ok, err := check(role)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check role")
+	}
+
+	// 链上权限只在主钱包上，附属钱包不需要确认
+	if !ok || !config.G.Blockchain.ChainRoleCheck || user.WalletAddr != utils.NormalizeHex(walletAddr) {
+		return ok, nil
+	}
+	if role != models.RoleAdmin && role != models.RoleRoot {
+		return ok, nil
+	}
+	// 普通用户也能访问的接口不需要确认链上的授权
+	if asUser, err := check(models.RoleUser); err == nil && asUser {
+		return true, nil
+	}
+
+	chainRole, err := nft.ConfirmUserRole(c, user)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to confirm role on chain")
+	}
+	if chainRole == role {
+		return ok, nil
+	}
+	ok, err = check(chainRole)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check role")
+	}
+	return ok, nil
+}
+
+// requireAuth 校验会话，并通过 check 判断是否允许访问
+// check 为 nil 时只校验会话；check 不通过时以 denied 作为 403 的错误信息
+func requireAuth(check roleCheck, denied string) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		walletAddr, err := DecodeWalletAddrFromHeader(c)
+		walletAddr, session, err := AuthenticateSession(c)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Decode token failed: " + err.Error()})
 			c.Abort()
 			return
 		}
 
-		// check role
-		// 这里的逻辑是，如果接口显示不需要 role，那么只要是钱包地址有效即可访问，不需要该钱包在数据库中有记录，例如 register 接口
-		// 如果接口需要 role，那么需要在数据库中有记录，并且有对应的 role
-		if role != "" {
-			hasRole, err := models.UserHasRole(database.Db, walletAddr, role)
+		// 被停用的用户不能访问任何需要登录的接口，包括各类交易构建接口
+		user, err := models.LookupUserCached(database.Db, walletAddr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
+			c.Abort()
+			return
+		}
+		if user != nil && user.Status == models.UserStatusSuspended {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User is suspended"})
+			c.Abort()
+			return
+		}
+
+		if check != nil {
+			ok, err := checkUserRole(c, walletAddr, check)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role: " + err.Error()})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				c.Abort()
 				return
 			}
-			if !hasRole {
-				c.JSON(http.StatusForbidden, gin.H{"error": "User does not have role: " + role})
+			if !ok {
+				c.JSON(http.StatusForbidden, gin.H{"error": denied})
 				c.Abort()
 				return
 			}
 		}
 
+		userWalletAddr, err := models.ResolvePrimaryWalletAddr(database.Db, walletAddr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve wallet: " + err.Error()})
+			c.Abort()
+			return
+		}
+
 		c.Set(KeyWalletAddr, walletAddr)
+		c.Set(KeyUserWalletAddr, userWalletAddr)
+		c.Set(KeySessionID, session.ID)
 		c.Next()
 	}
 }
@@ -0,0 +1,212 @@
+// Package receipt 投票回执的格式、在链上定位投票交易以及校验服务端的证明
+// 只依赖 RPC 节点，不依赖数据库，后端与离线的 verify-receipt 命令共用
+package receipt
+
+import (
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/pkg/errors"
+	"math/big"
+)
+
+// Version 回执格式的版本，格式变化时递增
+const Version = 1
+
+// Receipt 投票回执，记录投票人的 token、写入选项的交易以及链上记录的选项
+// 普通投票中写入选项的是 doVote 交易，commit-reveal 投票中是 reveal 交易
+type Receipt struct {
+	Version      int    `json:"version"`
+	ChainID      int64  `json:"chain_id"`
+	NFTContract  string `json:"nft_contract"`
+	VoteContract string `json:"vote_contract"`
+	Voter        string `json:"voter"`
+	TokenID      uint64 `json:"token_id"`
+	Option       int64  `json:"option"`
+	TxHash       string `json:"tx_hash"`
+	BlockNumber  uint64 `json:"block_number"`
+	BlockHash    string `json:"block_hash"`
+	IssuedAt     int64  `json:"issued_at"`
+}
+
+// Attestation 服务端对回执的签名，Payload 是回执的 JSON 原文，签名按 personal_sign 格式计算
+type Attestation struct {
+	Payload   string `json:"payload"`
+	Signer    string `json:"signer"`
+	Signature string `json:"signature"`
+}
+
+// Check 校验证明时的一项检查
+type Check struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+func getUserOptionAtBlock(ctx context.Context, client *ethclient.Client, abiStr, nftAddr, voterAddr, contractAddr string, blockNumber *big.Int) (int64, error) {
+	var option *big.Int
+	err := utils.CallViewMethodAtBlock(ctx, client, abiStr, nftAddr, "getUserOptionInVoting",
+		[]interface{}{common.HexToAddress(voterAddr), common.HexToAddress(contractAddr)}, blockNumber, &option)
+	if err != nil {
+		return 0, err
+	}
+	return option.Int64(), nil
+}
+
+// FindVoteTx 二分查找选项第一次写入的区块，再在区块中找到投票人发给投票合约的交易
+// 查询历史区块的状态需要节点保留历史状态
+func FindVoteTx(ctx context.Context, client *ethclient.Client, nftAddr, voterAddr, contractAddr string) (*types.Transaction, *types.Block, error) {
+	abiStr, _, err := utils.LoadContract(utils.ContractVotingNFT)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to load contract")
+	}
+	latest, err := client.BlockNumber(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to get latest block number")
+	}
+
+	// 不变式：hi 区块时已经投票；NFT 合约部署之前的区块没有代码，按尚未投票处理，其他查询失败直接返回
+	lo, hi := uint64(0), latest
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		blockNumber := new(big.Int).SetUint64(mid)
+		option, err := getUserOptionAtBlock(ctx, client, abiStr, nftAddr, voterAddr, contractAddr, blockNumber)
+		if err != nil {
+			code, codeErr := client.CodeAt(ctx, common.HexToAddress(nftAddr), blockNumber)
+			if codeErr != nil {
+				return nil, nil, errors.Wrapf(codeErr, "Failed to get code of NFT contract at block %d", mid)
+			}
+			if len(code) != 0 {
+				return nil, nil, errors.Wrapf(err, "Failed to read option at block %d", mid)
+			}
+		}
+		if option != 0 {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	block, err := client.BlockByNumber(ctx, new(big.Int).SetUint64(hi))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to get block %d", hi)
+	}
+	voter := common.HexToAddress(voterAddr)
+	voteContract := common.HexToAddress(contractAddr)
+	for i, tx := range block.Transactions() {
+		if tx.To() == nil || *tx.To() != voteContract {
+			continue
+		}
+		sender, err := client.TransactionSender(ctx, tx, block.Hash(), uint(i))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Failed to get sender of tx %s", tx.Hash().Hex())
+		}
+		if sender == voter {
+			return tx, block, nil
+		}
+	}
+	return nil, nil, errors.Errorf("Could not locate the vote transaction, the option first appears in block %d", hi)
+}
+
+// Verify 校验证明的签名来自可信的签名者，并与当前的链上状态比对
+// trustedSigner 必须由调用者提供，证明中的 Signer 由证明自己声明，不能作为信任的依据
+func Verify(ctx context.Context, att *Attestation, trustedSigner string) (*Receipt, []Check, error) {
+	if !common.IsHexAddress(trustedSigner) {
+		return nil, nil, errors.New("A trusted signer address is required")
+	}
+	var checks []Check
+	check := func(name string, passed bool, format string, args ...interface{}) {
+		checks = append(checks, Check{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	var r Receipt
+	if err := json.Unmarshal([]byte(att.Payload), &r); err != nil {
+		return nil, nil, errors.New("Invalid attestation payload")
+	}
+	if r.Version != Version {
+		return nil, nil, errors.Errorf("Unsupported receipt version %d", r.Version)
+	}
+
+	err := utils.VerifyAttestation(att.Payload, att.Signature, att.Signer)
+	check("signature", err == nil, "Signed by %s", att.Signer)
+	trusted := utils.NormalizeHex(trustedSigner) == utils.NormalizeHex(att.Signer)
+	check("signer", trusted, "Expected signer %s", common.HexToAddress(trustedSigner).Hex())
+
+	client, err := utils.NewEthClient()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "New client err")
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Error getting network ID")
+	}
+	check("chain", chainID.Int64() == r.ChainID, "Connected to chain %d", chainID.Int64())
+
+	// 交易仍在原来的区块中且执行成功，区块哈希不同说明发生了重组
+	txHash := common.HexToHash(r.TxHash)
+	txReceipt, err := client.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		check("transaction", false, "Transaction %s not found: %v", r.TxHash, err)
+	} else {
+		ok := txReceipt.Status == types.ReceiptStatusSuccessful &&
+			txReceipt.BlockNumber.Uint64() == r.BlockNumber &&
+			txReceipt.BlockHash == common.HexToHash(r.BlockHash)
+		check("transaction", ok, "Status %d in block %d (%s)", txReceipt.Status, txReceipt.BlockNumber.Uint64(), txReceipt.BlockHash.Hex())
+	}
+
+	// 交易必须是投票人发给投票合约的，否则任何一笔成功的交易都可以冒充投票交易
+	tx, _, err := client.TransactionByHash(ctx, txHash)
+	if err != nil {
+		check("sender", false, "Transaction %s not found: %v", r.TxHash, err)
+	} else {
+		sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			check("sender", false, "Failed to recover transaction sender: %v", err)
+		} else {
+			toVote := tx.To() != nil && *tx.To() == common.HexToAddress(r.VoteContract)
+			check("sender", sender == common.HexToAddress(r.Voter) && toVote, "Sent by %s to %s", sender.Hex(), txTo(tx))
+		}
+	}
+
+	// token 与选项仍然如回执所述
+	var tokenID *big.Int
+	err = utils.CallViewMethod(ctx, client, utils.ContractVotingNFT, r.NFTContract, "getUserTokenInVoting",
+		[]interface{}{common.HexToAddress(r.Voter), common.HexToAddress(r.VoteContract)}, &tokenID)
+	if err != nil {
+		check("token", false, "Failed to read token: %v", err)
+	} else {
+		check("token", tokenID.Uint64() == r.TokenID, "Voter holds token #%d", tokenID.Uint64())
+	}
+	abiStr, _, err := utils.LoadContract(utils.ContractVotingNFT)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to load contract")
+	}
+	option, err := getUserOptionAtBlock(ctx, client, abiStr, r.NFTContract, r.Voter, r.VoteContract, nil)
+	if err != nil {
+		check("option", false, "Failed to read option: %v", err)
+	} else {
+		check("option", option == r.Option, "Recorded option is #%d", option)
+	}
+	return &r, checks, nil
+}
+
+func txTo(tx *types.Transaction) string {
+	if tx.To() == nil {
+		return "contract creation"
+	}
+	return tx.To().Hex()
+}
+
+// Valid 所有检查是否都通过
+func Valid(checks []Check) bool {
+	for _, c := range checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return len(checks) > 0
+}
@@ -0,0 +1,32 @@
+package receipt
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVerifyRequiresTrustedSigner(t *testing.T) {
+	att := &Attestation{Payload: `{"version":1}`, Signer: "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"}
+	for _, signer := range []string{"", "not an address"} {
+		if _, _, err := Verify(context.Background(), att, signer); err == nil {
+			t.Errorf("Verify should reject trusted signer %q", signer)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   bool
+	}{
+		{"no checks", nil, false},
+		{"all passed", []Check{{Name: "signature", Passed: true}, {Name: "sender", Passed: true}}, true},
+		{"one failed", []Check{{Name: "signature", Passed: true}, {Name: "sender", Passed: false}}, false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.checks); got != tt.want {
+			t.Errorf("%s: Valid() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
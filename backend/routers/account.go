@@ -0,0 +1,162 @@
+package routers
+
+import (
+	"backend/biz/nft"
+	"backend/biz/vote"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+// participation 用户在某个投票中的链上身份，来自 VotingNFT 的 getAllTokensByUser
+type participation struct {
+	WalletAddr     string `json:"wallet_address"`
+	TokenID        string `json:"token_id"`
+	VotingContract string `json:"voting_contract"`
+	Role           string `json:"role"`
+	Option         string `json:"option"`
+}
+
+// ExportMyData 导出当前用户的个人数据，包括资料、钱包、会话、创建的投票以及链上的参与记录
+func ExportMyData(c *gin.Context) {
+	user, err := models.GetUserByWalletAddr(database.Db, middlewares.GetUserWalletAddr(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user: " + err.Error()})
+		return
+	}
+	wallets, err := models.ListUserWalletsByUserID(database.Db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	walletAddrs, err := models.ListAllWalletAddrsOfUser(database.Db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sessions, err := models.ListSessionsByWalletAddrs(database.Db, walletAddrs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	votes, err := models.ListVotesByOwnerAddrs(database.Db, walletAddrs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	participations := make([]participation, 0)
+	for _, walletAddr := range walletAddrs {
+		tokens, err := vote.GetUserRelatedListFromBlockchain(c, walletAddr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, token := range tokens {
+			participations = append(participations, participation{
+				WalletAddr:     walletAddr,
+				TokenID:        token.TokenId.String(),
+				VotingContract: utils.NormalizeHex(token.Metadata.VotingContract.Hex()),
+				Role:           token.Metadata.Role,
+				Option:         token.Metadata.Option.String(),
+			})
+		}
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"votingchain-export-%s.json\"", user.WalletAddr))
+	c.JSON(http.StatusOK, gin.H{
+		"export_time":   time.Now().Unix(),
+		"user":          user,
+		"wallets":       wallets,
+		"sessions":      sessions,
+		"votes_owned":   votes,
+		"participation": participations,
+	})
+}
+
+// DeleteMyAccount 注销当前用户，数据库中的个人信息会被匿名化，链上数据保持不变
+// root 与 admin 必须指定一个在链上拥有同等权限的继任者
+func DeleteMyAccount(c *gin.Context) {
+	var request struct {
+		ConfirmWalletAddress   string `json:"confirm_wallet_address"` // 必须与当前用户的主钱包一致，防止误操作
+		SuccessorWalletAddress string `json:"successor_wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := models.GetUserByWalletAddr(database.Db, middlewares.GetUserWalletAddr(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user: " + err.Error()})
+		return
+	}
+	if utils.NormalizeHex(request.ConfirmWalletAddress) != user.WalletAddr {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "confirm_wallet_address must be the primary wallet of current user"})
+		return
+	}
+
+	walletAddrs, err := models.ListAllWalletAddrsOfUser(database.Db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if code, err := checkSuccessor(c, user, walletAddrs, request.SuccessorWalletAddress); err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.AnonymizeUser(database.Db, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	deleteAvatarFiles(user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// checkSuccessor 检查 root 与 admin 的继任者，普通用户不需要继任者
+// root 的继任者必须在链上拥有 ROOT_ROLE，admin 的继任者必须在链上是 admin 或 root
+func checkSuccessor(c *gin.Context, user *models.User, walletAddrs []string, successorAddr string) (int, error) {
+	if user.Role != models.RoleAdmin && user.Role != models.RoleRoot {
+		return http.StatusOK, nil
+	}
+	if successorAddr == "" {
+		return http.StatusBadRequest, errors.Errorf("A %s must name a successor_wallet_address before deleting the account", user.Role)
+	}
+
+	successorAddr = utils.NormalizeHex(successorAddr)
+	for _, walletAddr := range walletAddrs {
+		if walletAddr == successorAddr {
+			return http.StatusBadRequest, errors.New("Successor must be another user")
+		}
+	}
+
+	successor, err := models.LookupUserCached(database.Db, successorAddr)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if successor == nil || successor.WalletAddr != successorAddr || successor.Status != models.UserStatusActive {
+		return http.StatusBadRequest, errors.New("Successor must be the primary wallet of an active user")
+	}
+
+	chainRole, err := nft.GetRoleByBlockchain(c, successorAddr)
+	if err != nil {
+		return http.StatusInternalServerError, errors.Wrapf(err, "Failed to check successor role")
+	}
+	ok, err := models.RoleIncludes(chainRole, user.Role)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !ok {
+		return http.StatusBadRequest, errors.Errorf("Successor must be a %s on chain", user.Role)
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,111 @@
+package routers
+
+import (
+	"backend/biz/vote"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const maxAllowlistUploadSize = 1 << 20 // 1 MB
+
+// loadOwnedVote 读取调用者作为 owner 的投票，不存在或不是 owner 时写入错误并返回 nil
+func loadOwnedVote(c *gin.Context, contractAddr string) *models.Vote {
+	v, err := models.GetVoteByContractAddr(database.Db, contractAddr)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return nil
+	}
+	if v.OwnerAddr != middlewares.GetWalletAddr(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the vote owner can manage the allowlist"})
+		return nil
+	}
+	return v
+}
+
+// UploadVoteAllowlist owner 上传投票的名单，表单字段为 vote_address、mode 与 file
+// 文件为 .csv 或 .json，每个成员是钱包地址、名称或注册用户已验证的邮箱
+// mode 为 replace（默认）时替换原有名单，上传空的 JSON 数组即可取消名单；为 append 时追加，投票开始之后不能再修改
+func UploadVoteAllowlist(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAllowlistUploadSize+64*1024)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input, file is required and must be at most 1 MB"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxAllowlistUploadSize+1))
+	if err != nil || len(data) > maxAllowlistUploadSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Allowlist file must be at most 1 MB"})
+		return
+	}
+
+	mode := c.DefaultPostForm("mode", "replace")
+	if mode != "replace" && mode != "append" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode, must be replace or append"})
+		return
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	if format != vote.AllowlistFormatCSV && format != vote.AllowlistFormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Allowlist file must be .csv or .json"})
+		return
+	}
+
+	v := loadOwnedVote(c, c.PostForm("vote_address"))
+	if v == nil {
+		return
+	}
+	info, err := vote.GetVotingInfoFromBlockchain(c, v.ContractAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get vote from blockchain: " + err.Error()})
+		return
+	}
+	// 与资格规则一样，投票开始之后名单不能再修改，否则可以在看到选票之后改变结果
+	if int(info.State) != models.VoteStateInit && int(info.State) != models.VoteStateRegistration {
+		c.JSON(http.StatusConflict, gin.H{"error": "Vote has started, the allowlist cannot be changed"})
+		return
+	}
+
+	inputs, err := vote.ParseAllowlist(data, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entries, problems, err := vote.ResolveAllowlist(c, inputs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Allowlist has invalid members", "problems": problems})
+		return
+	}
+
+	if err := models.SaveVoteAllowlist(database.Db, v.ContractAddr, entries, mode == "replace"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Allowlist updated", "uploaded": len(entries)})
+}
+
+// GetVoteAllowlist owner 查看名单中的成员，以及每个成员在链上是否已经登记或投票
+func GetVoteAllowlist(c *gin.Context) {
+	v := loadOwnedVote(c, c.Param("addr"))
+	if v == nil {
+		return
+	}
+
+	members, summary, err := vote.GetAllowlistStatus(c, v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get allowlist status: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members, "summary": summary, "total": len(members)})
+}
@@ -1,33 +1,39 @@
 package routers
 
 import (
+	"backend/biz/ens"
 	"backend/database"
 	"backend/database/models"
 	"backend/middlewares"
 	"backend/utils"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"net/http"
 )
 
 var authChallenges = make(map[string]string)
 
+// maxBatchUserInfoSize 单次 BatchGetUserInfo 最多查询的钱包数量
+const maxBatchUserInfoSize = 100
+
 // GetUserState 获取当前访问者的状态
 // 如果用户已经注册，则返回 registered
 // 如果用户未注册，则返回 verified
 // 如果用户未验证（缺乏有效的 JWT Token），则返回 unverified
 func GetUserState(c *gin.Context) {
-	walletAddr, err := middlewares.DecodeWalletAddrFromHeader(c)
+	walletAddr, _, err := middlewares.AuthenticateSession(c)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"status": models.StateUnverified})
 		return
 	}
 
-	exists, err := models.UserExists(database.Db, walletAddr)
+	user, err := models.LookupUserCached(database.Db, walletAddr)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
 		return
 	}
-	if exists {
+	if user != nil {
 		c.JSON(http.StatusOK, gin.H{"status": models.StateRegistered})
 		return
 	} else {
@@ -36,13 +42,23 @@ func GetUserState(c *gin.Context) {
 	}
 }
 
+// userInfo BatchGetUserInfo 返回的用户信息
+// 邮箱只对用户本人（通过 Authorization 或配对的 jwt_tokens 证明）和拥有 user:email:read 权限的调用者返回
 type userInfo struct {
-	WalletAddr string `json:"wallet_address"`
-	Email      string `json:"email"`
-	Nickname   string `json:"nickname"`
-	Role       string `json:"role"`
-	State      string `json:"state"`
-	Err        string `json:"error"`
+	WalletAddr    string   `json:"wallet_address"`
+	Primary       string   `json:"primary_wallet_address"` // 所属用户的主钱包
+	Name          string   `json:"ens_name"`               // 反向解析得到的名称，没有时为空
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Nickname      string   `json:"nickname"`
+	Bio           string   `json:"bio"`
+	Links         []string `json:"links"`
+	Avatar        string   `json:"avatar"`       // 头像地址，相对于后端的根路径
+	AvatarThumb   string   `json:"avatar_thumb"` // 头像缩略图地址
+	Role          string   `json:"role"`
+	State         string   `json:"state"`
+	Full          bool     `json:"full"` // 是否为完整信息，false 表示只包含公开字段
+	Err           string   `json:"error"`
 }
 
 func BatchGetUserInfo(c *gin.Context) {
@@ -56,6 +72,11 @@ func BatchGetUserInfo(c *gin.Context) {
 		return
 	}
 
+	if len(request.WalletAddresses) > maxBatchUserInfoSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d wallet_addresses per request", maxBatchUserInfoSize)})
+		return
+	}
+
 	if len(request.JWTTokens) > 0 {
 		if len(request.WalletAddresses) != len(request.JWTTokens) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_addresses and jwt_tokens must have the same length"})
@@ -63,29 +84,65 @@ func BatchGetUserInfo(c *gin.Context) {
 		}
 	}
 
-	var res = make(map[string]*userInfo)
 	for i := range request.WalletAddresses {
-		walletAddr := utils.NormalizeHex(request.WalletAddresses[i])
-		user, err := models.GetUserByWalletAddr(database.Db, walletAddr)
+		request.WalletAddresses[i] = utils.NormalizeHex(request.WalletAddresses[i])
+	}
+
+	// 调用者身份是可选的，未登录时按匿名处理
+	viewerWallet, viewer, err := optionalViewer(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
+		return
+	}
+	canReadEmail := viewer != nil && models.RoleHasPermissions(models.EffectiveRole(viewer, viewerWallet), models.PermUserEmailRead)
+
+	users, err := models.BatchGetUsersByAnyWalletAddrs(database.Db, request.WalletAddresses)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tokenErrs map[string]error
+	if len(request.JWTTokens) > 0 {
+		tokenErrs, err = verifyPairedTokens(request.WalletAddresses, request.JWTTokens)
 		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var res = make(map[string]*userInfo)
+	for _, walletAddr := range request.WalletAddresses {
+		user, ok := users[walletAddr]
+		if !ok {
 			res[walletAddr] = &userInfo{
 				Role:       models.RoleVoid,
 				WalletAddr: walletAddr,
-				Err:        err.Error(),
+				Err:        "user not found",
 			}
 		} else {
+			tokenErr, paired := tokenErrs[walletAddr]
+			full := canReadEmail || (viewer != nil && viewer.ID == user.ID) || (paired && tokenErr == nil)
 			res[walletAddr] = &userInfo{
-				Email:      user.Email,
-				Nickname:   user.Nickname,
-				Role:       user.Role,
-				WalletAddr: user.WalletAddr,
-				Err:        "",
+				Nickname:    user.Nickname,
+				Bio:         user.Bio,
+				Links:       user.Links,
+				Avatar:      fileURL(user.Avatar),
+				AvatarThumb: fileURL(user.AvatarThumb),
+				Role:        user.Role,
+				WalletAddr:  walletAddr,
+				Primary:     user.WalletAddr,
+				Full:        full,
+				Err:         "",
+			}
+			if full {
+				res[walletAddr].Email = user.Email
+				res[walletAddr].EmailVerified = user.EmailVerified
 			}
 		}
 
 		if len(request.JWTTokens) > 0 {
-			_, err = utils.VerifyJWT(request.JWTTokens[i])
-			if err != nil {
+			if err := tokenErrs[walletAddr]; err != nil {
 				res[walletAddr].Err = err.Error()
 				res[walletAddr].State = models.StateUnverified
 			} else {
@@ -98,9 +155,70 @@ func BatchGetUserInfo(c *gin.Context) {
 		}
 	}
 
+	for walletAddr, name := range ens.LookupAddresses(c, request.WalletAddresses) {
+		res[walletAddr].Name = name
+	}
+
 	c.JSON(http.StatusOK, gin.H{"info": res})
 }
 
+// optionalViewer 在不要求登录的接口中识别调用者
+// 未登录、会话无效或用户未注册时返回空字符串与 nil，被停用的用户同样视为匿名
+func optionalViewer(c *gin.Context) (string, *models.User, error) {
+	walletAddr, _, err := middlewares.AuthenticateSession(c)
+	if err != nil {
+		return "", nil, nil
+	}
+	user, err := models.LookupUserCached(database.Db, walletAddr)
+	if err != nil {
+		return "", nil, err
+	}
+	if user == nil || user.Status != models.UserStatusActive {
+		return "", nil, nil
+	}
+	return walletAddr, user, nil
+}
+
+// verifyPairedTokens 校验与钱包一一对应的 JWT，返回 钱包地址 -> 校验错误（nil 表示通过）
+// token 必须属于与之配对的钱包，且对应的会话没有被吊销，不能用他人的 token 冒充
+func verifyPairedTokens(walletAddrs, tokens []string) (map[string]error, error) {
+	res := make(map[string]error)
+	sessionIDs := make(map[string]uint64)
+	for i, walletAddr := range walletAddrs {
+		tokenWallet, sessionID, err := utils.VerifyJWTSession(tokens[i])
+		if err != nil {
+			res[walletAddr] = err
+			continue
+		}
+		if utils.NormalizeHex(tokenWallet) != walletAddr {
+			res[walletAddr] = errors.New("token does not belong to the wallet")
+			continue
+		}
+		sessionIDs[walletAddr] = sessionID
+	}
+
+	ids := make([]uint64, 0, len(sessionIDs))
+	for _, id := range sessionIDs {
+		ids = append(ids, id)
+	}
+	sessions, err := models.BatchGetSessionsByIDs(database.Db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for walletAddr, id := range sessionIDs {
+		session, ok := sessions[id]
+		switch {
+		case !ok || session.WalletAddr != walletAddr:
+			res[walletAddr] = errors.New("session not found")
+		case session.Revoked():
+			res[walletAddr] = errors.New("session has been revoked, please re-login")
+		default:
+			res[walletAddr] = nil
+		}
+	}
+	return res, nil
+}
+
 func GenAuthChallenge(c *gin.Context) {
 	var request struct {
 		WalletAddr string `json:"wallet_address"`
@@ -143,6 +261,16 @@ func VerifyAuthChallenge(c *gin.Context) {
 		return
 	}
 
-	token := utils.GenerateJWT(request.WalletAddr)
+	session := &models.Session{
+		WalletAddr: request.WalletAddr,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if err := models.InsertSession(database.Db, session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session: " + err.Error()})
+		return
+	}
+
+	token := utils.GenerateJWT(request.WalletAddr, session.ID)
 	c.JSON(http.StatusOK, gin.H{"token": token})
 }
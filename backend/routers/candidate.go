@@ -0,0 +1,119 @@
+package routers
+
+import (
+	"backend/biz/ens"
+	"backend/biz/vote"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// candidateInfo 候选人的 token 与公开资料，未注册的钱包资料为空
+type candidateInfo struct {
+	WalletAddr  string `json:"wallet_address"`
+	TokenID     uint64 `json:"token_id"`
+	Status      string `json:"status"`   // pending 或 approved
+	Name        string `json:"ens_name"` // 反向解析得到的名称，没有时为空
+	Registered  bool   `json:"registered"`
+	Nickname    string `json:"nickname"`
+	Bio         string `json:"bio"`
+	Avatar      string `json:"avatar"`
+	AvatarThumb string `json:"avatar_thumb"`
+}
+
+// ListVoteCandidates 列出投票的候选人，status 为 pending 或 approved，为空则列出全部
+func ListVoteCandidates(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && !vote.IsCandidateStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status, must be pending or approved"})
+		return
+	}
+
+	v := loadVisibleVote(c, c.Param("addr"))
+	if v == nil {
+		return
+	}
+
+	tokens, err := vote.ListCandidates(c, v.ContractAddr, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list candidates: " + err.Error()})
+		return
+	}
+
+	walletAddrs := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		walletAddrs = append(walletAddrs, utils.NormalizeHex(token.Owner.Hex()))
+	}
+	users, err := models.BatchGetUsersByAnyWalletAddrs(database.Db, walletAddrs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	names := ens.LookupAddresses(c, walletAddrs)
+
+	res := make([]candidateInfo, 0, len(tokens))
+	for i, token := range tokens {
+		info := candidateInfo{
+			WalletAddr: walletAddrs[i],
+			TokenID:    token.TokenId.Uint64(),
+			Status:     vote.CandidateStatusOf(token.Metadata.Role),
+			Name:       names[walletAddrs[i]],
+		}
+		if user, ok := users[walletAddrs[i]]; ok {
+			info.Registered = true
+			info.Nickname = user.Nickname
+			info.Bio = user.Bio
+			info.Avatar = fileURL(user.Avatar)
+			info.AvatarThumb = fileURL(user.AvatarThumb)
+		}
+		res = append(res, info)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"candidates": res})
+}
+
+// GenApproveCandidatesTx 为投票的 owner 生成批量审核候选人的交易，需要按返回的顺序签名发送
+// wallet_addresses 为空时审核所有待审核的候选人
+func GenApproveCandidatesTx(c *gin.Context) {
+	var request struct {
+		VoteAddress     string   `json:"vote_address"`
+		WalletAddresses []string `json:"wallet_addresses"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	for i := range request.WalletAddresses {
+		if !resolveWalletInput(c, &request.WalletAddresses[i]) {
+			return
+		}
+	}
+
+	v, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+
+	txs, err := vote.CreateApproveCandidatesTxs(c, middlewares.GetWalletAddr(c), v.ContractAddr, request.WalletAddresses)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create approve transactions: " + err.Error()})
+		return
+	}
+
+	res := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		str, err := utils.JsonifyTx(tx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stringify transaction: " + err.Error()})
+			return
+		}
+		res = append(res, str)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"txs": res})
+}
@@ -0,0 +1,166 @@
+package routers
+
+import (
+	"backend/biz/vote"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// loadCommitRevealVote 读取 commit-reveal 投票，不存在或不是 commit-reveal 投票时写入错误并返回 nil
+func loadCommitRevealVote(c *gin.Context, contractAddr string) *models.Vote {
+	v, err := models.GetVoteByContractAddr(database.Db, contractAddr)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return nil
+	}
+	if !v.CommitReveal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vote is not a commit-reveal vote"})
+		return nil
+	}
+	return v
+}
+
+// GenCommitTx 生成提交承诺的交易
+// 传入 option 时由后端生成 salt 并计算承诺，salt 只在这里返回一次，投票人必须自己保存到揭示阶段
+// 不希望后端知道选择时，可以在本地计算好 commitment 直接传入
+func GenCommitTx(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+		Option      int64  `json:"option"`
+		Commitment  string `json:"commitment"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if (request.Option > 0) == (request.Commitment != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either option or commitment is required"})
+		return
+	}
+
+	v := loadCommitRevealVote(c, request.VoteAddress)
+	if v == nil {
+		return
+	}
+	walletAddr := middlewares.GetWalletAddr(c)
+	if !requireEligible(c, v, walletAddr) {
+		return
+	}
+
+	res := gin.H{}
+	var commitment [32]byte
+	var err error
+	if request.Commitment != "" {
+		commitment, err = vote.ParseBytes32(request.Commitment)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid commitment: " + err.Error()})
+			return
+		}
+	} else {
+		salt := vote.GenerateSalt()
+		commitment, err = vote.ComputeCommitment(request.Option, salt, walletAddr, v.ContractAddr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		res["salt"] = hexutil.Encode(salt[:])
+	}
+
+	tx, err := vote.CreateCommitTx(c, walletAddr, v.ContractAddr, commitment)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create commit transaction: " + err.Error()})
+		return
+	}
+	str, err := utils.JsonifyTx(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stringify transaction: " + err.Error()})
+		return
+	}
+
+	res["tx"] = str
+	res["commitment"] = hexutil.Encode(commitment[:])
+	c.JSON(http.StatusOK, res)
+}
+
+// GenRevealTx 生成揭示选票的交易，option 与 salt 不匹配承诺时直接拒绝，避免发送必然失败的交易
+func GenRevealTx(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+		Option      int64  `json:"option"`
+		Salt        string `json:"salt"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	salt, err := vote.ParseBytes32(request.Salt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid salt: " + err.Error()})
+		return
+	}
+
+	v := loadCommitRevealVote(c, request.VoteAddress)
+	if v == nil {
+		return
+	}
+
+	tx, err := vote.CreateRevealTx(c, middlewares.GetWalletAddr(c), v.ContractAddr, request.Option, salt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create reveal transaction: " + err.Error()})
+		return
+	}
+	str, err := utils.JsonifyTx(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stringify transaction: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tx": str})
+}
+
+// GetVoteCommitments 返回投票的承诺数与已揭示数，登录时附带当前钱包的承诺
+func GetVoteCommitments(c *gin.Context) {
+	v := loadVisibleVote(c, c.Param("addr"))
+	if v == nil {
+		return
+	}
+	if !v.CommitReveal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vote is not a commit-reveal vote"})
+		return
+	}
+
+	if c.Query("refresh") == "true" {
+		if _, err := vote.SyncCommitments(c, v.ContractAddr); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync commitments: " + err.Error()})
+			return
+		}
+	}
+
+	committed, revealed, err := models.CountVoteCommitments(database.Db, v.ContractAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	res := gin.H{"state": v.State, "committed": committed, "revealed": revealed}
+
+	walletAddr, _, err := optionalViewer(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if walletAddr != "" {
+		mine, err := models.GetVoteCommitment(database.Db, v.ContractAddr, walletAddr)
+		if err == nil {
+			res["mine"] = mine
+		}
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,218 @@
+package routers
+
+import (
+	"backend/biz/vote"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// requireEligible 检查钱包是否在投票的名单中、并满足资格规则，不满足时写入 403 并返回 false
+// 合约本身不检查资格，这里只是拒绝为不满足资格的钱包生成交易
+func requireEligible(c *gin.Context, v *models.Vote, walletAddr string) bool {
+	if !requireVerifiedEmail(c, walletAddr) {
+		return false
+	}
+
+	hasAllowlist, err := models.HasVoteAllowlist(database.Db, v.ContractAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if hasAllowlist {
+		allowed, userID, err := models.GetWalletAllowlistMember(database.Db, v.ContractAddr, walletAddr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not eligible: wallet is not on the allowlist of this vote"})
+			return false
+		}
+		// 按用户加入的成员只有一票，用户的其他钱包已经登记或投票时拒绝
+		if err := vote.CheckAllowlistMemberWallet(c, v, walletAddr, userID); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not eligible: " + err.Error()})
+			return false
+		}
+	}
+
+	res, err := vote.CheckEligibility(c, v, walletAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check eligibility: " + err.Error()})
+		return false
+	}
+	if !res.Eligible {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not eligible: " + res.Reason(), "eligibility": res})
+		return false
+	}
+	return true
+}
+
+// GetVoteEligibility 检查钱包是否在投票的名单中、并满足资格规则，不传 wallet_address 时检查当前登录的钱包
+func GetVoteEligibility(c *gin.Context) {
+	v := loadVisibleVote(c, c.Param("addr"))
+	if v == nil {
+		return
+	}
+
+	walletAddr := c.Query("wallet_address")
+	if walletAddr == "" {
+		walletAddr, _, _ = optionalViewer(c)
+		if walletAddr == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_address is required"})
+			return
+		}
+	} else if !resolveWalletInput(c, &walletAddr) {
+		return
+	}
+
+	res, err := vote.CheckEligibility(c, v, walletAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check eligibility: " + err.Error()})
+		return
+	}
+	hasAllowlist, err := models.HasVoteAllowlist(database.Db, v.ContractAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 没有名单时所有钱包都视为在名单中
+	allowlisted := true
+	if hasAllowlist {
+		allowlisted, err = models.IsWalletAllowlisted(database.Db, v.ContractAddr, walletAddr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules":         v.Eligibility,
+		"eligibility":   res,
+		"has_allowlist": hasAllowlist,
+		"allowlisted":   allowlisted,
+		"eligible":      res.Eligible && allowlisted,
+	})
+}
+
+// SetVoteEligibility owner 设置投票的资格规则，rules 为空表示取消限制，进入投票阶段之后不能再修改
+func SetVoteEligibility(c *gin.Context) {
+	var request struct {
+		VoteAddress string             `json:"vote_address"`
+		Eligibility models.Eligibility `json:"eligibility"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := request.Eligibility.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	v, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+	if v.OwnerAddr != middlewares.GetWalletAddr(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the vote owner can change the eligibility rules"})
+		return
+	}
+
+	info, err := vote.GetVotingInfoFromBlockchain(c, v.ContractAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get vote from blockchain: " + err.Error()})
+		return
+	}
+	if int(info.State) != models.VoteStateInit && int(info.State) != models.VoteStateRegistration {
+		c.JSON(http.StatusConflict, gin.H{"error": "Vote has started, the eligibility rules cannot be changed"})
+		return
+	}
+	if request.Eligibility.Enabled() {
+		if err := vote.CheckSnapshotBlock(c, request.Eligibility.SnapshotBlock); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := models.SetVoteEligibility(database.Db, v.ContractAddr, &request.Eligibility); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Eligibility rules updated"})
+}
+
+// GenRegisterVoterTx 生成登记为投票人的交易，不满足资格规则的钱包会被拒绝
+func GenRegisterVoterTx(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	v, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+	walletAddr := middlewares.GetWalletAddr(c)
+	if !requireEligible(c, v, walletAddr) {
+		return
+	}
+
+	tx, err := vote.CreateRegisterVoterTx(c, walletAddr, v)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create register transaction: " + err.Error()})
+		return
+	}
+	respondTx(c, tx)
+}
+
+// GenVoteTx 生成投票的交易，不满足资格规则的钱包会被拒绝
+func GenVoteTx(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+		Option      int64  `json:"option"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	v, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+	walletAddr := middlewares.GetWalletAddr(c)
+	if !requireEligible(c, v, walletAddr) {
+		return
+	}
+
+	tx, err := vote.CreateVoteTx(c, walletAddr, v, request.Option)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create vote transaction: " + err.Error()})
+		return
+	}
+	respondTx(c, tx)
+}
+
+func respondTx(c *gin.Context, tx *types.Transaction) {
+	str, err := utils.JsonifyTx(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stringify transaction: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tx": str})
+}
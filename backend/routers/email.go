@@ -0,0 +1,244 @@
+package routers
+
+import (
+	"backend/config"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"crypto/subtle"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"net/http"
+	"net/mail"
+	"time"
+)
+
+// emailResendInterval 两次发送验证邮件之间的最短间隔
+const emailResendInterval = 60 // in seconds
+
+// defaultEmailVerifyExpireMin 未配置 verifyExpireMin 时验证的有效期
+const defaultEmailVerifyExpireMin = 30
+
+func validateEmail(email string) error {
+	if len(email) > 50 {
+		return errors.New("Email is too long")
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("Invalid email address")
+	}
+	return nil
+}
+
+// sendEmailVerification 为用户创建一次邮箱验证，并发送包含验证链接与验证码的邮件
+func sendEmailVerification(user *models.User, email, purpose string) error {
+	expireMin := config.G.Email.VerifyExpireMin
+	if expireMin <= 0 {
+		expireMin = defaultEmailVerifyExpireMin
+	}
+	token := utils.GenerateChallenge()
+	code := utils.GenerateVerifyCode()
+
+	err := models.InsertEmailVerification(database.Db, &models.EmailVerification{
+		UserID:     user.ID,
+		Email:      email,
+		Purpose:    purpose,
+		TokenHash:  utils.SignSecret(token),
+		CodeHash:   utils.SignSecret(code),
+		ExpireTime: time.Now().Add(time.Duration(expireMin) * time.Minute).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nYour verification code is %s, it expires in %d minutes.\n", user.Nickname, code, expireMin)
+	if config.G.Email.VerifyURL != "" {
+		body += fmt.Sprintf("\nOr open the link below to verify your email:\n%s?token=%s\n", config.G.Email.VerifyURL, token)
+	}
+	body += "\nIf you did not request this, please ignore this email.\n"
+
+	err = utils.DefaultMailer.Send(email, "Verify your email for VotingChain", body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to send verification email")
+	}
+	return nil
+}
+
+// SendEmailVerification 重新发送当前邮箱的验证邮件，或者传入新邮箱以发起邮箱变更
+// 邮箱变更在验证通过之前不会生效
+func SendEmailVerification(c *gin.Context) {
+	var request struct {
+		Email string `json:"email"` // 为空表示验证当前邮箱
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := models.GetUserByWalletAddr(database.Db, middlewares.GetUserWalletAddr(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	code, err := startEmailVerification(user, request.Email)
+	if err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// startEmailVerification 校验邮箱并发送验证邮件，失败时返回应当使用的 HTTP 状态码
+func startEmailVerification(user *models.User, email string) (int, error) {
+	purpose := models.EmailPurposeChange
+	if email == "" || email == user.Email {
+		if user.EmailVerified {
+			return http.StatusBadRequest, errors.New("Email is already verified")
+		}
+		email = user.Email
+		purpose = models.EmailPurposeRegister
+	}
+	if err := validateEmail(email); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	inUse, err := models.EmailInUse(database.Db, email, user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if inUse {
+		return http.StatusConflict, errors.New("Email is already in use")
+	}
+
+	pending, err := models.GetPendingEmailVerification(database.Db, user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if pending != nil && time.Now().Unix()-pending.CreateTime < emailResendInterval {
+		return http.StatusTooManyRequests, errors.New("Verification email was sent recently, please retry later")
+	}
+
+	if err := sendEmailVerification(user, email, purpose); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// VerifyEmailByToken 通过邮件中的链接完成验证，不需要登录
+func VerifyEmailByToken(c *gin.Context) {
+	var request struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.BindJSON(&request); err != nil || request.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	verification, err := models.GetEmailVerificationByTokenHash(database.Db, utils.SignSecret(request.Token))
+	if err != nil || !verification.Usable() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification link is invalid or expired"})
+		return
+	}
+
+	if err := models.ConsumeEmailVerification(database.Db, verification); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified", "email": verification.Email})
+}
+
+// VerifyEmailByCode 登录用户输入邮件中的验证码完成验证
+func VerifyEmailByCode(c *gin.Context) {
+	var request struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := models.GetUserByWalletAddr(database.Db, middlewares.GetUserWalletAddr(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	verification, err := models.GetPendingEmailVerification(database.Db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if verification == nil || !verification.Usable() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending verification, or it has expired, please request a new one"})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.SignSecret(request.Code)), []byte(verification.CodeHash)) != 1 {
+		if err := models.IncreaseEmailVerificationAttempts(database.Db, verification.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":         "Invalid verification code",
+			"attempts_left": models.EmailCodeMaxAttempts - verification.Attempts - 1,
+		})
+		return
+	}
+
+	if err := models.ConsumeEmailVerification(database.Db, verification); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified", "email": verification.Email})
+}
+
+// requireVerifiedEmail 开启 requireVerifiedForVoting 时，钱包所属用户必须已验证邮箱，否则写入 403 并返回 false
+// 未注册的钱包同样会被拒绝
+func requireVerifiedEmail(c *gin.Context, walletAddr string) bool {
+	if !config.G.Email.RequireVerifiedForVoting {
+		return true
+	}
+	user, err := models.GetUserByAnyWalletAddr(database.Db, walletAddr)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil || !user.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email before registering or voting"})
+		return false
+	}
+	return true
+}
+
+func GetEmailSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"require_verified_for_voting": config.G.Email.RequireVerifiedForVoting,
+	})
+}
+
+// SetEmailSettings 设置是否要求验证邮箱后才能报名投票，修改会写回配置文件
+func SetEmailSettings(c *gin.Context) {
+	var request struct {
+		RequireVerifiedForVoting bool `json:"require_verified_for_voting"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	config.G.Email.RequireVerifiedForVoting = request.RequireVerifiedForVoting
+	config.SaveConfig()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email settings updated"})
+}
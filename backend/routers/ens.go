@@ -0,0 +1,39 @@
+package routers
+
+import (
+	"backend/biz/ens"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// resolveWalletInput 接受十六进制地址或名称形式的钱包输入，并原地替换为没有 0x 前缀的地址
+// 解析失败时写入 400 响应并返回 false
+func resolveWalletInput(c *gin.Context, input *string) bool {
+	walletAddr, err := ens.ResolveAddressInput(c, *input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to resolve wallet address: " + err.Error()})
+		return false
+	}
+	*input = walletAddr
+	return true
+}
+
+// ResolveName 正向解析名称
+func ResolveName(c *gin.Context) {
+	walletAddr, err := ens.ResolveName(c, c.Query("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"wallet_address": walletAddr})
+}
+
+// LookupAddress 反向解析钱包地址，没有名称时 name 为空
+func LookupAddress(c *gin.Context) {
+	name, err := ens.LookupAddress(c, c.Query("wallet_address"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": name})
+}
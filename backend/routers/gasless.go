@@ -0,0 +1,186 @@
+package routers
+
+import (
+	"backend/ballot"
+	"backend/biz/vote"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// loadGaslessVote 读取免 gas 投票，不存在或不是免 gas 投票时写入错误并返回 nil
+func loadGaslessVote(c *gin.Context, contractAddr string) *models.Vote {
+	v := loadVisibleVote(c, contractAddr)
+	if v == nil {
+		return nil
+	}
+	if !v.Gasless {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vote is not a gasless vote"})
+		return nil
+	}
+	return v
+}
+
+// GetBallotTypedData 返回需要签名的 EIP-712 选票，issued_at 为空时使用当前时间
+// 前端将 typed_data 交给钱包 eth_signTypedData_v4 签名，再连同签名一起提交
+func GetBallotTypedData(c *gin.Context) {
+	v := loadGaslessVote(c, c.Param("addr"))
+	if v == nil {
+		return
+	}
+
+	voter := c.Query("voter")
+	option, err := strconv.ParseInt(c.Query("option"), 10, 64)
+	if voter == "" || err != nil || option <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "voter and option are required"})
+		return
+	}
+	if !resolveWalletInput(c, &voter) {
+		return
+	}
+	issuedAt := time.Now().Unix()
+	if s := c.Query("issued_at"); s != "" {
+		issuedAt, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid issued_at"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"typed_data": ballot.TypedData(v.ContractAddr, voter, option, issuedAt),
+		"ballot":     vote.SignedBallot{Voter: "0x" + voter, Option: option, IssuedAt: issuedAt},
+	})
+}
+
+// SubmitBallot 提交签名的选票，不需要登录，签名即证明了投票人的身份
+// 选票需要满足名单与资格规则，每个钱包只能提交一次
+func SubmitBallot(c *gin.Context) {
+	var request struct {
+		VoteAddress string            `json:"vote_address"`
+		Ballot      vote.SignedBallot `json:"ballot"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	v := loadGaslessVote(c, request.VoteAddress)
+	if v == nil {
+		return
+	}
+	ballot, err := vote.VerifyBallot(c, v, &request.Ballot)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ballot: " + err.Error()})
+		return
+	}
+	if !requireEligible(c, v, ballot.WalletAddr) {
+		return
+	}
+
+	if err := models.InsertOffchainBallot(database.Db, ballot); err != nil {
+		if err == models.ErrBallotExists {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ballot accepted", "digest": ballot.Digest, "leaf": ballot.Leaf})
+}
+
+// GetBallotProof 返回钱包选票的 Merkle 包含证明，可以用 BallotAnchor 合约的 verifyBallot 校验
+func GetBallotProof(c *gin.Context) {
+	v := loadGaslessVote(c, c.Param("addr"))
+	if v == nil {
+		return
+	}
+	walletAddr := c.Query("wallet_address")
+	if walletAddr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_address is required"})
+		return
+	}
+	if !resolveWalletInput(c, &walletAddr) {
+		return
+	}
+
+	if _, err := models.GetOffchainBallot(database.Db, v.ContractAddr, walletAddr); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ballot not found"})
+		return
+	}
+	proof, err := vote.GetBallotProof(c, v, walletAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build ballot proof: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, proof)
+}
+
+// GenAnchorTx 投票结束后为 owner 生成锚定交易，同时返回计票结果，交易上链之后调用 AnchorVote 记录
+func GenAnchorTx(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	v, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+
+	tx, res, err := vote.CreateAnchorTx(c, middlewares.GetWalletAddr(c), v)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create anchor transaction: " + err.Error()})
+		return
+	}
+	str, err := utils.JsonifyTx(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stringify transaction: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tx": str, "result": res})
+}
+
+// AnchorVote 锚定交易上链之后，确认链上的锚定与选票和计票结果一致，再记录到 votes 表中
+func AnchorVote(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+		TxHash      string `json:"tx_hash"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	v, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+	if v.OwnerAddr != middlewares.GetWalletAddr(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the vote owner can anchor the result"})
+		return
+	}
+
+	if err := vote.VerifyAnchorTx(c, v, request.TxHash); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to verify anchor transaction: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote anchored"})
+}
@@ -11,12 +11,8 @@ import (
 	"net/http"
 )
 
-func isInitialized() bool {
-	return config.G.Blockchain.RootUserAddr != ""
-}
-
 func CheckInitStatus(c *gin.Context) {
-	if !isInitialized() {
+	if !config.Initialized() {
 		c.String(http.StatusOK, "ni")
 	} else {
 		c.String(http.StatusOK, "i")
@@ -35,7 +31,7 @@ func GetInitContractTx(c *gin.Context) {
 
 	request.WalletAddress = utils.NormalizeHex(request.WalletAddress)
 
-	if !isInitialized() {
+	if !config.Initialized() {
 		tx, err := nft.CreateVotingNFTDeploymentTx(c, request.WalletAddress)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create deployment transaction: " + err.Error()})
@@ -67,7 +63,7 @@ func InitRootUser(c *gin.Context) {
 
 	request.WalletAddr = utils.NormalizeHex(request.WalletAddr)
 
-	if !isInitialized() {
+	if !config.Initialized() {
 		client, err := utils.NewEthClient()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to Ethereum client: " + err.Error()})
@@ -81,7 +77,6 @@ func InitRootUser(c *gin.Context) {
 			return
 		}
 
-		config.G.Blockchain.RootUserAddr = utils.NormalizeHex(request.WalletAddr)
 		config.G.Blockchain.NFTContractAddr = utils.NormalizeHex(receipt.ContractAddress.Hex())
 		config.SaveConfig()
 
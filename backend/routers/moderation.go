@@ -0,0 +1,264 @@
+package routers
+
+import (
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const (
+	maxReportDetailLength   = 1024 // in characters
+	maxModerationNoteLength = 1024 // in characters
+	moderationActionResolve = "resolve"
+	moderationActionDismiss = "dismiss"
+)
+
+// voteViewer 可选的调用者身份，用于判断能否看到被隐藏的投票
+type voteViewer struct {
+	userWalletAddr string // 调用者的主钱包，未登录时为空
+	moderator      bool
+}
+
+func getVoteViewer(c *gin.Context) (*voteViewer, error) {
+	walletAddr, user, err := optionalViewer(c)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return &voteViewer{}, nil
+	}
+	return &voteViewer{
+		userWalletAddr: user.WalletAddr,
+		moderator:      models.RoleHasPermissions(models.EffectiveRole(user, walletAddr), models.PermVoteModerate),
+	}, nil
+}
+
+// owns 判断钱包（主钱包或关联钱包）是否属于调用者
+func (v *voteViewer) owns(walletAddr string) (bool, error) {
+	if v.userWalletAddr == "" {
+		return false, nil
+	}
+	primary, err := models.ResolvePrimaryWalletAddr(database.Db, walletAddr)
+	if err != nil {
+		return false, err
+	}
+	return primary == v.userWalletAddr, nil
+}
+
+// loadVisibleVote 读取调用者可以看到的投票，被移除的投票只有 owner 与管理员可以看到
+// 失败时写入错误响应并返回 nil
+func loadVisibleVote(c *gin.Context, contractAddr string) *models.Vote {
+	v, err := models.GetVoteByContractAddr(database.Db, contractAddr)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return nil
+	}
+
+	if v.Visibility == models.VoteVisibilityRemoved {
+		viewer, err := getVoteViewer(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
+			return nil
+		}
+		owner, err := viewer.owns(v.OwnerAddr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
+			return nil
+		}
+		if !owner && !viewer.moderator {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+			return nil
+		}
+	}
+	return v
+}
+
+// GetVoteInfo 获取单个投票
+func GetVoteInfo(c *gin.Context) {
+	v := loadVisibleVote(c, c.Param("address"))
+	if v == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"vote": withOwnerNames(c, []models.Vote{*v})[0]})
+}
+
+// ReportVote 举报投票，进入管理员的处理队列
+func ReportVote(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+		Reason      string `json:"reason"`
+		Detail      string `json:"detail"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !models.IsReportReason(request.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reason, must be spam, abuse, test or other"})
+		return
+	}
+	detail, err := utils.SanitizeText(request.Detail, maxReportDetailLength)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	v, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress)
+	if err != nil || v.Visibility == models.VoteVisibilityRemoved {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+
+	report := &models.VoteReport{
+		ContractAddr: v.ContractAddr,
+		ReporterAddr: middlewares.GetUserWalletAddr(c),
+		Reason:       request.Reason,
+		Detail:       detail,
+	}
+	if err := models.InsertVoteReport(database.Db, report); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote reported", "report_id": report.ID})
+}
+
+// PageQueryVoteReports 分页查询举报队列，status 默认为 open
+func PageQueryVoteReports(c *gin.Context) {
+	var request struct {
+		Status      string `json:"status"`
+		VoteAddress string `json:"vote_address"`
+		Page        int    `json:"page"`
+		PageSize    int    `json:"page_size"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if request.Page <= 0 || request.PageSize <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page or page_size"})
+		return
+	}
+	if request.Status == "" {
+		request.Status = models.ReportStatusOpen
+	}
+
+	reports, count, err := models.PageQueryVoteReports(database.Db, request.Page, request.PageSize, request.Status, request.VoteAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports":     reports,
+		"count":       count,
+		"page":        request.Page,
+		"page_size":   request.PageSize,
+		"total_pages": (count + int64(request.PageSize) - 1) / int64(request.PageSize),
+	})
+}
+
+// ResolveVoteReport 处理举报，同一个投票下所有未处理的举报会一并关闭
+// action 为 resolve 时可以同时修改投票的可见性
+func ResolveVoteReport(c *gin.Context) {
+	var request struct {
+		ReportID   uint64 `json:"report_id"`
+		Action     string `json:"action"` // resolve 或 dismiss
+		Visibility string `json:"visibility"`
+		Note       string `json:"note"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	var status string
+	switch request.Action {
+	case moderationActionResolve:
+		status = models.ReportStatusResolved
+		if request.Visibility != "" && !models.IsVoteVisibility(request.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility"})
+			return
+		}
+	case moderationActionDismiss:
+		status = models.ReportStatusDismissed
+		if request.Visibility != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change visibility when dismissing a report"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action, must be resolve or dismiss"})
+		return
+	}
+	note, err := utils.SanitizeText(request.Note, maxModerationNoteLength)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := models.GetVoteReportByID(database.Db, request.ReportID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	if report.Status != models.ReportStatusOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": "Report has already been handled"})
+		return
+	}
+
+	walletAddr := middlewares.GetWalletAddr(c)
+	if request.Visibility != "" {
+		err = models.SetVoteVisibility(database.Db, report.ContractAddr, request.Visibility, walletAddr, note)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	closed, err := models.CloseVoteReports(database.Db, report.ContractAddr, status, walletAddr, note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reports handled", "closed": closed})
+}
+
+// SetVoteVisibility 直接修改投票的可见性，不需要先有举报
+func SetVoteVisibility(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+		Visibility  string `json:"visibility"`
+		Note        string `json:"note"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !models.IsVoteVisibility(request.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility, must be listed, unlisted, archived or removed"})
+		return
+	}
+	note, err := utils.SanitizeText(request.Note, maxModerationNoteLength)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = models.SetVoteVisibility(database.Db, request.VoteAddress, request.Visibility, middlewares.GetWalletAddr(c), note)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote visibility updated"})
+}
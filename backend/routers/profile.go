@@ -0,0 +1,155 @@
+package routers
+
+import (
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	maxBioLength  = 500 // in characters
+	maxLinks      = 5
+	maxLinkLength = 200
+
+	maxAvatarUploadSize = 2 << 20 // in bytes
+	avatarSize          = 512
+	avatarThumbSize     = 128
+)
+
+// sanitizeProfile 过滤简介中的 HTML 与控制字符，并校验外部链接
+func sanitizeProfile(bio string, links []string) (string, []string, error) {
+	bio, err := utils.SanitizeText(bio, maxBioLength)
+	if err != nil {
+		return "", nil, err
+	}
+	links, err = utils.SanitizeLinks(links, maxLinks, maxLinkLength)
+	if err != nil {
+		return "", nil, err
+	}
+	return bio, links, nil
+}
+
+// fileURL 返回存储中的文件通过 /files 访问的路径，key 为空时返回空字符串
+func fileURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "/files/" + key
+}
+
+// UploadAvatar 上传头像，表单字段为 avatar
+// 头像会被裁剪为正方形并重新编码，同时生成缩略图，旧头像会被删除
+func UploadAvatar(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarUploadSize+64*1024)
+	file, header, err := c.Request.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input, avatar file is required and must be at most 2 MB"})
+		return
+	}
+	defer file.Close()
+	if header.Size > maxAvatarUploadSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar must be at most 2 MB"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarUploadSize+1))
+	if err != nil || len(data) > maxAvatarUploadSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar must be at most 2 MB"})
+		return
+	}
+
+	avatar, thumb, ext, err := utils.ProcessAvatar(data, avatarSize, avatarThumbSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	walletAddr := middlewares.GetUserWalletAddr(c)
+	user, err := models.GetUserByWalletAddr(database.Db, walletAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user: " + err.Error()})
+		return
+	}
+
+	// 每次上传使用新的 key，客户端与 CDN 可以放心地长期缓存
+	name := fmt.Sprintf("%d-%s", user.ID, utils.GenerateChallenge()[:16])
+	avatarKey := fmt.Sprintf("avatars/%s.%s", name, ext)
+	thumbKey := fmt.Sprintf("avatars/%s-thumb.%s", name, ext)
+	if err := utils.DefaultStorage.Put(avatarKey, avatar); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := utils.DefaultStorage.Put(thumbKey, thumb); err != nil {
+		_ = utils.DefaultStorage.Delete(avatarKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SetUserAvatarByWalletAddr(database.Db, walletAddr, avatarKey, thumbKey); err != nil {
+		_ = utils.DefaultStorage.Delete(avatarKey)
+		_ = utils.DefaultStorage.Delete(thumbKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	deleteAvatarFiles(user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar updated", "avatar": fileURL(avatarKey), "avatar_thumb": fileURL(thumbKey)})
+}
+
+func DeleteAvatar(c *gin.Context) {
+	walletAddr := middlewares.GetUserWalletAddr(c)
+	user, err := models.GetUserByWalletAddr(database.Db, walletAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user: " + err.Error()})
+		return
+	}
+
+	if err := models.SetUserAvatarByWalletAddr(database.Db, walletAddr, "", ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	deleteAvatarFiles(user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar deleted"})
+}
+
+// deleteAvatarFiles 删除用户原先的头像文件，失败只记录日志
+func deleteAvatarFiles(user *models.User) {
+	for _, key := range []string{user.Avatar, user.AvatarThumb} {
+		if key == "" {
+			continue
+		}
+		if err := utils.DefaultStorage.Delete(key); err != nil {
+			log.Printf("Failed to delete avatar file %s: %v", key, err)
+		}
+	}
+}
+
+// GetFile 读取上传的文件，目前只有头像
+func GetFile(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !utils.ValidStorageKey(key) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	data, err := utils.DefaultStorage.Get(key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	contentType := "image/png"
+	if strings.HasSuffix(key, ".jpg") {
+		contentType = "image/jpeg"
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentType, data)
+}
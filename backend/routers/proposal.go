@@ -0,0 +1,296 @@
+package routers
+
+import (
+	"backend/config"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+// adminChangeNeedsApproval admin 变更是否需要多方审批
+func adminChangeNeedsApproval() bool {
+	return config.G.Governance.AdminChangeThreshold > 0
+}
+
+func isAdminChangeApprover(walletAddr string) bool {
+	walletAddr = utils.NormalizeHex(walletAddr)
+	for _, approver := range config.G.Governance.AdminChangeApprovers {
+		if utils.NormalizeHex(approver) == walletAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAdminChangeConfig 审批阈值不能超过审批人数，发起人不能审批自己的提议，因此需要除发起人以外有足够的审批人
+func checkAdminChangeConfig(proposerAddr string) error {
+	threshold := config.G.Governance.AdminChangeThreshold
+	others := 0
+	for _, approver := range config.G.Governance.AdminChangeApprovers {
+		if utils.NormalizeHex(approver) != utils.NormalizeHex(proposerAddr) {
+			others++
+		}
+	}
+	if threshold > others {
+		return errors.Errorf("Approval threshold %d exceeds the %d approvers other than the proposer", threshold, others)
+	}
+	return nil
+}
+
+// checkApprovedProposal 在启用审批时确认提议已经通过，并且与本次操作一致
+// 检查不通过时会直接写入错误响应并返回 false
+func checkApprovedProposal(c *gin.Context, proposalID uint64, action, targetAddr string) bool {
+	if !adminChangeNeedsApproval() {
+		return true
+	}
+
+	proposal, err := models.GetAdminProposalByID(database.Db, proposalID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin changes require an approved proposal, proposal_id is missing or invalid"})
+		return false
+	}
+	if proposal.Action != action || proposal.TargetAddr != utils.NormalizeHex(targetAddr) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Proposal does not match this admin change"})
+		return false
+	}
+	if proposal.Status != models.ProposalStatusApproved && proposal.Status != models.ProposalStatusExecuting {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Proposal is not approved, current status: " + proposal.Status})
+		return false
+	}
+	return true
+}
+
+// claimApprovedProposal 构建交易前占用提议，同一个提议同时只能有一个待上链的交易
+func claimApprovedProposal(c *gin.Context, proposalID uint64) bool {
+	if !adminChangeNeedsApproval() {
+		return true
+	}
+	if err := models.ClaimAdminProposal(database.Db, proposalID); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// markProposalExecuted 交易上链后将提议标记为已执行
+func markProposalExecuted(proposalID uint64, txHash string) error {
+	if !adminChangeNeedsApproval() {
+		return nil
+	}
+	return models.UpdateAdminProposalStatus(database.Db, proposalID,
+		[]string{models.ProposalStatusApproved, models.ProposalStatusExecuting}, models.ProposalStatusExecuted, txHash)
+}
+
+func CreateAdminProposal(c *gin.Context) {
+	var request struct {
+		Action        string `json:"action"`
+		WalletAddress string `json:"wallet_address"`
+		Reason        string `json:"reason"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if !adminChangeNeedsApproval() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admin change approval is not enabled"})
+		return
+	}
+	if request.Action != models.ProposalActionAddAdmin && request.Action != models.ProposalActionRemoveAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
+		return
+	}
+	if len(request.Reason) > 1024 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is too long"})
+		return
+	}
+
+	if err := checkAdminChangeConfig(middlewares.GetWalletAddr(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+
+	exists, err := models.UserExists(database.Db, request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check if target wallet address exists in DB: " + err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target wallet address does not exist in DB, or is not a primary wallet"})
+		return
+	}
+
+	open, err := models.HasOpenAdminProposal(database.Db, request.Action, request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if open {
+		c.JSON(http.StatusConflict, gin.H{"error": "An open proposal for this admin change already exists"})
+		return
+	}
+
+	proposal := &models.AdminProposal{
+		Action:       request.Action,
+		TargetAddr:   request.WalletAddress,
+		ProposerAddr: middlewares.GetWalletAddr(c),
+		Reason:       request.Reason,
+		Threshold:    config.G.Governance.AdminChangeThreshold,
+	}
+	if err := models.InsertAdminProposal(database.Db, proposal); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Proposal created", "proposal": proposal, "message_to_sign": proposal.ApprovalMessage()})
+}
+
+// ApproveAdminProposal 审批人对提议的审批消息签名以完成审批
+func ApproveAdminProposal(c *gin.Context) {
+	var request struct {
+		ProposalID uint64 `json:"proposal_id"`
+		Signature  string `json:"signature"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	approver := middlewares.GetWalletAddr(c)
+	if !isAdminChangeApprover(approver) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current wallet is not a designated approver"})
+		return
+	}
+
+	proposal, err := models.GetAdminProposalByID(database.Db, request.ProposalID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proposal not found"})
+		return
+	}
+	if proposal.Status != models.ProposalStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Proposal is not pending, current status: " + proposal.Status})
+		return
+	}
+	if proposal.ProposerAddr == utils.NormalizeHex(approver) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The proposer cannot approve their own proposal"})
+		return
+	}
+
+	if err := utils.VerifyChallenge(proposal.ApprovalMessage(), utils.NormalizeHex(request.Signature), approver); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Verification err: " + err.Error()})
+		return
+	}
+
+	if err := models.ApproveAdminProposal(database.Db, proposal, approver, request.Signature); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	proposal, err = models.GetAdminProposalByID(database.Db, request.ProposalID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Proposal approved", "proposal": proposal})
+}
+
+// CancelAdminProposal 发起人或拥有 admin:manage 权限的用户可以取消未执行的提议
+func CancelAdminProposal(c *gin.Context) {
+	var request struct {
+		ProposalID uint64 `json:"proposal_id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	proposal, err := models.GetAdminProposalByID(database.Db, request.ProposalID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proposal not found"})
+		return
+	}
+
+	walletAddr := middlewares.GetWalletAddr(c)
+	if proposal.ProposerAddr != walletAddr {
+		canManage, err := models.UserHasPermissions(database.Db, walletAddr, models.PermAdminManage)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !canManage {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the proposer or an admin manager can cancel the proposal"})
+			return
+		}
+	}
+
+	err = models.UpdateAdminProposalStatus(database.Db, proposal.ID,
+		[]string{models.ProposalStatusPending, models.ProposalStatusApproved, models.ProposalStatusExecuting}, models.ProposalStatusCancelled, "")
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Proposal cancelled"})
+}
+
+func GetAdminProposal(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid proposal id"})
+		return
+	}
+
+	proposal, err := models.GetAdminProposalByID(database.Db, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proposal not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"proposal": proposal, "message_to_sign": proposal.ApprovalMessage()})
+}
+
+func PageQueryAdminProposals(c *gin.Context) {
+	var request struct {
+		Status   string `json:"status"`
+		Page     int    `json:"page"`
+		PageSize int    `json:"page_size"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if request.Page <= 0 || request.PageSize <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page or page_size"})
+		return
+	}
+
+	proposals, count, err := models.PageQueryAdminProposals(database.Db, request.Page, request.PageSize, request.Status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"proposals":   proposals,
+		"threshold":   config.G.Governance.AdminChangeThreshold,
+		"approvers":   config.G.Governance.AdminChangeApprovers,
+		"count":       count,
+		"page":        request.Page,
+		"page_size":   request.PageSize,
+		"total_pages": (count + int64(request.PageSize) - 1) / int64(request.PageSize),
+	})
+}
@@ -0,0 +1,82 @@
+package routers
+
+import (
+	"backend/biz/vote"
+	"backend/config"
+	"backend/middlewares"
+	"backend/receipt"
+	"backend/utils"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// GetVoteReceipt 返回当前用户在投票中的回执与服务端签名的证明
+// wallet_address 必须是当前用户的钱包，为空时依次尝试用户的全部钱包
+func GetVoteReceipt(c *gin.Context) {
+	v := loadVisibleVote(c, c.Param("addr"))
+	if v == nil {
+		return
+	}
+
+	walletAddrs, err := listUserWalletAddrs(middlewares.GetUserWalletAddr(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if walletAddr := c.Query("wallet_address"); walletAddr != "" {
+		walletAddr = utils.NormalizeHex(walletAddr)
+		owned := false
+		for _, w := range walletAddrs {
+			owned = owned || w == walletAddr
+		}
+		if !owned {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Wallet does not belong to the current user"})
+			return
+		}
+		walletAddrs = []string{walletAddr}
+	}
+
+	r, err := vote.GetVoteReceipt(c, v, walletAddrs)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No receipt: " + err.Error()})
+		return
+	}
+
+	res := gin.H{"receipt": r}
+	if config.G.Server.AttestationKey != "" {
+		attestation, err := vote.Attest(r)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign receipt: " + err.Error()})
+			return
+		}
+		res["attestation"] = attestation
+	} else {
+		log.Printf("Attestation key is not configured, receipt of vote %s is not signed", v.ContractAddr)
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// VerifyVoteReceipt 校验回执证明的签名是否来自本服务，并与当前的链上状态比对
+// 同样的检查也可以在没有数据库的环境中通过 cmd/verify-receipt 命令完成
+func VerifyVoteReceipt(c *gin.Context) {
+	var request receipt.Attestation
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	signer, err := utils.AttesterAddr()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	r, checks, err := receipt.Verify(c, &request, signer.Hex())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": receipt.Valid(checks), "receipt": r, "checks": checks, "trusted_signer": signer.Hex()})
+}
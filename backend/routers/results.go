@@ -0,0 +1,78 @@
+package routers
+
+import (
+	"backend/biz/vote"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/tally"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetVoteResults 按投票的计票规则统计链上的选票，投票结束之前返回的是当前的中间结果
+func GetVoteResults(c *gin.Context) {
+	v := loadVisibleVote(c, c.Param("addr"))
+	if v == nil {
+		return
+	}
+
+	res, info, err := vote.TallyVote(c, v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to tally vote: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"state":        info.State,
+		"final":        int(info.State) == models.VoteStateEnded,
+		"tally_config": v.TallyConfig,
+		"result":       res,
+	})
+}
+
+// SetVoteTallyConfig owner 修改投票的计票规则，投票开始之后不能再修改
+// 投票开始后选票在链上公开，此时修改规则可以改变结果
+func SetVoteTallyConfig(c *gin.Context) {
+	var request struct {
+		VoteAddress string       `json:"vote_address"`
+		TallyConfig tally.Config `json:"tally_config"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	v, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+	if v.OwnerAddr != middlewares.GetWalletAddr(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the vote owner can change the counting rule"})
+		return
+	}
+
+	info, err := vote.GetVotingInfoFromBlockchain(c, v.ContractAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get vote from blockchain: " + err.Error()})
+		return
+	}
+	if int(info.State) != models.VoteStateInit && int(info.State) != models.VoteStateRegistration {
+		c.JSON(http.StatusConflict, gin.H{"error": "Voting has started, the counting rule cannot be changed"})
+		return
+	}
+	// 候选人尚未报名、选项为空时不检查弃权选项是否存在
+	if err := request.TallyConfig.Validate(vote.TallyOptions(info), info.NeedRegistration); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.SetVoteTallyConfig(database.Db, v.ContractAddr, &request.TallyConfig); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Counting rule updated"})
+}
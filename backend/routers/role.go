@@ -6,7 +6,6 @@ import (
 	"backend/database/models"
 	"backend/middlewares"
 	"backend/utils"
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
@@ -24,18 +23,19 @@ func GetAdminList(c *gin.Context) {
 
 func SyncAdminList(c *gin.Context) {
 	// sync admin list from blockchain
-	err := nft.SyncAdminList(c)
+	skipped, err := nft.SyncAdminList(c)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(200, gin.H{"message": "OK"})
+	c.JSON(200, gin.H{"message": "OK", "skipped": skipped})
 }
 
 func GenAddAdminTx(c *gin.Context) {
 	var request struct {
 		WalletAddress string `json:"wallet_address"`
+		ProposalID    uint64 `json:"proposal_id"` // 启用审批时必填
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -43,7 +43,13 @@ func GenAddAdminTx(c *gin.Context) {
 		return
 	}
 
-	request.WalletAddress = utils.NormalizeHex(request.WalletAddress)
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+
+	if !checkApprovedProposal(c, request.ProposalID, models.ProposalActionAddAdmin, request.WalletAddress) {
+		return
+	}
 
 	exists, err := models.UserExists(database.Db, request.WalletAddress)
 	if err != nil {
@@ -51,7 +57,11 @@ func GenAddAdminTx(c *gin.Context) {
 		return
 	}
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Target wallet address does not exist in DB"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target wallet address does not exist in DB, or is not a primary wallet"})
+		return
+	}
+
+	if !claimApprovedProposal(c, request.ProposalID) {
 		return
 	}
 
@@ -74,6 +84,7 @@ func AddAdmin(c *gin.Context) {
 	var request struct {
 		WalletAddress string `json:"wallet_address"`
 		TxHash        string `json:"tx_hash"`
+		ProposalID    uint64 `json:"proposal_id"` // 启用审批时必填
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -81,22 +92,28 @@ func AddAdmin(c *gin.Context) {
 		return
 	}
 
-	request.WalletAddress = utils.NormalizeHex(request.WalletAddress)
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
 	request.TxHash = utils.NormalizeHex(request.TxHash)
 
-	// wait for transaction to be mined
-	client, err := utils.NewEthClient()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to Ethereum client: " + err.Error()})
+	if !checkApprovedProposal(c, request.ProposalID, models.ProposalActionAddAdmin, request.WalletAddress) {
+		return
+	}
+
+	// 等待交易上链，并确认这就是执行提议的交易，否则审批记录中会留下无关或失败的交易
+	if err := nft.VerifyAdminTx(c, request.TxHash, "addAdmin", request.WalletAddress); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction: " + err.Error()})
 		return
 	}
-	_, err = utils.WaitForTransactionReceipt(client, common.HexToHash(request.TxHash))
+
+	err := nft.AddAdminToDb(c, request.WalletAddress)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transaction receipt: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	err = nft.AddAdminToDb(c, request.WalletAddress)
+	err = markProposalExecuted(request.ProposalID, request.TxHash)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -108,6 +125,7 @@ func AddAdmin(c *gin.Context) {
 func GenRemoveAdminTx(c *gin.Context) {
 	var request struct {
 		WalletAddress string `json:"wallet_address"`
+		ProposalID    uint64 `json:"proposal_id"` // 启用审批时必填
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -115,7 +133,13 @@ func GenRemoveAdminTx(c *gin.Context) {
 		return
 	}
 
-	request.WalletAddress = utils.NormalizeHex(request.WalletAddress)
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+
+	if !checkApprovedProposal(c, request.ProposalID, models.ProposalActionRemoveAdmin, request.WalletAddress) {
+		return
+	}
 
 	exists, err := models.UserExists(database.Db, request.WalletAddress)
 	if err != nil {
@@ -123,7 +147,11 @@ func GenRemoveAdminTx(c *gin.Context) {
 		return
 	}
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Target wallet address does not exist in DB"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target wallet address does not exist in DB, or is not a primary wallet"})
+		return
+	}
+
+	if !claimApprovedProposal(c, request.ProposalID) {
 		return
 	}
 
@@ -146,6 +174,7 @@ func RemoveAdmin(c *gin.Context) {
 	var request struct {
 		WalletAddress string `json:"wallet_address"`
 		TxHash        string `json:"tx_hash"`
+		ProposalID    uint64 `json:"proposal_id"` // 启用审批时必填
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -153,22 +182,69 @@ func RemoveAdmin(c *gin.Context) {
 		return
 	}
 
-	request.WalletAddress = utils.NormalizeHex(request.WalletAddress)
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
 	request.TxHash = utils.NormalizeHex(request.TxHash)
 
-	// wait for transaction to be mined
-	client, err := utils.NewEthClient()
+	if !checkApprovedProposal(c, request.ProposalID, models.ProposalActionRemoveAdmin, request.WalletAddress) {
+		return
+	}
+
+	// 等待交易上链，并确认这就是执行提议的交易，否则审批记录中会留下无关或失败的交易
+	if err := nft.VerifyAdminTx(c, request.TxHash, "removeAdmin", request.WalletAddress); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction: " + err.Error()})
+		return
+	}
+
+	err := nft.RemoveAdminFromDb(c, request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = markProposalExecuted(request.ProposalID, request.TxHash)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to Ethereum client: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// SetUserRole 设置 auditor、support 等不在链上体现的角色
+// admin 与 root 由链上数据决定，不能通过该接口设置或撤销
+func SetUserRole(c *gin.Context) {
+	var request struct {
+		WalletAddress string `json:"wallet_address"`
+		Role          string `json:"role"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	_, err = utils.WaitForTransactionReceipt(client, common.HexToHash(request.TxHash))
+
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+
+	if !models.IsAssignableRole(request.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role cannot be assigned directly: " + request.Role})
+		return
+	}
+
+	user, err := models.GetUserByWalletAddr(database.Db, request.WalletAddress)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transaction receipt: " + err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target wallet address does not exist in DB, or is not a primary wallet"})
+		return
+	}
+	if !models.IsAssignableRole(user.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change role of an admin or root user, remove the admin first"})
 		return
 	}
 
-	err = nft.RemoveAdminFromDb(c, request.WalletAddress)
+	err = models.SetUserRoleByWalletAddr(database.Db, request.WalletAddress, request.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -176,3 +252,8 @@ func RemoveAdmin(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "OK"})
 }
+
+// GetRoleCacheStats 查看角色查询缓存的命中情况
+func GetRoleCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"stats": models.GetUserCacheStats()})
+}
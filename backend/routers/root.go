@@ -0,0 +1,165 @@
+package routers
+
+import (
+	"backend/biz/nft"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func GetRootList(c *gin.Context) {
+	// get root list from blockchain
+	roots, err := nft.GetRootList(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OK", "roots": roots})
+}
+
+func GenGrantRootTx(c *gin.Context) {
+	var request struct {
+		WalletAddress string `json:"wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+
+	exists, err := models.UserExists(database.Db, request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check if target wallet address exists in DB: " + err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target wallet address does not exist in DB, or is not a primary wallet"})
+		return
+	}
+
+	tx, err := nft.CreateGrantRootTx(c, middlewares.GetWalletAddr(c), request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create grant root transaction: " + err.Error()})
+		return
+	}
+
+	str, err := utils.JsonifyTx(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stringify transaction: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tx": str})
+}
+
+func GrantRoot(c *gin.Context) {
+	var request struct {
+		WalletAddress string `json:"wallet_address"`
+		TxHash        string `json:"tx_hash"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+	request.TxHash = utils.NormalizeHex(request.TxHash)
+
+	// wait for transaction to be mined
+	client, err := utils.NewEthClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to Ethereum client: " + err.Error()})
+		return
+	}
+	_, err = utils.WaitForTransactionReceipt(client, common.HexToHash(request.TxHash))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transaction receipt: " + err.Error()})
+		return
+	}
+
+	err = nft.GrantRootToDb(c, request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+func GenRevokeRootTx(c *gin.Context) {
+	var request struct {
+		WalletAddress string `json:"wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+
+	tx, err := nft.CreateRevokeRootTx(c, middlewares.GetWalletAddr(c), request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create revoke root transaction: " + err.Error()})
+		return
+	}
+
+	str, err := utils.JsonifyTx(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stringify transaction: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tx": str})
+}
+
+func RevokeRoot(c *gin.Context) {
+	var request struct {
+		WalletAddress string `json:"wallet_address"`
+		TxHash        string `json:"tx_hash"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+	request.TxHash = utils.NormalizeHex(request.TxHash)
+
+	// wait for transaction to be mined
+	client, err := utils.NewEthClient()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to Ethereum client: " + err.Error()})
+		return
+	}
+	_, err = utils.WaitForTransactionReceipt(client, common.HexToHash(request.TxHash))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get transaction receipt: " + err.Error()})
+		return
+	}
+
+	err = nft.RevokeRootFromDb(c, request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
@@ -0,0 +1,139 @@
+package routers
+
+import (
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type sessionInfo struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// myWalletAddrs 返回当前用户的全部钱包，未注册的钱包只返回其自身
+func myWalletAddrs(c *gin.Context) ([]string, error) {
+	user, err := models.GetUserByAnyWalletAddr(database.Db, middlewares.GetWalletAddr(c))
+	if err != nil {
+		return []string{middlewares.GetWalletAddr(c)}, nil
+	}
+	return models.ListAllWalletAddrsOfUser(database.Db, user)
+}
+
+// ListMySessions 列出当前用户所有钱包的有效会话
+func ListMySessions(c *gin.Context) {
+	walletAddrs, err := myWalletAddrs(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sessions, err := models.ListActiveSessionsByWalletAddrs(database.Db, walletAddrs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	currentID := middlewares.GetSessionID(c)
+	res := make([]sessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, sessionInfo{Session: s, Current: s.ID == currentID})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": res})
+}
+
+// RevokeMySession 吊销当前用户的某个会话
+func RevokeMySession(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session id"})
+		return
+	}
+
+	walletAddrs, err := myWalletAddrs(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	revoked, err := models.RevokeSession(database.Db, id, walletAddrs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// ListSessionsByWallet 列出任意钱包的有效会话，仅 root 可用
+func ListSessionsByWallet(c *gin.Context) {
+	walletAddr := c.Query("wallet_address")
+	if !resolveWalletInput(c, &walletAddr) {
+		return
+	}
+	if walletAddr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_address cannot be empty"})
+		return
+	}
+
+	sessions, err := models.ListActiveSessionsByWalletAddrs(database.Db, []string{walletAddr})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSessionByID 吊销任意会话，仅 root 可用
+func RevokeSessionByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session id"})
+		return
+	}
+
+	revoked, err := models.RevokeSession(database.Db, id, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeSessionsByWallet 吊销任意钱包的全部会话，仅 root 可用
+func RevokeSessionsByWallet(c *gin.Context) {
+	var request struct {
+		WalletAddress string `json:"wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+	if request.WalletAddress == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_address cannot be empty"})
+		return
+	}
+
+	count, err := models.RevokeAllSessionsByWalletAddr(database.Db, request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "count": count})
+}
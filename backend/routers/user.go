@@ -5,13 +5,17 @@ import (
 	"backend/database/models"
 	"backend/middlewares"
 	"github.com/gin-gonic/gin"
+	"log"
 	"net/http"
+	"strconv"
 )
 
 func RegisterUser(c *gin.Context) {
 	var request struct {
-		Email    string `json:"email"`
-		Nickname string `json:"nickname"`
+		Email    string   `json:"email"`
+		Nickname string   `json:"nickname"`
+		Bio      string   `json:"bio"`
+		Links    []string `json:"links"`
 	}
 	if err := c.BindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
@@ -26,23 +30,41 @@ func RegisterUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Nickname cannot be empty"})
 		return
 	}
+	if err := validateEmail(request.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bio, links, err := sanitizeProfile(request.Bio, request.Links)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	walletAddr := middlewares.GetWalletAddr(c)
 	if walletAddr == "" {
 		c.JSON(http.StatusForbidden, gin.H{"error": "User not verified"})
 		return
 	}
-	if exists, err := models.UserExists(database.Db, walletAddr); err != nil {
+	if exists, err := models.WalletAddrInUse(database.Db, walletAddr); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
 		return
 	} else if exists {
 		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
 		return
 	}
+	if inUse, err := models.EmailInUse(database.Db, request.Email, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email: " + err.Error()})
+		return
+	} else if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use"})
+		return
+	}
 
 	user := &models.User{
 		Email:      request.Email,
 		Nickname:   request.Nickname,
+		Bio:        bio,
+		Links:      links,
 		Role:       models.RoleUser,
 		WalletAddr: walletAddr,
 		CreateTime: 0,
@@ -51,12 +73,24 @@ func RegisterUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert user: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "User registered", "user": user})
+
+	// 注册不因为邮件发送失败而失败，用户可以稍后重新发送
+	verificationSent := true
+	if err := sendEmailVerification(user, user.Email, models.EmailPurposeRegister); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.WalletAddr, err)
+		verificationSent = false
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User registered", "user": user, "verification_sent": verificationSent})
 }
 
+// UpdateUserInfo 更新昵称、简介与外部链接，bio 与 links 未传入时保持不变
+// 传入新的 email 时会向新邮箱发送验证邮件，验证通过后才会生效
 func UpdateUserInfo(c *gin.Context) {
 	var request struct {
-		Nickname string `json:"nickname"`
+		Nickname string   `json:"nickname"`
+		Email    string   `json:"email"`
+		Bio      *string  `json:"bio"`
+		Links    []string `json:"links"`
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -68,13 +102,148 @@ func UpdateUserInfo(c *gin.Context) {
 		return
 	}
 
-	walletAddr := middlewares.GetWalletAddr(c)
+	walletAddr := middlewares.GetUserWalletAddr(c)
 
-	err := models.UpdateUserByWalletAddr(database.Db, walletAddr, request.Nickname)
+	user, err := models.GetUserByWalletAddr(database.Db, walletAddr)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User updated"})
+	if request.Bio != nil || request.Links != nil {
+		bio, links := user.Bio, user.Links
+		if request.Bio != nil {
+			bio = *request.Bio
+		}
+		if request.Links != nil {
+			links = request.Links
+		}
+		bio, links, err = sanitizeProfile(bio, links)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = models.UpdateUserProfileByWalletAddr(database.Db, walletAddr, bio, links)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user: " + err.Error()})
+			return
+		}
+	}
+
+	emailChangePending := false
+	if request.Email != "" && request.Email != user.Email {
+		if code, err := startEmailVerification(user, request.Email); err != nil {
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		emailChangePending = true
+	}
+
+	err = models.UpdateUserByWalletAddr(database.Db, walletAddr, request.Nickname)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User updated", "email_change_pending": emailChangePending})
+}
+
+// ListUsers 分页查询用户目录
+// 调用者没有 user:email:read 权限时不返回邮箱
+func ListUsers(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize <= 0 || pageSize > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page_size"})
+		return
+	}
+
+	var asc bool
+	switch c.DefaultQuery("sort", "create_time_desc") {
+	case "create_time_desc":
+		asc = false
+	case "create_time_asc":
+		asc = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort, must be create_time_asc or create_time_desc"})
+		return
+	}
+
+	users, count, err := models.PageQueryUsers(database.Db, page, pageSize,
+		c.Query("role"), c.Query("status"), c.Query("search"), asc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	canReadEmail, err := models.UserHasPermissions(database.Db, middlewares.GetWalletAddr(c), models.PermUserEmailRead)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !canReadEmail {
+		for i := range users {
+			users[i].Email = ""
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":       users,
+		"count":       count,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (count + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+func SuspendUser(c *gin.Context) {
+	setUserStatus(c, models.UserStatusSuspended)
+}
+
+func UnsuspendUser(c *gin.Context) {
+	setUserStatus(c, models.UserStatusActive)
+}
+
+// setUserStatus 停用或恢复用户，root 用户与当前用户自己不能被停用
+func setUserStatus(c *gin.Context, status string) {
+	var request struct {
+		WalletAddress string `json:"wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+
+	user, err := models.GetUserByWalletAddr(database.Db, request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target wallet address does not exist in DB, or is not a primary wallet"})
+		return
+	}
+	if status == models.UserStatusSuspended {
+		if user.Role == models.RoleRoot {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot suspend a root user"})
+			return
+		}
+		if user.WalletAddr == middlewares.GetUserWalletAddr(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot suspend yourself"})
+			return
+		}
+	}
+
+	err = models.SetUserStatusByWalletAddr(database.Db, user.WalletAddr, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User status updated", "status": status})
 }
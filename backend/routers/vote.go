@@ -1,6 +1,7 @@
 package routers
 
 import (
+	"backend/biz/ens"
 	"backend/biz/vote"
 	"backend/config"
 	"backend/database"
@@ -8,16 +9,75 @@ import (
 	"backend/middlewares"
 	"backend/utils"
 	"github.com/gin-gonic/gin"
+	"log"
 	"net/http"
+	"strings"
 )
 
+const (
+	maxVotePageSize      = 100
+	maxVoteKeywordLength = 100
+)
+
+// voteInfo 投票列表中返回的投票信息，附带 owner 反向解析得到的名称
+// Moderation 只返回给有审核权限的用户
+type voteInfo struct {
+	models.Vote
+	OwnerName  string          `json:"owner_name"`
+	Moderation *voteModeration `json:"moderation,omitempty"`
+}
+
+type voteModeration struct {
+	ModeratorAddr  string `json:"moderator_address"`
+	ModerationNote string `json:"moderation_note"`
+}
+
+// myVoteInfo 当前用户参与的投票，附带用户的 token、角色与选择，投票状态见 state
+type myVoteInfo struct {
+	voteInfo
+	TokenID uint64 `json:"token_id"`
+	Role    string `json:"role"`
+	Option  int64  `json:"option"` // 从 1 开始，0 表示尚未投票
+}
+
+func withOwnerNames(c *gin.Context, votes []models.Vote) []voteInfo {
+	owners := make([]string, 0, len(votes))
+	for _, v := range votes {
+		owners = append(owners, v.OwnerAddr)
+	}
+	names := ens.LookupAddresses(c, owners)
+
+	// 只有存在审核记录时才需要确认调用者的身份
+	moderator := false
+	for _, v := range votes {
+		if v.ModeratorAddr != "" {
+			if viewer, err := getVoteViewer(c); err == nil {
+				moderator = viewer.moderator
+			}
+			break
+		}
+	}
+
+	res := make([]voteInfo, 0, len(votes))
+	for _, v := range votes {
+		info := voteInfo{Vote: v, OwnerName: names[v.OwnerAddr]}
+		if moderator && v.ModeratorAddr != "" {
+			info.Moderation = &voteModeration{ModeratorAddr: v.ModeratorAddr, ModerationNote: v.ModerationNote}
+		}
+		res = append(res, info)
+	}
+	return res
+}
+
 func GetNftContractAddr(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"addr": "0x" + utils.NormalizeHex(config.G.Blockchain.NFTContractAddr)})
 }
 
 func CreateVote(c *gin.Context) {
 	var request struct {
-		VoteAddress string `json:"vote_address"`
+		VoteAddress  string `json:"vote_address"`
+		CommitReveal bool   `json:"commit_reveal"` // 部署的是 VotingCommitReveal 合约
+		Gasless      bool   `json:"gasless"`       // 使用签名的选票投票，结束后锚定结果
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -26,24 +86,113 @@ func CreateVote(c *gin.Context) {
 	}
 
 	request.VoteAddress = utils.NormalizeHex(request.VoteAddress)
+	if request.CommitReveal && request.Gasless {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A vote cannot be both commit-reveal and gasless"})
+		return
+	}
+	if request.Gasless {
+		// 与草稿相同，投票创建时还没有名单与资格规则，只能要求报名
+		info, err := vote.GetVotingInfoFromBlockchain(c, request.VoteAddress)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get vote from blockchain: " + err.Error()})
+			return
+		}
+		if !info.NeedRegistration {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gasless votes must require registration, otherwise anyone can vote with new wallets for free"})
+			return
+		}
+	}
+	if request.CommitReveal {
+		// 普通的 Voting 合约没有 getAllCommits
+		if _, err := vote.GetCommitsFromBlockchain(c, request.VoteAddress); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Contract is not a commit-reveal vote"})
+			return
+		}
+	}
 	// create in db
 	err := models.InsertVote(database.Db, &models.Vote{
 		ContractAddr: request.VoteAddress,
 		OwnerAddr:    middlewares.GetWalletAddr(c),
+		CommitReveal: request.CommitReveal,
+		Gasless:      request.Gasless,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	syncVoteMetadataQuietly(c, request.VoteAddress)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Vote created"})
 }
 
+// syncVoteMetadataQuietly 同步链上信息，失败时只记录日志，之后由定期同步或手动刷新补齐
+func syncVoteMetadataQuietly(c *gin.Context, contractAddr string) {
+	if _, err := vote.SyncVoteMetadata(c, contractAddr); err != nil {
+		log.Printf("Failed to sync metadata of vote %s: %v", contractAddr, err)
+	}
+}
+
+// SyncVoteMetadata 手动刷新投票的链上信息缓存，例如 owner 推进状态之后
+func SyncVoteMetadata(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	v, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+
+	// 同步会调用链上接口并可能发送提醒邮件，只允许 owner 与管理员触发
+	viewer, err := getVoteViewer(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
+		return
+	}
+	owner, err := viewer.owns(v.OwnerAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
+		return
+	}
+	if !owner && !viewer.moderator {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the vote owner or moderators can refresh vote metadata"})
+		return
+	}
+
+	meta, err := vote.SyncVoteMetadata(c, v.ContractAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync vote metadata: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"state": meta.State, "participants": meta.Participants, "turnout": meta.Turnout})
+}
+
+// PageQueryVotes 分页查询投票，默认只返回 listed 的投票
+// 查询自己的投票时返回所有可见性的投票，管理员可以通过 visibility 查看被隐藏的投票
+// 传入 cursor 或不传 page 时使用游标分页，返回 next_cursor，列表更新时不会重复或遗漏
+// state、option_type、need_registration 与 keyword 依赖从链上同步的缓存，尚未同步的投票不会被匹配
 func PageQueryVotes(c *gin.Context) {
 	var request struct {
-		Owner    string `json:"owner"`
-		Page     int    `json:"page"`
-		PageSize int    `json:"page_size"`
+		Owner            string `json:"owner"`
+		Visibility       string `json:"visibility"`
+		States           []int  `json:"states"`
+		OptionType       *int   `json:"option_type"`
+		NeedRegistration *bool  `json:"need_registration"`
+		CreatedFrom      int64  `json:"created_from"`
+		CreatedTo        int64  `json:"created_to"`
+		Participated     *bool  `json:"participated"` // 需要登录
+		Keyword          string `json:"keyword"`
+		Sort             string `json:"sort"` // newest 或 turnout
+		Cursor           string `json:"cursor"`
+		Page             int    `json:"page"`
+		PageSize         int    `json:"page_size"`
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -51,37 +200,143 @@ func PageQueryVotes(c *gin.Context) {
 		return
 	}
 
-	if request.Page <= 0 || request.PageSize <= 0 {
+	if request.Page < 0 || request.PageSize <= 0 || request.PageSize > maxVotePageSize {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page or page_size"})
 		return
 	}
+	if !models.IsVoteSort(request.Sort) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort, must be newest or turnout"})
+		return
+	}
+	if len(request.Keyword) > maxVoteKeywordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Keyword is too long"})
+		return
+	}
+
+	if request.Owner != "" && !resolveWalletInput(c, &request.Owner) {
+		return
+	}
+	if request.Visibility != "" && !models.IsVoteVisibility(request.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility"})
+		return
+	}
 
-	votes, err := models.PageQueryVotes(database.Db, request.Page, request.PageSize, request.Owner)
+	viewer, err := getVoteViewer(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
 		return
 	}
+	owner := false
+	if request.Owner != "" {
+		if owner, err = viewer.owns(request.Owner); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user: " + err.Error()})
+			return
+		}
+	}
+
+	query := &models.VoteQuery{
+		Owner:            request.Owner,
+		States:           request.States,
+		OptionType:       request.OptionType,
+		NeedRegistration: request.NeedRegistration,
+		CreatedFrom:      request.CreatedFrom,
+		CreatedTo:        request.CreatedTo,
+		Keyword:          strings.TrimSpace(request.Keyword),
+		Sort:             request.Sort,
+	}
+	switch {
+	case request.Visibility != "":
+		if request.Visibility != models.VoteVisibilityListed && !owner && !viewer.moderator {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner or moderators can list hidden votes"})
+			return
+		}
+		query.Visibilities = []string{request.Visibility}
+	case !owner:
+		query.Visibilities = []string{models.VoteVisibilityListed}
+	}
+
+	if request.Participated != nil {
+		if viewer.userWalletAddr == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login required to filter by participation"})
+			return
+		}
+		walletAddrs, err := listUserWalletAddrs(viewer.userWalletAddr)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		query.Participated = request.Participated
+		query.ParticipantWallets = walletAddrs
+	}
 
 	// count page
-	count, err := models.CountVotes(database.Db, request.Owner)
+	count, err := models.CountVotes(database.Db, query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if request.Page > 0 && request.Cursor == "" {
+		votes, err := models.PageQueryVotes(database.Db, query, request.Page, request.PageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"votes":       withOwnerNames(c, votes),
+			"count":       count,
+			"page":        request.Page,
+			"page_size":   request.PageSize,
+			"total_pages": (count + int64(request.PageSize) - 1) / int64(request.PageSize),
+		})
+		return
+	}
+
+	var cursor *models.VoteCursor
+	if request.Cursor != "" {
+		if cursor, err = models.DecodeVoteCursor(request.Cursor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	votes, next, err := models.CursorQueryVotes(database.Db, query, cursor, request.PageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	nextCursor := ""
+	if next != nil {
+		nextCursor = next.Encode()
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"votes":       votes,
+		"votes":       withOwnerNames(c, votes),
 		"count":       count,
-		"page":        request.Page,
 		"page_size":   request.PageSize,
-		"total_pages": (count + int64(request.PageSize) - 1) / int64(request.PageSize),
+		"next_cursor": nextCursor,
+		"has_more":    next != nil,
 	})
 }
 
+// listUserWalletAddrs 返回用户的全部钱包，包括关联钱包
+func listUserWalletAddrs(userWalletAddr string) ([]string, error) {
+	user, err := models.GetUserByWalletAddr(database.Db, userWalletAddr)
+	if err != nil {
+		return nil, err
+	}
+	return models.ListAllWalletAddrsOfUser(database.Db, user)
+}
+
+// PageQueryMyVotes 分页查询当前用户参与的投票，附带 token、角色与选择
+// 数据来自 vote_participations 索引，refresh 为 true 时先从链上同步当前用户的 token
 func PageQueryMyVotes(c *gin.Context) {
 	var request struct {
-		Page     int `json:"page"`
-		PageSize int `json:"page_size"`
+		Roles     []string `json:"roles"`      // voter、candidate 或 pending_candidate，为空则不过滤
+		NeedsVote bool     `json:"needs_vote"` // 只返回正在投票且尚未投票的
+		Refresh   bool     `json:"refresh"`
+		Page      int      `json:"page"`
+		PageSize  int      `json:"page_size"`
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -89,52 +344,91 @@ func PageQueryMyVotes(c *gin.Context) {
 		return
 	}
 
-	// get user wallet
-	userWallet := middlewares.GetWalletAddr(c)
-	tokens, err := vote.GetUserRelatedListFromBlockchain(c, userWallet)
+	if request.Page <= 0 || request.PageSize <= 0 || request.PageSize > maxVotePageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page or page_size"})
+		return
+	}
+	for _, role := range request.Roles {
+		if role != models.ParticipationRoleVoter && role != models.ParticipationRoleCandidate && role != models.ParticipationRolePendingCandidate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role, must be voter, candidate or pending_candidate"})
+			return
+		}
+	}
+
+	// get all wallets of user, including linked ones
+	walletAddrs, err := listUserWalletAddrs(middlewares.GetUserWalletAddr(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	// reverse list
-	for i, j := 0, len(tokens)-1; i < j; i, j = i+1, j-1 {
-		tokens[i], tokens[j] = tokens[j], tokens[i]
+	if request.Refresh {
+		if err := vote.SyncUserParticipations(c, walletAddrs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync from blockchain: " + err.Error()})
+			return
+		}
 	}
-	cnt := len(tokens)
-	// cut from list by page and page_size
-	start := (request.Page - 1) * request.PageSize
-	end := request.Page * request.PageSize
-	if start >= len(tokens) {
-		c.JSON(http.StatusOK, gin.H{
-			"votes":       []interface{}{},
-			"count":       len(tokens),
-			"page":        request.Page,
-			"page_size":   request.PageSize,
-			"total_pages": (int64(len(tokens)) + int64(request.PageSize) - 1) / int64(request.PageSize),
-		})
+
+	query := &models.MyVoteQuery{WalletAddrs: walletAddrs, Roles: request.Roles, NeedsVote: request.NeedsVote}
+	participated, count, err := models.PageQueryMyVotes(database.Db, query, request.Page, request.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if end > len(tokens) {
-		end = len(tokens)
-	}
-	tokens = tokens[start:end]
 
-	// get vote info
-	votes := make([]models.Vote, 0)
-	for _, token := range tokens {
-		v, err := models.GetVoteByContractAddr(database.Db, token.Metadata.VotingContract.Hex())
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		votes = append(votes, *v)
+	votes := make([]models.Vote, 0, len(participated))
+	for _, p := range participated {
+		votes = append(votes, p.Vote)
+	}
+	res := make([]myVoteInfo, 0, len(participated))
+	for i, info := range withOwnerNames(c, votes) {
+		res = append(res, myVoteInfo{
+			voteInfo: info,
+			TokenID:  participated[i].TokenID,
+			Role:     participated[i].Role,
+			Option:   participated[i].ChosenOption,
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"votes":       votes,
-		"count":       cnt,
+		"votes":       res,
+		"count":       count,
 		"page":        request.Page,
 		"page_size":   request.PageSize,
-		"total_pages": (int64(cnt) + int64(request.PageSize) - 1) / int64(request.PageSize),
+		"total_pages": (count + int64(request.PageSize) - 1) / int64(request.PageSize),
 	})
 }
+
+// CheckVoteRegistration 前端在报名成为投票人或候选人之前调用，检查后端的报名条件
+// 报名交易由用户直接发送到合约，这里只负责后端维护的条件，例如邮箱是否已验证
+func CheckVoteRegistration(c *gin.Context) {
+	var request struct {
+		VoteAddress string `json:"vote_address"`
+		Role        string `json:"role"` // voter 或 candidate
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if request.Role != "voter" && request.Role != "candidate" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role, must be voter or candidate"})
+		return
+	}
+
+	if _, err := models.GetVoteByContractAddr(database.Db, request.VoteAddress); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
+		return
+	}
+
+	user, err := models.GetUserByWalletAddr(database.Db, middlewares.GetUserWalletAddr(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if config.G.Email.RequireVerifiedForVoting && !user.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email before registering as a " + request.Role})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
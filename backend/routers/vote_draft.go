@@ -0,0 +1,333 @@
+package routers
+
+import (
+	"backend/biz/vote"
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/tally"
+	"backend/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// voteDraftInput 创建与修改草稿时可以填写的字段
+type voteDraftInput struct {
+	Title                 string       `json:"title"`
+	Description           string       `json:"description"`
+	OptionType            int          `json:"option_type"`
+	NeedRegistration      bool         `json:"need_registration"`
+	CandidateNeedApproval bool         `json:"candidate_need_approval"`
+	CommitReveal          bool         `json:"commit_reveal"`
+	Gasless               bool         `json:"gasless"`
+	RawTextOptions        []string     `json:"raw_text_options"`
+	RegistrationStartTime int64        `json:"registration_start_time"`
+	VotingStartTime       int64        `json:"voting_start_time"`
+	VotingEndTime         int64        `json:"voting_end_time"`
+	TallyConfig           tally.Config `json:"tally_config"`
+}
+
+func (in *voteDraftInput) applyTo(draft *models.VoteDraft) {
+	draft.Title = in.Title
+	draft.Description = in.Description
+	draft.OptionType = in.OptionType
+	draft.NeedRegistration = in.NeedRegistration
+	draft.CandidateNeedApproval = in.CandidateNeedApproval
+	draft.CommitReveal = in.CommitReveal
+	draft.Gasless = in.Gasless
+	draft.RawTextOptions = in.RawTextOptions
+	draft.RegistrationStartTime = in.RegistrationStartTime
+	draft.VotingStartTime = in.VotingStartTime
+	draft.VotingEndTime = in.VotingEndTime
+	draft.TallyConfig = in.TallyConfig
+}
+
+// loadAccessibleDraft 读取当前钱包可以访问的草稿，失败时写入错误响应并返回 nil
+func loadAccessibleDraft(c *gin.Context, id uint64) *models.VoteDraft {
+	draft, err := models.GetVoteDraftByID(database.Db, id)
+	if err != nil || !draft.CanAccess(middlewares.GetWalletAddr(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vote draft not found"})
+		return nil
+	}
+	return draft
+}
+
+func CreateVoteDraft(c *gin.Context) {
+	var request voteDraftInput
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	draft := &models.VoteDraft{OwnerAddr: middlewares.GetWalletAddr(c)}
+	request.applyTo(draft)
+	if err := vote.CheckDraftLimits(draft); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.InsertVoteDraft(database.Db, draft); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote draft created", "draft": draft})
+}
+
+// UpdateVoteDraft 保存草稿，owner 与被分享的 admin 都可以修改
+func UpdateVoteDraft(c *gin.Context) {
+	var request struct {
+		ID uint64 `json:"id"`
+		voteDraftInput
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	draft := loadAccessibleDraft(c, request.ID)
+	if draft == nil {
+		return
+	}
+	request.applyTo(draft)
+	if err := vote.CheckDraftLimits(draft); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.UpdateVoteDraft(database.Db, draft); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote draft updated", "draft": draft})
+}
+
+func DeleteVoteDraft(c *gin.Context) {
+	var request struct {
+		ID uint64 `json:"id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	draft := loadAccessibleDraft(c, request.ID)
+	if draft == nil {
+		return
+	}
+	if draft.OwnerAddr != middlewares.GetWalletAddr(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can delete the draft"})
+		return
+	}
+
+	if err := models.DeleteVoteDraft(database.Db, draft.ID); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote draft deleted"})
+}
+
+// GetVoteDraft 预览草稿，同时返回部署前需要解决的问题
+func GetVoteDraft(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid draft id"})
+		return
+	}
+
+	draft := loadAccessibleDraft(c, id)
+	if draft == nil {
+		return
+	}
+
+	problems := vote.ValidateDraft(draft)
+	if problems == nil {
+		problems = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"draft": draft, "problems": problems, "ready": len(problems) == 0})
+}
+
+// ListVoteDrafts 列出当前钱包创建的以及分享给它的草稿，status 为空则列出所有
+func ListVoteDrafts(c *gin.Context) {
+	drafts, err := models.ListVoteDraftsByWalletAddr(database.Db, middlewares.GetWalletAddr(c), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"drafts": drafts})
+}
+
+// ShareVoteDraft 把草稿分享给另一个可以创建投票的用户
+func ShareVoteDraft(c *gin.Context) {
+	var request struct {
+		ID            uint64 `json:"id"`
+		WalletAddress string `json:"wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+
+	draft := loadAccessibleDraft(c, request.ID)
+	if draft == nil {
+		return
+	}
+	if draft.OwnerAddr != middlewares.GetWalletAddr(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can share the draft"})
+		return
+	}
+	if request.WalletAddress == draft.OwnerAddr {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot share the draft with yourself"})
+		return
+	}
+
+	canCreate, err := models.UserHasPermissions(database.Db, request.WalletAddress, models.PermVoteCreate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to check target user: " + err.Error()})
+		return
+	}
+	if !canCreate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target user cannot create votes"})
+		return
+	}
+
+	if err := models.ShareVoteDraft(database.Db, draft.ID, request.WalletAddress); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote draft shared"})
+}
+
+func UnshareVoteDraft(c *gin.Context) {
+	var request struct {
+		ID            uint64 `json:"id"`
+		WalletAddress string `json:"wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !resolveWalletInput(c, &request.WalletAddress) {
+		return
+	}
+
+	draft := loadAccessibleDraft(c, request.ID)
+	if draft == nil {
+		return
+	}
+	if draft.OwnerAddr != middlewares.GetWalletAddr(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can unshare the draft"})
+		return
+	}
+
+	removed, err := models.UnshareVoteDraft(database.Db, draft.ID, request.WalletAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft is not shared with the wallet"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote draft unshared"})
+}
+
+// GenDeployVoteDraftTx 校验草稿并生成部署 Voting 合约的交易，由当前钱包签名发送
+func GenDeployVoteDraftTx(c *gin.Context) {
+	var request struct {
+		ID uint64 `json:"id"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	draft := loadAccessibleDraft(c, request.ID)
+	if draft == nil {
+		return
+	}
+	if draft.Status != models.DraftStatusDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "Vote draft has already been deployed"})
+		return
+	}
+	if problems := vote.ValidateDraft(draft); len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vote draft is not ready to deploy", "problems": problems})
+		return
+	}
+
+	tx, err := vote.CreateDraftDeploymentTx(c, middlewares.GetWalletAddr(c), draft)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create deployment transaction: " + err.Error()})
+		return
+	}
+
+	str, err := utils.JsonifyTx(tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stringify transaction: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tx": str})
+}
+
+// DeployVoteDraft 确认部署交易后把草稿写入 votes 表
+// 与直接创建投票一样，之后仍然需要在 VotingNFT 上调用 addMinter 授权新合约
+func DeployVoteDraft(c *gin.Context) {
+	var request struct {
+		ID     uint64 `json:"id"`
+		TxHash string `json:"tx_hash"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	draft := loadAccessibleDraft(c, request.ID)
+	if draft == nil {
+		return
+	}
+	if draft.Status != models.DraftStatusDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "Vote draft has already been deployed"})
+		return
+	}
+
+	walletAddr := middlewares.GetWalletAddr(c)
+	contractAddr, err := vote.VerifyDraftDeployment(c, walletAddr, draft, request.TxHash)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to verify deployment: " + err.Error()})
+		return
+	}
+
+	err = models.MarkVoteDraftDeployed(database.Db, draft, &models.Vote{
+		ContractAddr:          contractAddr,
+		OwnerAddr:             walletAddr,
+		RegistrationStartTime: draft.RegistrationStartTime,
+		VotingStartTime:       draft.VotingStartTime,
+		VotingEndTime:         draft.VotingEndTime,
+		CommitReveal:          draft.CommitReveal,
+		Gasless:               draft.Gasless,
+		TallyConfig:           draft.TallyConfig,
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	syncVoteMetadataQuietly(c, contractAddr)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote deployed", "vote_address": "0x" + contractAddr})
+}
@@ -0,0 +1,216 @@
+package routers
+
+import (
+	"backend/database"
+	"backend/database/models"
+	"backend/middlewares"
+	"backend/utils"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
+)
+
+// linkChallenges 保存待完成的钱包关联挑战，key 为 主钱包 + ":" + 新钱包
+var (
+	linkChallenges   = make(map[string]string)
+	linkChallengesMu sync.Mutex
+)
+
+func linkChallengeKey(primary, wallet string) string {
+	return primary + ":" + wallet
+}
+
+// ListMyWallets 列出当前用户的主钱包与所有附属钱包
+func ListMyWallets(c *gin.Context) {
+	user, err := models.GetUserByWalletAddr(database.Db, middlewares.GetUserWalletAddr(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	wallets, err := models.ListUserWalletsByUserID(database.Db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"primary": user.WalletAddr, "linked": wallets})
+}
+
+// GenLinkWalletChallenge 生成关联钱包的挑战
+// 挑战需要由当前登录的钱包和待关联的新钱包分别签名
+func GenLinkWalletChallenge(c *gin.Context) {
+	var request struct {
+		WalletAddr string `json:"wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	request.WalletAddr = utils.NormalizeHex(request.WalletAddr)
+	if request.WalletAddr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_address cannot be empty"})
+		return
+	}
+
+	inUse, err := models.WalletAddrInUse(database.Db, request.WalletAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check wallet: " + err.Error()})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Wallet already belongs to a user"})
+		return
+	}
+
+	primary := middlewares.GetUserWalletAddr(c)
+	challenge := fmt.Sprintf("Link wallet 0x%s to account 0x%s: %s", request.WalletAddr, primary, utils.GenerateChallenge())
+
+	linkChallengesMu.Lock()
+	linkChallenges[linkChallengeKey(primary, request.WalletAddr)] = challenge
+	linkChallengesMu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"challenge": challenge})
+}
+
+// LinkWallet 校验两个钱包对挑战的签名，并将新钱包关联到当前用户
+func LinkWallet(c *gin.Context) {
+	var request struct {
+		WalletAddr       string `json:"wallet_address"`
+		Signature        string `json:"signature"`         // 新钱包的签名
+		CurrentSignature string `json:"current_signature"` // 当前登录钱包的签名
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	request.WalletAddr = utils.NormalizeHex(request.WalletAddr)
+	primary := middlewares.GetUserWalletAddr(c)
+	key := linkChallengeKey(primary, request.WalletAddr)
+
+	linkChallengesMu.Lock()
+	challenge, ok := linkChallenges[key]
+	delete(linkChallenges, key)
+	linkChallengesMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No challenge found"})
+		return
+	}
+
+	if err := utils.VerifyChallenge(challenge, utils.NormalizeHex(request.CurrentSignature), middlewares.GetWalletAddr(c)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current wallet verification err: " + err.Error()})
+		return
+	}
+	if err := utils.VerifyChallenge(challenge, utils.NormalizeHex(request.Signature), request.WalletAddr); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "New wallet verification err: " + err.Error()})
+		return
+	}
+
+	user, err := models.GetUserByWalletAddr(database.Db, primary)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	inUse, err := models.WalletAddrInUse(database.Db, request.WalletAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check wallet: " + err.Error()})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Wallet already belongs to a user"})
+		return
+	}
+
+	err = models.InsertUserWallet(database.Db, &models.UserWallet{
+		UserID:     user.ID,
+		WalletAddr: request.WalletAddr,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wallet linked"})
+}
+
+// UnlinkWallet 解除附属钱包的关联，并吊销该钱包的所有会话
+// 主钱包不能被解除关联
+func UnlinkWallet(c *gin.Context) {
+	var request struct {
+		WalletAddr string `json:"wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	request.WalletAddr = utils.NormalizeHex(request.WalletAddr)
+
+	user, err := models.GetUserByWalletAddr(database.Db, middlewares.GetUserWalletAddr(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if request.WalletAddr == user.WalletAddr {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot unlink the primary wallet"})
+		return
+	}
+
+	deleted, err := models.DeleteUserWallet(database.Db, user.ID, request.WalletAddr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wallet is not linked to current user"})
+		return
+	}
+
+	if _, err := models.RevokeAllSessionsByWalletAddr(database.Db, request.WalletAddr); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wallet unlinked"})
+}
+
+// SetPrimaryWallet 将附属钱包设为主钱包
+// admin 和 root 的链上权限绑定在主钱包上，因此这两类用户不能直接更换主钱包，
+// 需要先在链上把权限转移到新钱包（或先移除 admin 身份）
+func SetPrimaryWallet(c *gin.Context) {
+	var request struct {
+		WalletAddr string `json:"wallet_address"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	request.WalletAddr = utils.NormalizeHex(request.WalletAddr)
+
+	user, err := models.GetUserByWalletAddr(database.Db, middlewares.GetUserWalletAddr(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user.Role != models.RoleUser {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin and root users cannot change their primary wallet"})
+		return
+	}
+
+	err = models.SetPrimaryWalletAddr(database.Db, user, request.WalletAddr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Primary wallet updated", "primary": user.WalletAddr})
+}
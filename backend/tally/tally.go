@@ -0,0 +1,321 @@
+// Package tally 根据投票的计票规则统计链上的选票
+package tally
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+const (
+	RulePlurality = "plurality" // 得票最多的选项胜出
+	RuleMajority  = "majority"  // 得票必须超过有效票的一半
+	RuleThreshold = "threshold" // 得票必须达到有效票的 threshold 比例
+)
+
+const (
+	TieBreakFail         = "fail"          // 平票时没有胜者，结果为不通过
+	TieBreakLowestOption = "lowest_option" // 平票时编号最小的选项胜出
+)
+
+// Config 每个投票的计票配置，保存在 votes 表中，零值等价于没有法定人数要求的 plurality
+type Config struct {
+	Rule string `json:"rule"`
+	// 法定人数，投出的票数（是否包括弃权见 AbstainInQuorum）占选民的比例，0 表示不要求
+	Quorum float64 `json:"quorum"`
+	// 选民人数，0 表示使用链上登记为 voter 的 token 数
+	// 不需要报名的投票只有投票后才会获得 token，要求法定人数时必须手动设置
+	Electorate int `json:"electorate"`
+	// threshold 规则下胜出需要的比例，例如 0.6667 表示三分之二
+	Threshold float64 `json:"threshold"`
+	TieBreak  string  `json:"tie_break"`
+	// 作为弃权处理的选项编号，0 表示没有弃权选项。弃权票不计入有效票，也不能胜出
+	AbstainOption   int64 `json:"abstain_option"`
+	AbstainInQuorum bool  `json:"abstain_in_quorum"` // 弃权票是否计入法定人数
+}
+
+// Option 投票的一个选项，ID 从 1 开始
+type Option struct {
+	ID    int64  `json:"id"`
+	Label string `json:"label"`
+}
+
+// Ballot 一个选民的选票，Option 为 0 表示已登记但尚未投票
+type Ballot struct {
+	WalletAddr string `json:"wallet_address"`
+	Option     int64  `json:"option"`
+}
+
+// Input 计票的输入
+type Input struct {
+	Options []Option
+	Ballots []Ballot
+	// 选民是否需要报名，不需要报名时 Ballots 中只有已经投票的人，不能作为选民人数
+	NeedRegistration bool
+}
+
+// OptionCount 选项的得票
+type OptionCount struct {
+	Option
+	Votes int     `json:"votes"`
+	Share float64 `json:"share"` // 占有效票的比例
+}
+
+// Result 计票结果，Explanation 按顺序说明规则是如何应用到选票上的
+type Result struct {
+	Rule        string        `json:"rule"`
+	Counts      []OptionCount `json:"counts"`
+	Electorate  int           `json:"electorate"`
+	Cast        int           `json:"cast"`      // 投出的票数，包括弃权
+	Abstained   int           `json:"abstained"` // 弃权票数
+	Valid       int           `json:"valid"`     // 有效票数，不包括弃权
+	Turnout     float64       `json:"turnout"`
+	QuorumMet   bool          `json:"quorum_met"`
+	Leading     []int64       `json:"leading"` // 得票最多的选项，平票且不处理时有多个
+	Winners     []int64       `json:"winners"` // 通过时只有一个，否则为空
+	Passed      bool          `json:"passed"`
+	Explanation []string      `json:"explanation"`
+}
+
+func (r *Result) explain(format string, args ...interface{}) {
+	r.Explanation = append(r.Explanation, fmt.Sprintf(format, args...))
+}
+
+// CountingRule 计票规则
+type CountingRule interface {
+	Name() string
+	// Decide 在得票统计与法定人数检查完成之后决定胜者与是否通过
+	Decide(cfg *Config, res *Result)
+}
+
+var rules = map[string]CountingRule{
+	RulePlurality: pluralityRule{},
+	RuleMajority:  thresholdRule{name: RuleMajority, threshold: 0.5, strict: true},
+	RuleThreshold: thresholdRule{name: RuleThreshold},
+}
+
+// Register 注册自定义的计票规则，同名规则会被覆盖
+func Register(rule CountingRule) {
+	rules[rule.Name()] = rule
+}
+
+// Validate 检查配置是否合法，options 为空时不检查弃权选项是否存在
+// 不需要报名的投票要求法定人数时，必须设置 Electorate
+func (cfg *Config) Validate(options []Option, needRegistration bool) error {
+	if err := cfg.validateRule(options); err != nil {
+		return err
+	}
+	if cfg.Quorum > 0 && cfg.Electorate == 0 && !needRegistration {
+		return errors.New("Electorate must be set when a quorum is required and voters do not register")
+	}
+	return nil
+}
+
+// validateRule 检查与选民人数无关的配置
+func (cfg *Config) validateRule(options []Option) error {
+	if _, ok := rules[cfg.ruleName()]; !ok {
+		return errors.Errorf("Unknown counting rule %q", cfg.Rule)
+	}
+	if cfg.Quorum < 0 || cfg.Quorum > 1 {
+		return errors.New("Quorum must be between 0 and 1")
+	}
+	if cfg.Electorate < 0 {
+		return errors.New("Electorate cannot be negative")
+	}
+	if cfg.ruleName() == RuleThreshold && (cfg.Threshold <= 0 || cfg.Threshold > 1) {
+		return errors.New("Threshold must be greater than 0 and at most 1")
+	}
+	if cfg.TieBreak != "" && cfg.TieBreak != TieBreakFail && cfg.TieBreak != TieBreakLowestOption {
+		return errors.Errorf("Unknown tie break policy %q", cfg.TieBreak)
+	}
+	if cfg.AbstainOption < 0 {
+		return errors.New("Invalid abstain option")
+	}
+	if cfg.AbstainOption > 0 && len(options) > 0 && !hasOption(options, cfg.AbstainOption) {
+		return errors.Errorf("Abstain option #%d does not exist", cfg.AbstainOption)
+	}
+	return nil
+}
+
+func (cfg *Config) ruleName() string {
+	if cfg.Rule == "" {
+		return RulePlurality
+	}
+	return cfg.Rule
+}
+
+func (cfg *Config) tieBreak() string {
+	if cfg.TieBreak == "" {
+		return TieBreakFail
+	}
+	return cfg.TieBreak
+}
+
+func hasOption(options []Option, id int64) bool {
+	for _, o := range options {
+		if o.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Count 按配置统计选票
+func Count(cfg *Config, in *Input) (*Result, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	// 选民人数不合法的旧配置仍然可以计票，法定人数按不满足处理
+	if err := cfg.validateRule(in.Options); err != nil {
+		return nil, err
+	}
+	rule := rules[cfg.ruleName()]
+	res := &Result{Rule: rule.Name(), Leading: []int64{}, Winners: []int64{}}
+
+	// 1. 统计得票，无效的选项编号直接忽略
+	votes := make(map[int64]int)
+	registered := 0
+	for _, b := range in.Ballots {
+		registered++
+		if b.Option == 0 {
+			continue
+		}
+		if !hasOption(in.Options, b.Option) {
+			res.explain("Ignored a ballot for unknown option #%d", b.Option)
+			continue
+		}
+		res.Cast++
+		if b.Option == cfg.AbstainOption {
+			res.Abstained++
+			continue
+		}
+		votes[b.Option]++
+	}
+	res.Valid = res.Cast - res.Abstained
+	for _, o := range in.Options {
+		if o.ID == cfg.AbstainOption {
+			continue
+		}
+		count := OptionCount{Option: o, Votes: votes[o.ID]}
+		if res.Valid > 0 {
+			count.Share = float64(count.Votes) / float64(res.Valid)
+		}
+		res.Counts = append(res.Counts, count)
+	}
+	sort.SliceStable(res.Counts, func(i, j int) bool { return res.Counts[i].Votes > res.Counts[j].Votes })
+	res.explain("%d ballots cast, %d abstained, %d valid", res.Cast, res.Abstained, res.Valid)
+
+	// 2. 法定人数
+	res.Electorate = cfg.Electorate
+	switch {
+	case res.Electorate > 0:
+		res.explain("Electorate is configured as %d", res.Electorate)
+	case in.NeedRegistration:
+		res.Electorate = registered
+		res.explain("Electorate is the %d registered voters", registered)
+	default:
+		res.explain("Electorate is unknown: voters do not register and no electorate is configured")
+	}
+	counted := res.Cast
+	if !cfg.AbstainInQuorum {
+		counted = res.Valid
+	}
+	if res.Electorate > 0 {
+		res.Turnout = float64(counted) / float64(res.Electorate)
+	}
+	res.QuorumMet = cfg.Quorum == 0 || (res.Electorate > 0 && res.Turnout >= cfg.Quorum)
+	if cfg.Quorum == 0 {
+		res.explain("No quorum required")
+	} else if res.Electorate == 0 {
+		res.explain("Quorum not met: it cannot be checked without an electorate")
+		return res, nil
+	} else if res.QuorumMet {
+		res.explain("Quorum met: turnout %.2f%% >= %.2f%%", res.Turnout*100, cfg.Quorum*100)
+	} else {
+		res.explain("Quorum not met: turnout %.2f%% < %.2f%%", res.Turnout*100, cfg.Quorum*100)
+		return res, nil
+	}
+
+	if res.Valid == 0 {
+		res.explain("No valid votes, nothing passes")
+		return res, nil
+	}
+
+	// 3. 由规则决定胜者
+	rule.Decide(cfg, res)
+	return res, nil
+}
+
+// leaders 返回得票最多的选项，平票时按配置处理
+func leaders(cfg *Config, res *Result) []int64 {
+	top := res.Counts[0].Votes
+	var ids []int64
+	for _, c := range res.Counts {
+		if c.Votes == top {
+			ids = append(ids, c.ID)
+		}
+	}
+	if len(ids) == 1 {
+		return ids
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if cfg.tieBreak() == TieBreakLowestOption {
+		res.explain("Tie between options %v with %d votes, option #%d wins by lowest option", ids, top, ids[0])
+		return ids[:1]
+	}
+	res.explain("Tie between options %v with %d votes, no winner", ids, top)
+	return ids
+}
+
+type pluralityRule struct{}
+
+func (pluralityRule) Name() string {
+	return RulePlurality
+}
+
+func (pluralityRule) Decide(cfg *Config, res *Result) {
+	ids := leaders(cfg, res)
+	res.Leading = ids
+	res.Passed = len(ids) == 1
+	if res.Passed {
+		res.Winners = ids
+		res.explain("Option #%d wins with the most votes (%d)", ids[0], res.Counts[0].Votes)
+	}
+}
+
+// thresholdRule 得票最多的选项还必须达到有效票的一定比例
+type thresholdRule struct {
+	name      string
+	threshold float64 // 为 0 时使用配置中的 threshold
+	strict    bool    // true 表示必须严格超过
+}
+
+func (r thresholdRule) Name() string {
+	return r.name
+}
+
+func (r thresholdRule) Decide(cfg *Config, res *Result) {
+	threshold := r.threshold
+	if threshold == 0 {
+		threshold = cfg.Threshold
+	}
+	ids := leaders(cfg, res)
+	res.Leading = ids
+	if len(ids) != 1 {
+		return
+	}
+
+	share := res.Counts[0].Share
+	op := ">="
+	res.Passed = share >= threshold
+	if r.strict {
+		op = ">"
+		res.Passed = share > threshold
+	}
+	if res.Passed {
+		res.Winners = ids
+		res.explain("Option #%d passes: %.2f%% of valid votes %s %.2f%%", ids[0], share*100, op, threshold*100)
+	} else {
+		res.explain("Option #%d leads but fails: %.2f%% of valid votes is not %s %.2f%%", ids[0], share*100, op, threshold*100)
+	}
+}
@@ -0,0 +1,148 @@
+package tally
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testOptions = []Option{{ID: 1, Label: "A"}, {ID: 2, Label: "B"}, {ID: 3, Label: "C"}, {ID: 4, Label: "Abstain"}}
+
+// ballots 按顺序生成选票，0 表示已登记但尚未投票
+func ballots(options ...int64) []Ballot {
+	res := make([]Ballot, 0, len(options))
+	for _, o := range options {
+		res = append(res, Ballot{Option: o})
+	}
+	return res
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name             string
+		cfg              Config
+		ballots          []Ballot
+		needRegistration bool
+		wantPassed       bool
+		wantWinners      []int64
+		wantLeading      []int64
+		wantQuorumMet    bool
+		wantValid        int
+	}{
+		// plurality
+		{"plurality picks the most votes", Config{}, ballots(1, 1, 2, 3), true, true, []int64{1}, []int64{1}, true, 4},
+		{"plurality wins without majority", Config{Rule: RulePlurality}, ballots(1, 1, 2, 2, 3, 3, 1), true, true, []int64{1}, []int64{1}, true, 7},
+		{"plurality tie fails by default", Config{}, ballots(1, 2), true, false, []int64{}, []int64{1, 2}, true, 2},
+		{"plurality tie lowest option wins", Config{TieBreak: TieBreakLowestOption}, ballots(2, 1, 3, 3, 1), true, true, []int64{1}, []int64{1}, true, 5},
+		{"no ballots passes nothing", Config{}, nil, true, false, []int64{}, []int64{}, true, 0},
+		{"only unvoted registrations", Config{}, ballots(0, 0), true, false, []int64{}, []int64{}, true, 0},
+		{"unknown option is ignored", Config{}, ballots(1, 9, 9, 9), true, true, []int64{1}, []int64{1}, true, 1},
+
+		// majority
+		{"majority above half passes", Config{Rule: RuleMajority}, ballots(1, 1, 2), true, true, []int64{1}, []int64{1}, true, 3},
+		{"majority exactly half fails", Config{Rule: RuleMajority}, ballots(1, 1, 2, 3), true, false, []int64{}, []int64{1}, true, 4},
+		{"majority tie fails", Config{Rule: RuleMajority}, ballots(1, 2), true, false, []int64{}, []int64{1, 2}, true, 2},
+		{"majority tie broken still needs half", Config{Rule: RuleMajority, TieBreak: TieBreakLowestOption}, ballots(1, 2), true, false, []int64{}, []int64{1}, true, 2},
+
+		// threshold
+		{"threshold reached passes", Config{Rule: RuleThreshold, Threshold: 0.6}, ballots(1, 1, 1, 2, 2), true, true, []int64{1}, []int64{1}, true, 5},
+		{"threshold is inclusive", Config{Rule: RuleThreshold, Threshold: 0.5}, ballots(1, 2, 1, 3), true, true, []int64{1}, []int64{1}, true, 4},
+		{"threshold not reached fails", Config{Rule: RuleThreshold, Threshold: 0.6667}, ballots(1, 1, 2), true, false, []int64{}, []int64{1}, true, 3},
+
+		// abstention
+		{"abstain is not a valid vote", Config{Rule: RuleMajority, AbstainOption: 4}, ballots(1, 1, 2, 4, 4, 4), true, true, []int64{1}, []int64{1}, true, 3},
+		{"abstain cannot win", Config{AbstainOption: 4}, ballots(4, 4, 4, 2), true, true, []int64{2}, []int64{2}, true, 1},
+		{"only abstentions pass nothing", Config{AbstainOption: 4}, ballots(4, 4), true, false, []int64{}, []int64{}, true, 0},
+
+		// quorum
+		{"quorum met", Config{Quorum: 0.5}, ballots(1, 1, 0, 0), true, true, []int64{1}, []int64{1}, true, 2},
+		{"quorum not met", Config{Quorum: 0.5}, ballots(1, 0, 0, 0), true, false, []int64{}, []int64{}, false, 1},
+		{"quorum uses configured electorate", Config{Quorum: 0.5, Electorate: 10}, ballots(1, 1, 1), true, false, []int64{}, []int64{}, false, 3},
+		{"abstain excluded from quorum", Config{Quorum: 0.5, AbstainOption: 4}, ballots(1, 4, 0, 0), true, false, []int64{}, []int64{}, false, 1},
+		{"abstain included in quorum", Config{Quorum: 0.5, AbstainOption: 4, AbstainInQuorum: true}, ballots(1, 4, 0, 0), true, true, []int64{1}, []int64{1}, true, 1},
+		{"quorum without registration needs electorate", Config{Quorum: 0.1}, ballots(1, 1, 1), false, false, []int64{}, []int64{}, false, 3},
+		{"quorum without registration uses electorate", Config{Quorum: 0.5, Electorate: 4}, ballots(1, 1, 2), false, true, []int64{1}, []int64{1}, true, 3},
+		{"no quorum without registration", Config{}, ballots(2), false, true, []int64{2}, []int64{2}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Count(&tt.cfg, &Input{Options: testOptions, Ballots: tt.ballots, NeedRegistration: tt.needRegistration})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Passed != tt.wantPassed {
+				t.Errorf("Passed = %v, want %v, explanation %v", res.Passed, tt.wantPassed, res.Explanation)
+			}
+			if !reflect.DeepEqual(res.Winners, tt.wantWinners) {
+				t.Errorf("Winners = %v, want %v", res.Winners, tt.wantWinners)
+			}
+			if !reflect.DeepEqual(res.Leading, tt.wantLeading) {
+				t.Errorf("Leading = %v, want %v", res.Leading, tt.wantLeading)
+			}
+			if res.QuorumMet != tt.wantQuorumMet {
+				t.Errorf("QuorumMet = %v, want %v", res.QuorumMet, tt.wantQuorumMet)
+			}
+			if res.Valid != tt.wantValid {
+				t.Errorf("Valid = %d, want %d", res.Valid, tt.wantValid)
+			}
+			if len(res.Explanation) == 0 {
+				t.Error("Explanation should not be empty")
+			}
+		})
+	}
+}
+
+func TestCountTotals(t *testing.T) {
+	cfg := &Config{AbstainOption: 4}
+	res, err := Count(cfg, &Input{Options: testOptions, Ballots: ballots(1, 2, 2, 4, 0, 7), NeedRegistration: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Electorate != 6 || res.Cast != 4 || res.Abstained != 1 || res.Valid != 3 {
+		t.Fatalf("electorate %d cast %d abstained %d valid %d, want 6 4 1 3", res.Electorate, res.Cast, res.Abstained, res.Valid)
+	}
+	// 弃权选项不出现在得票中，且按得票从高到低排列
+	if len(res.Counts) != 3 || res.Counts[0].ID != 2 || res.Counts[0].Votes != 2 {
+		t.Fatalf("unexpected counts %+v", res.Counts)
+	}
+	if share := res.Counts[0].Share; share < 0.666 || share > 0.667 {
+		t.Fatalf("share = %v, want 2/3", share)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name             string
+		cfg              Config
+		needRegistration bool
+		wantErr          bool
+	}{
+		{"zero value", Config{}, false, false},
+		{"unknown rule", Config{Rule: "borda"}, true, true},
+		{"negative quorum", Config{Quorum: -0.1}, true, true},
+		{"quorum above one", Config{Quorum: 1.1}, true, true},
+		{"negative electorate", Config{Electorate: -1}, true, true},
+		{"threshold missing", Config{Rule: RuleThreshold}, true, true},
+		{"threshold above one", Config{Rule: RuleThreshold, Threshold: 1.5}, true, true},
+		{"threshold ignored by plurality", Config{Threshold: 5}, true, false},
+		{"unknown tie break", Config{TieBreak: "coin"}, true, true},
+		{"missing abstain option", Config{AbstainOption: 9}, true, true},
+		{"negative abstain option", Config{AbstainOption: -1}, true, true},
+		{"quorum with registration", Config{Quorum: 0.5}, true, false},
+		{"quorum without registration needs electorate", Config{Quorum: 0.5}, false, true},
+		{"quorum without registration with electorate", Config{Quorum: 0.5, Electorate: 100}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate(testOptions, tt.needRegistration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCountRejectsInvalidConfig(t *testing.T) {
+	if _, err := Count(&Config{Rule: "borda"}, &Input{Options: testOptions}); err == nil {
+		t.Fatal("Count should reject an unknown rule")
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"backend/utils"
+	"context"
+	"crypto/ecdsa"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"math/big"
+	"testing"
+)
+
+// sendNFTMethodTx 用 key 签名并发送合约方法调用，等待交易成功上链
+func sendNFTMethodTx(t *testing.T, ctx context.Context, client *ethclient.Client, key *ecdsa.PrivateKey, nftAddr, methodName string, params ...interface{}) {
+	t.Helper()
+	tx, err := utils.CreateContractMethodCallTx(ctx, client, crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		utils.ContractVotingNFT, nftAddr, methodName, params...)
+	if err != nil {
+		t.Fatalf("%s: %v", methodName, err)
+	}
+	sendSignedTx(t, ctx, client, key, tx)
+}
+
+func sendSignedTx(t *testing.T, ctx context.Context, client *ethclient.Client, key *ecdsa.PrivateKey, tx *types.Transaction) {
+	t.Helper()
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendTransaction(ctx, signedTx); err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := bind.WaitMined(ctx, client, signedTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("Transaction %s failed", signedTx.Hash().Hex())
+	}
+}
+
+func TestRevokedRootCannotRegrantItself(t *testing.T) {
+	ctx := context.Background()
+	// Connect to Ganache
+	client, err := ethclient.Dial("http://127.0.0.1:7545")
+	if err != nil {
+		t.Fatal("Error connecting to Ganache:", err)
+	}
+
+	// Load the private key of an account from Ganache
+	privateKeyHex := "b500fc1e5a3b0fe14ff36b8137d978fc4a782e6f05276639a0b92ccafe2b4371" // Replace with your Ganache private key
+	oldRootKey, err := crypto.HexToECDSA(privateKeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRoot := crypto.PubkeyToAddress(oldRootKey.PublicKey)
+
+	nftAddr, _, err := utils.DeployContract(ctx, privateKeyHex, utils.ContractVotingNFT)
+	if err != nil {
+		t.Fatal("Failed to deploy contract:", err)
+	}
+
+	// 新的 root 使用随机生成的钱包，由部署者转账支付 gas
+	newRootKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRoot := crypto.PubkeyToAddress(newRootKey.PublicKey)
+	nonce, err := client.PendingNonceAt(ctx, oldRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendSignedTx(t, ctx, client, oldRootKey,
+		types.NewTransaction(nonce, newRoot, big.NewInt(1e18), 21000, gasPrice, nil))
+
+	// 部署者把 root 交给新钱包，再由新 root 撤销部署者的 root，部署者仍然是 admin
+	rootRole := crypto.Keccak256Hash([]byte("ROOT_ROLE"))
+	sendNFTMethodTx(t, ctx, client, oldRootKey, nftAddr, "addAdmin", newRoot)
+	sendNFTMethodTx(t, ctx, client, oldRootKey, nftAddr, "grantRole", [32]byte(rootRole), newRoot)
+	sendNFTMethodTx(t, ctx, client, newRootKey, nftAddr, "revokeRole", [32]byte(rootRole), oldRoot)
+
+	// 被撤销的 root 不能重新授予自己 root，也不能撤销其他 admin
+	_, err = utils.CreateContractMethodCallTx(ctx, client, oldRoot.Hex(), utils.ContractVotingNFT, nftAddr,
+		"grantRole", [32]byte(rootRole), oldRoot)
+	if err == nil {
+		t.Error("A revoked root should not be able to grant ROOT_ROLE to itself")
+	}
+	_, err = utils.CreateContractMethodCallTx(ctx, client, oldRoot.Hex(), utils.ContractVotingNFT, nftAddr,
+		"revokeRole", [32]byte{}, newRoot)
+	if err == nil {
+		t.Error("A revoked root should not be able to revoke DEFAULT_ADMIN_ROLE from another admin")
+	}
+
+	var isRoot bool
+	err = utils.CallViewMethod(ctx, client, utils.ContractVotingNFT, nftAddr, "hasRole",
+		[]interface{}{[32]byte(rootRole), oldRoot}, &isRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isRoot {
+		t.Error("Revoked root should not hold ROOT_ROLE")
+	}
+	var isAdmin bool
+	err = utils.CallViewMethod(ctx, client, utils.ContractVotingNFT, nftAddr, "isAdministrator",
+		[]interface{}{oldRoot}, &isAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isAdmin {
+		t.Error("Revoked root should still be an admin")
+	}
+}
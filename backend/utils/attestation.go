@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"backend/config"
+	"crypto/ecdsa"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+func attestationKey() (*ecdsa.PrivateKey, error) {
+	if config.G.Server.AttestationKey == "" {
+		return nil, errors.New("Attestation key is not configured")
+	}
+	key, err := crypto.HexToECDSA(NormalizeHex(config.G.Server.AttestationKey))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid attestation key")
+	}
+	return key, nil
+}
+
+// AttesterAddr 返回签发证明的地址，验证者用它确认证明来自本服务
+func AttesterAddr() (common.Address, error) {
+	key, err := attestationKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// SignAttestation 按 personal_sign（EIP-191）的格式签名消息，可以用 VerifyAttestation 或任意钱包工具验证
+func SignAttestation(message string) (string, error) {
+	key, err := attestationKey()
+	if err != nil {
+		return "", err
+	}
+	hash := crypto.Keccak256([]byte("\x19Ethereum Signed Message:\n" + fmt.Sprint(len(message)) + message))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to sign attestation")
+	}
+	sig[64] += 27 // 与钱包的签名格式保持一致
+	return hexutil.Encode(sig), nil
+}
+
+// VerifyAttestation 校验消息是否由 signerAddr 签名
+func VerifyAttestation(message, signature, signerAddr string) error {
+	return VerifyChallenge(message, signature, NormalizeHex(signerAddr))
+}
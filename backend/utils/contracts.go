@@ -10,12 +10,15 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/pkg/errors"
+	"math/big"
 	"os"
 	"strings"
 )
 
 const ContractVotingNFT = "VotingNFT_sol_VotingNFT"
 const ContractVoting = "Voting_sol_Voting"
+const ContractVotingCommitReveal = "VotingCommitReveal_sol_VotingCommitReveal"
+const ContractBallotAnchor = "BallotAnchor_sol_BallotAnchor"
 
 // LoadContract 读取 ABI & Bytecode
 func LoadContract(filename string) (string, string, error) {
@@ -86,12 +89,39 @@ func CallViewMethod[T any](
 	params []interface{},
 	out *T,
 ) error {
-	// 1. 解析 ABI
 	abiStr, _, err := LoadContract(contractName)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to load contract")
 	}
+	return CallViewMethodWithABI(ctx, client, abiStr, contractAddr, funcName, params, out)
+}
 
+// CallViewMethodWithABI 与 CallViewMethod 相同，但直接使用传入的 ABI，用于调用不在 contracts_build 中的外部合约
+func CallViewMethodWithABI[T any](
+	ctx context.Context,
+	client *ethclient.Client,
+	abiStr string,
+	contractAddr string,
+	funcName string,
+	params []interface{},
+	out *T,
+) error {
+	return CallViewMethodAtBlock(ctx, client, abiStr, contractAddr, funcName, params, nil, out)
+}
+
+// CallViewMethodAtBlock 在指定区块的状态上调用，blockNumber 为 nil 表示最新区块
+// 查询较早的区块需要节点保留历史状态（archive 节点或 Ganache）
+func CallViewMethodAtBlock[T any](
+	ctx context.Context,
+	client *ethclient.Client,
+	abiStr string,
+	contractAddr string,
+	funcName string,
+	params []interface{},
+	blockNumber *big.Int,
+	out *T,
+) error {
+	// 1. 解析 ABI
 	parsedAbi, err := abi.JSON(strings.NewReader(abiStr))
 	if err != nil {
 		return fmt.Errorf("failed to parse ABI: %w", err)
@@ -111,7 +141,7 @@ func CallViewMethod[T any](
 	}
 
 	// 4. 调用链上（eth_call）
-	output, err := client.CallContract(ctx, msg, nil)
+	output, err := client.CallContract(ctx, msg, blockNumber)
 	if err != nil {
 		return fmt.Errorf("failed to invoke contract: %w", err)
 	}
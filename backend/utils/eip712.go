@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/pkg/errors"
+)
+
+// RecoverTypedDataSigner 恢复 EIP-712 签名（eth_signTypedData_v4）的签名者，同时返回签名的摘要
+func RecoverTypedDataSigner(typedData apitypes.TypedData, signature string) (common.Address, common.Hash, error) {
+	digest, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return common.Address{}, common.Hash{}, errors.Wrapf(err, "failed to hash typed data")
+	}
+
+	sig, err := hexutil.Decode(signature)
+	if err != nil || len(sig) != 65 {
+		return common.Address{}, common.Hash{}, errors.New("签名格式错误")
+	}
+	if sig[64] >= 27 {
+		sig[64] -= 27 // 钱包返回的 v 为 27/28
+	}
+	pubKey, err := crypto.SigToPub(digest, sig)
+	if err != nil {
+		return common.Address{}, common.Hash{}, errors.New("恢复公钥失败")
+	}
+	return crypto.PubkeyToAddress(*pubKey), common.BytesToHash(digest), nil
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// maxImageDimension 解码前先检查图片尺寸，防止很小的文件解码出巨大的图片
+const maxImageDimension = 4096
+
+// ProcessAvatar 校验并重新编码头像，返回边长不超过 size 的正方形头像、边长为 thumbSize 的缩略图以及扩展名
+// 只接受 jpeg、png 与 gif（取第一帧），jpeg 仍编码为 jpeg，其余编码为 png
+// 重新编码会丢弃图片中的元数据以及附加在图片后的其他内容
+func ProcessAvatar(data []byte, size, thumbSize int) ([]byte, []byte, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, "", errors.New("Unsupported image format, only jpeg, png and gif are allowed")
+	}
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return nil, nil, "", errors.New("Unsupported image format, only jpeg, png and gif are allowed")
+	}
+	if cfg.Width > maxImageDimension || cfg.Height > maxImageDimension {
+		return nil, nil, "", errors.Errorf("Image is too large, at most %dx%d", maxImageDimension, maxImageDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, "", errors.Wrapf(err, "Failed to decode image")
+	}
+	img = cropSquare(img)
+	if img.Bounds().Dx() < size {
+		size = img.Bounds().Dx()
+	}
+
+	ext := "png"
+	if format == "jpeg" {
+		ext = "jpg"
+	}
+	avatar, err := encodeImage(resizeImage(img, size), ext)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	thumb, err := encodeImage(resizeImage(img, thumbSize), ext)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return avatar, thumb, ext, nil
+}
+
+// cropSquare 以中心为准裁剪为正方形
+func cropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			dst.Set(x, y, img.At(x0+x, y0+y))
+		}
+	}
+	return dst
+}
+
+// resizeImage 将正方形图片缩放到 size x size，缩小时对每个目标像素覆盖的区域取平均
+func resizeImage(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	src := b.Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy0, sy1 := y*src/size, (y+1)*src/size
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < size; x++ {
+			sx0, sx1 := x*src/size, (x+1)*src/size
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := img.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+func encodeImage(img image.Image, ext string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if ext == "jpg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to encode image")
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encodeTestImage(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	img := testImage(w, h)
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessAvatar(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		wantExt   string
+		wantSize  int // 头像的边长
+		wantThumb int
+		wantErr   bool
+	}{
+		{"png is resized", encodeTestImage(t, "png", 300, 300), "png", 256, 64, false},
+		{"jpeg stays jpeg", encodeTestImage(t, "jpeg", 300, 300), "jpg", 256, 64, false},
+		{"gif is encoded as png", encodeTestImage(t, "gif", 300, 300), "png", 256, 64, false},
+		{"non square is cropped", encodeTestImage(t, "png", 400, 300), "png", 256, 64, false},
+		{"small image is not upscaled", encodeTestImage(t, "png", 100, 80), "png", 80, 64, false},
+		{"too wide", encodeTestImage(t, "png", maxImageDimension+1, 1), "", 0, 0, true},
+		{"too tall", encodeTestImage(t, "png", 1, maxImageDimension+1), "", 0, 0, true},
+		{"not an image", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), "", 0, 0, true},
+		{"empty", nil, "", 0, 0, true},
+		{"truncated png", encodeTestImage(t, "png", 300, 300)[:100], "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			avatar, thumb, ext, err := ProcessAvatar(tt.data, 256, 64)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if ext != tt.wantExt {
+				t.Fatalf("ext = %s, want %s", ext, tt.wantExt)
+			}
+			for _, c := range []struct {
+				data []byte
+				size int
+			}{{avatar, tt.wantSize}, {thumb, tt.wantThumb}} {
+				cfg, format, err := image.DecodeConfig(bytes.NewReader(c.data))
+				if err != nil {
+					t.Fatalf("output is not a valid image: %v", err)
+				}
+				if (format == "jpeg") != (ext == "jpg") {
+					t.Fatalf("output format %s does not match ext %s", format, ext)
+				}
+				if cfg.Width != c.size || cfg.Height != c.size {
+					t.Fatalf("output is %dx%d, want %dx%d", cfg.Width, cfg.Height, c.size, c.size)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessAvatarDropsTrailingData(t *testing.T) {
+	data := append(encodeTestImage(t, "png", 50, 50), []byte("<?php echo 1; ?>")...)
+	avatar, _, _, err := ProcessAvatar(data, 50, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(avatar, []byte("<?php")) {
+		t.Fatal("re-encoded avatar should not keep appended content")
+	}
+}
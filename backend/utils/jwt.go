@@ -8,9 +8,11 @@ import (
 	"time"
 )
 
-func GenerateJWT(walletAddr string) string {
+// GenerateJWT 签发 JWT，sessionID 对应 sessions 表中的记录
+func GenerateJWT(walletAddr string, sessionID uint64) string {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"wallet": walletAddr,
+		"sid":    strconv.FormatUint(sessionID, 10),
 		"time":   strconv.FormatInt(time.Now().Unix(), 10),
 		"key":    config.G.Server.JWTKey,
 	})
@@ -22,23 +24,35 @@ func GenerateJWT(walletAddr string) string {
 }
 
 func VerifyJWT(tokenString string) (string, error) {
+	walletAddr, _, err := VerifyJWTSession(tokenString)
+	return walletAddr, err
+}
+
+// VerifyJWTSession 校验 JWT，并返回钱包地址与会话 ID
+func VerifyJWTSession(tokenString string) (string, uint64, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		return []byte(config.G.Server.JWTSecret), nil
 	})
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to parse token")
+		return "", 0, errors.Wrapf(err, "failed to parse token")
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return "", errors.New("invalid token")
+		return "", 0, errors.New("invalid token")
 	}
-	if config.G.Server.JWTKey != claims["key"].(string) {
-		return "", errors.New("token key has changed, please re-login")
+	if key, _ := claims["key"].(string); config.G.Server.JWTKey != key {
+		return "", 0, errors.New("token key has changed, please re-login")
 	}
-	ts := claims["time"].(string)
+	ts, _ := claims["time"].(string)
 	t, _ := strconv.ParseInt(ts, 10, 64)
 	if time.Now().Sub(time.Unix(t, 0)) > time.Hour*time.Duration(config.G.Server.JWTExpireHr) {
-		return "", errors.New("token expired")
+		return "", 0, errors.New("token expired")
+	}
+	sidStr, _ := claims["sid"].(string)
+	sid, err := strconv.ParseUint(sidStr, 10, 64)
+	if err != nil || sid == 0 {
+		return "", 0, errors.New("token has no session, please re-login")
 	}
-	return claims["wallet"].(string), nil
+	walletAddr, _ := claims["wallet"].(string)
+	return walletAddr, sid, nil
 }
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"backend/config"
+	"fmt"
+	"github.com/pkg/errors"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer 邮件发送接口，生产环境使用 SMTPMailer，开发环境可以使用 LogMailer
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// DefaultMailer 按配置创建的邮件发送器，可以在启动时替换为其他实现
+var DefaultMailer = NewMailer()
+
+// NewMailer 根据 config.G.Email.Mailer 创建邮件发送器，未配置时使用 LogMailer
+func NewMailer() Mailer {
+	switch config.G.Email.Mailer {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     config.G.Email.SMTPHost,
+			Port:     config.G.Email.SMTPPort,
+			Username: config.G.Email.SMTPUser,
+			Password: config.G.Email.SMTPPassword,
+			From:     config.G.Email.From,
+		}
+	default:
+		return &LogMailer{Path: config.G.Email.LogFile}
+	}
+}
+
+// SMTPMailer 通过 SMTP 服务器发送纯文本邮件
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string // 为空表示服务器不需要认证
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	if err := checkMailHeader(to, subject); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	msg := buildMail(m.From, to, subject, body)
+	err := smtp.SendMail(fmt.Sprintf("%s:%d", m.Host, m.Port), auth, m.From, []string{to}, []byte(msg))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to send mail via SMTP")
+	}
+	return nil
+}
+
+// LogMailer 不真正发送邮件，只把邮件内容追加到文件中，Path 为空时输出到标准日志
+type LogMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	if err := checkMailHeader(to, subject); err != nil {
+		return err
+	}
+
+	msg := buildMail(config.G.Email.From, to, subject, body)
+	if m.Path == "" {
+		log.Printf("Mail (not sent):\n%s", msg)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open mail log file")
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "===== %s =====\n%s\n\n", time.Now().Format(time.RFC3339), msg)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write mail log file")
+	}
+	return nil
+}
+
+// checkMailHeader 防止通过收件人或标题注入额外的邮件头
+func checkMailHeader(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return errors.New("Mail header contains line breaks")
+		}
+	}
+	return nil
+}
+
+func buildMail(from, to, subject, body string) string {
+	return "From: " + from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		body
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter 令牌桶限流器的状态存储
+// 默认使用进程内的 MemoryRateLimiter，多实例部署时可以替换为共享存储的实现
+type RateLimiter interface {
+	// Allow 从 key 对应的桶中取出一个令牌
+	// 取不到令牌时返回 false，以及下一个令牌可用前需要等待的时间
+	Allow(key string, rate float64, burst int) (bool, time.Duration)
+}
+
+type tokenBucket struct {
+	tokens   float64
+	rate     float64
+	burst    float64
+	lastTime time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.lastTime).Seconds()*b.rate)
+	b.lastTime = now
+}
+
+// MemoryRateLimiter 进程内的令牌桶实现，长时间未访问且已经装满的桶会被定期清理
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+const rateLimiterSweepInterval = time.Minute
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *MemoryRateLimiter) Allow(key string, rate float64, burst int) (bool, time.Duration) {
+	if rate <= 0 {
+		return true, 0
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > rateLimiterSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), lastTime: now}
+		l.buckets[key] = b
+	}
+
+	b.rate, b.burst = rate, float64(burst)
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep 删除已经补满的桶，这些桶与新建的桶等价
+func (l *MemoryRateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
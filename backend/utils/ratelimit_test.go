@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimiterBurst(t *testing.T) {
+	l := NewMemoryRateLimiter()
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a", 0.01, 3); !ok {
+			t.Fatalf("request %d should be allowed within burst", i)
+		}
+	}
+	ok, wait := l.Allow("a", 0.01, 3)
+	if ok {
+		t.Fatal("request over burst should be denied")
+	}
+	if wait <= 0 || wait > 100*time.Second {
+		t.Fatalf("unexpected wait %v, want (0, 100s]", wait)
+	}
+}
+
+func TestMemoryRateLimiterKeysAreIndependent(t *testing.T) {
+	l := NewMemoryRateLimiter()
+	if ok, _ := l.Allow("a", 0.01, 1); !ok {
+		t.Fatal("first request of a should be allowed")
+	}
+	if ok, _ := l.Allow("a", 0.01, 1); ok {
+		t.Fatal("second request of a should be denied")
+	}
+	if ok, _ := l.Allow("b", 0.01, 1); !ok {
+		t.Fatal("bucket b should not be affected by a")
+	}
+}
+
+func TestMemoryRateLimiterRefill(t *testing.T) {
+	l := NewMemoryRateLimiter()
+	if ok, _ := l.Allow("a", 100, 1); !ok {
+		t.Fatal("first request should be allowed")
+	}
+	if ok, _ := l.Allow("a", 100, 1); ok {
+		t.Fatal("second request should be denied before refill")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if ok, _ := l.Allow("a", 100, 1); !ok {
+		t.Fatal("request should be allowed after refill")
+	}
+}
+
+func TestMemoryRateLimiterEdgeRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		burst   int
+		allowed int // 连续请求中允许的次数，-1 表示不限制
+	}{
+		{"zero rate is unlimited", 0, 0, -1},
+		{"negative rate is unlimited", -1, 5, -1},
+		{"zero burst is treated as one", 0.01, 0, 1},
+		{"burst of five", 0.01, 5, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewMemoryRateLimiter()
+			n := 0
+			for i := 0; i < 20; i++ {
+				if ok, _ := l.Allow("k", tt.rate, tt.burst); ok {
+					n++
+				}
+			}
+			want := tt.allowed
+			if want < 0 {
+				want = 20
+			}
+			if n != want {
+				t.Fatalf("allowed %d requests, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimiterSweep(t *testing.T) {
+	l := NewMemoryRateLimiter()
+	l.Allow("full", 1000, 1)
+	l.Allow("empty", 0.001, 1)
+	time.Sleep(5 * time.Millisecond)
+
+	// 模拟距离上次清理已经超过清理间隔
+	l.lastSweep = time.Now().Add(-2 * rateLimiterSweepInterval)
+	l.Allow("other", 1, 1)
+
+	if _, ok := l.buckets["full"]; ok {
+		t.Fatal("refilled bucket should be swept")
+	}
+	if _, ok := l.buckets["empty"]; !ok {
+		t.Fatal("bucket still waiting for tokens should be kept")
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"github.com/pkg/errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// SanitizeText 去除 HTML 标签与除换行以外的控制字符，并去掉首尾空白
+// 超过 maxLen 个字符时返回错误
+func SanitizeText(s string, maxLen int) (string, error) {
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' {
+			return r
+		}
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) > maxLen {
+		return "", errors.Errorf("Text is too long, at most %d characters", maxLen)
+	}
+	return s, nil
+}
+
+// SanitizeLinks 校验外部链接，只允许 http 与 https，空字符串会被忽略
+func SanitizeLinks(links []string, maxCount, maxLen int) ([]string, error) {
+	res := make([]string, 0, len(links))
+	for _, link := range links {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			continue
+		}
+		if len(link) > maxLen {
+			return nil, errors.Errorf("Link is too long, at most %d characters", maxLen)
+		}
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			return nil, errors.Errorf("Invalid link '%s', only http and https links are allowed", link)
+		}
+		res = append(res, u.String())
+	}
+	if len(res) > maxCount {
+		return nil, errors.Errorf("Too many links, at most %d", maxCount)
+	}
+	return res, nil
+}
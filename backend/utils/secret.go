@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"backend/config"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// GenerateVerifyCode 生成 6 位数字验证码
+func GenerateVerifyCode() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+// SignSecret 使用 JWTSecret 对一次性凭证做 HMAC，数据库中只保存签名，不保存凭证原文
+func SignSecret(secret string) string {
+	mac := hmac.New(sha256.New, []byte(config.G.Server.JWTSecret))
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"backend/config"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Storage 上传文件的存储接口，默认保存在本地磁盘，可以替换为对象存储的实现
+// key 形如 avatars/1-abcdef.png，由后端生成
+type Storage interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// DefaultStorage 按配置创建的文件存储，可以在启动时替换为其他实现
+var DefaultStorage = NewStorage()
+
+var storageKeyPattern = regexp.MustCompile(`^[a-z]+/[A-Za-z0-9_-]+\.(png|jpg)$`)
+
+// ValidStorageKey 检查 key 是否为后端生成的格式，防止读取存储目录以外的文件
+func ValidStorageKey(key string) bool {
+	return storageKeyPattern.MatchString(key)
+}
+
+// NewStorage 根据 config.G.Storage 创建文件存储，目前只内置本地磁盘实现
+func NewStorage() Storage {
+	dir := config.G.Storage.LocalDir
+	if dir == "" {
+		dir = "./uploads"
+	}
+	return &LocalStorage{Dir: dir}
+}
+
+// LocalStorage 把文件保存在本地目录中
+type LocalStorage struct {
+	Dir string
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if !ValidStorageKey(key) {
+		return "", errors.Errorf("Invalid storage key '%s'", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStorage) Put(key string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errors.Wrapf(err, "Failed to create storage directory")
+	}
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		return errors.Wrapf(err, "Failed to write file")
+	}
+	return nil
+}
+
+func (s *LocalStorage) Get(key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read file")
+	}
+	return data, nil
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Failed to delete file")
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"backend/config"
+	"bytes"
 	"context"
 	"encoding/hex"
 	"github.com/ethereum/go-ethereum"
@@ -36,6 +37,17 @@ func CreateContractDeploymentTx(ctx context.Context, client *ethclient.Client, p
 		return nil, errors.Wrapf(err, "Failed to get gas price: %v", err)
 	}
 
+	finalBytecode, err := BuildContractDeploymentData(contractName, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := types.NewContractCreation(nonce, big.NewInt(0), gasLimit, gasPrice, finalBytecode)
+	return tx, nil
+}
+
+// BuildContractDeploymentData 返回部署合约时交易的 data，即 bytecode 加上编码后的构造参数
+func BuildContractDeploymentData(contractName string, params ...interface{}) ([]byte, error) {
 	contractABI, contractBIN, err := LoadContract(contractName)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to load contract %s", contractName)
@@ -50,10 +62,7 @@ func CreateContractDeploymentTx(ctx context.Context, client *ethclient.Client, p
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to pack constructor arguments")
 	}
-	finalBytecode := append(common.FromHex(contractBIN), constructorArgs...)
-
-	tx := types.NewContractCreation(nonce, big.NewInt(0), gasLimit, gasPrice, finalBytecode)
-	return tx, nil
+	return append(common.FromHex(contractBIN), constructorArgs...), nil
 }
 
 func CreateContractMethodCallTx(
@@ -114,6 +123,52 @@ func CreateContractMethodCallTx(
 	return tx, nil
 }
 
+// BuildContractMethodCallData 按 ABI 打包方法调用的数据，与 CreateContractMethodCallTx 生成的交易数据相同
+func BuildContractMethodCallData(contractName, methodName string, params ...interface{}) ([]byte, error) {
+	contractABI, _, err := LoadContract(contractName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load contract %s", contractName)
+	}
+	parsedABI, err := abi.JSON(strings.NewReader(contractABI))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse ABI")
+	}
+	data, err := parsedABI.Pack(methodName, params...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to pack method %s", methodName)
+	}
+	return data, nil
+}
+
+// VerifyContractMethodCallTx 等待交易上链，确认交易执行成功、发给 contractAddress，且调用的正是 methodName(params...)
+// 用户提交的 tx_hash 不可信，写入数据库之前需要确认它就是生成的那笔交易
+func VerifyContractMethodCallTx(ctx context.Context, client *ethclient.Client, txHash common.Hash,
+	contractName, contractAddress, methodName string, params ...interface{}) error {
+	receipt, err := WaitForTransactionReceipt(client, txHash)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get transaction receipt")
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return errors.New("Transaction failed")
+	}
+
+	tx, _, err := client.TransactionByHash(ctx, txHash)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get transaction")
+	}
+	if tx.To() == nil || *tx.To() != common.HexToAddress(contractAddress) {
+		return errors.New("Transaction was not sent to the contract")
+	}
+	expected, err := BuildContractMethodCallData(contractName, methodName, params...)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tx.Data(), expected) {
+		return errors.Errorf("Transaction does not call %s with the expected arguments", methodName)
+	}
+	return nil
+}
+
 func StringifyTx(tx *types.Transaction) (string, error) {
 	str, err := tx.MarshalBinary()
 	if err != nil {
@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: MIT
+pragma solidity >=0.7.0 <0.9.0;
+
+import "./node_modules/@openzeppelin/contracts/utils/cryptography/MerkleProof.sol";
+
+interface IVotingOwner {
+    function isOwner(address addr) external view returns (bool);
+}
+
+// 锚定免 gas 投票的结果：选票在链下按 EIP-712 签名并由后端收集，投票结束后 owner 在这里记录一次全部选票的 Merkle 根，
+// 每个投票人都可以据此证明自己的选票被计入；没有选票时根为全零
+//
+// 叶子的计算方式：leaf = keccak256(bytes.concat(keccak256(abi.encode(address voter, int256 option, uint256 issuedAt))))
+contract BallotAnchor {
+    struct Anchor {
+        bytes32 ballotRoot;
+        uint256 ballotCount;
+        bytes32 resultHash; // 计票结果的 keccak256(abi.encode(options, votes, electorate, cast, abstained, quorumMet, passed, winners))
+        uint256 timestamp;
+    }
+
+    mapping(address => Anchor) public anchors;
+
+    event Anchored(address indexed voting, bytes32 ballotRoot, uint256 ballotCount, bytes32 resultHash);
+
+    function anchor(address voting, bytes32 ballotRoot, uint256 ballotCount, bytes32 resultHash) public {
+        require(IVotingOwner(voting).isOwner(msg.sender), "Only owner can anchor the vote");
+        require(anchors[voting].timestamp == 0, "Vote already anchored");
+        anchors[voting] = Anchor(ballotRoot, ballotCount, resultHash, block.timestamp);
+        emit Anchored(voting, ballotRoot, ballotCount, resultHash);
+    }
+
+    function getAnchor(address voting) public view returns (Anchor memory) {
+        return anchors[voting];
+    }
+
+    function verifyBallot(address voting, bytes32[] memory proof, bytes32 leaf) public view returns (bool) {
+        require(anchors[voting].timestamp != 0, "Vote not anchored");
+        return MerkleProof.verify(proof, anchors[voting].ballotRoot, leaf);
+    }
+}
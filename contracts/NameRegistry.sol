@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: MIT
+pragma solidity >=0.7.0 <0.9.0;
+
+// 与 ENS 兼容的最小名称注册表，用于在本地开发链上提供地址与名称的解析
+// 后端只依赖 registry.resolver(node)、resolver.addr(node) 与 resolver.name(node)，因此也可以直接指向真正的 ENS
+contract NameRegistry {
+    struct Record {
+        address owner;
+        address resolver;
+    }
+
+    mapping(bytes32 => Record) private records;
+
+    event NewOwner(bytes32 indexed node, bytes32 indexed label, address owner);
+    event Transfer(bytes32 indexed node, address owner);
+    event NewResolver(bytes32 indexed node, address resolver);
+
+    modifier authorised(bytes32 node) {
+        require(records[node].owner == msg.sender, "Not authorised");
+        _;
+    }
+
+    constructor() {
+        records[0x0].owner = msg.sender;
+    }
+
+    function setOwner(bytes32 node, address owner_) public authorised(node) {
+        records[node].owner = owner_;
+        emit Transfer(node, owner_);
+    }
+
+    function setSubnodeOwner(bytes32 node, bytes32 label, address owner_) public authorised(node) returns (bytes32) {
+        bytes32 subnode = keccak256(abi.encodePacked(node, label));
+        records[subnode].owner = owner_;
+        emit NewOwner(node, label, owner_);
+        return subnode;
+    }
+
+    function setResolver(bytes32 node, address resolver_) public authorised(node) {
+        records[node].resolver = resolver_;
+        emit NewResolver(node, resolver_);
+    }
+
+    function owner(bytes32 node) public view returns (address) {
+        return records[node].owner;
+    }
+
+    function resolver(bytes32 node) public view returns (address) {
+        return records[node].resolver;
+    }
+}
+
+// 同时保存正向（名称 -> 地址）与反向（地址 -> 名称）记录的解析器
+contract NameResolver {
+    NameRegistry public registry;
+
+    mapping(bytes32 => address) private addresses;
+    mapping(bytes32 => string) private names;
+
+    event AddrChanged(bytes32 indexed node, address a);
+    event NameChanged(bytes32 indexed node, string name);
+
+    modifier authorised(bytes32 node) {
+        require(registry.owner(node) == msg.sender, "Not authorised");
+        _;
+    }
+
+    constructor(NameRegistry _registry) {
+        registry = _registry;
+    }
+
+    function setAddr(bytes32 node, address a) public authorised(node) {
+        addresses[node] = a;
+        emit AddrChanged(node, a);
+    }
+
+    function addr(bytes32 node) public view returns (address) {
+        return addresses[node];
+    }
+
+    function setName(bytes32 node, string memory name_) public authorised(node) {
+        names[node] = name_;
+        emit NameChanged(node, name_);
+    }
+
+    function name(bytes32 node) public view returns (string memory) {
+        return names[node];
+    }
+}
+
+// 让任意地址为自己设置反向记录 <地址>.addr.reverse
+// 部署后需要由注册表的所有者把 addr.reverse 节点转移给本合约
+contract ReverseRegistrar {
+    // namehash("addr.reverse")
+    bytes32 public constant ADDR_REVERSE_NODE = 0x91d1777781884d03a6757a803996e38de2a42967fb37eeaca72729271025a9e2;
+
+    NameRegistry public registry;
+    NameResolver public defaultResolver;
+
+    constructor(NameRegistry _registry, NameResolver _resolver) {
+        registry = _registry;
+        defaultResolver = _resolver;
+    }
+
+    function setName(string memory name_) public returns (bytes32) {
+        bytes32 label = sha3HexAddress(msg.sender);
+        bytes32 node = registry.setSubnodeOwner(ADDR_REVERSE_NODE, label, address(this));
+        registry.setResolver(node, address(defaultResolver));
+        defaultResolver.setName(node, name_);
+        registry.setOwner(node, msg.sender);
+        return node;
+    }
+
+    function node(address addr) public pure returns (bytes32) {
+        return keccak256(abi.encodePacked(ADDR_REVERSE_NODE, sha3HexAddress(addr)));
+    }
+
+    // 地址的小写十六进制（不带 0x）的 keccak256
+    function sha3HexAddress(address addr) private pure returns (bytes32) {
+        bytes memory hexChars = "0123456789abcdef";
+        bytes memory s = new bytes(40);
+        uint160 value = uint160(addr);
+        for (uint i = 0; i < 20; i++) {
+            uint8 b = uint8(value >> (8 * (19 - i)));
+            s[2 * i] = hexChars[b >> 4];
+            s[2 * i + 1] = hexChars[b & 0x0f];
+        }
+        return keccak256(s);
+    }
+}
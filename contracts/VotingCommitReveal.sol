@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: MIT
+pragma solidity >=0.7.0 <0.9.0;
+
+import "./VotingNFT.sol";
+
+// Voting 的 commit-reveal 版本：投票阶段只提交加盐的哈希，揭示之后才把选项写入 VotingNFT，投票期间任何人都看不到中间结果
+// getVote、isOwner、registerVoter、registerCandidate 与 approveCandidate 的 ABI 与 Voting 保持一致
+contract VotingCommitReveal {
+    VotingNFT public votingNFT;
+
+    enum OptionType { Candidate, RawText }
+    // Voting 即提交承诺的阶段；Reveal 追加在 Ended 之后，使与 Voting.State 相同的状态取值保持不变
+    enum State { Init, Registration, Voting, Ended, Reveal }
+    string public constant UserVoteRoleVoter = "voter";
+    string public constant UserVoteRoleCandidate = "candidate";
+    string public constant UserVoteRolePendingCandidate = "pending_candidate";
+
+    struct Option {
+        int id; // starts from 1
+        string rawText;
+        address candidate;
+    }
+
+    struct Vote {
+        int version;
+        address admin;
+        string title;
+        string description;
+        OptionType optionType;
+        bool needRegistration;
+        bool candidateNeedApproval;
+        State state;
+        Option[] options;
+    }
+
+    struct CommitInfo {
+        address voter;
+        bytes32 commitment;
+        bool revealed;
+    }
+
+    Vote public vote;
+    bool public constant commitReveal = true;
+
+    mapping(address => bytes32) public commitments;
+    mapping(address => bool) public revealed;
+    address[] public committers;
+
+    constructor(
+        address _nftContract,
+        string memory _title,
+        string memory _description,
+        OptionType _optionType,
+        bool _needRegistration,
+        bool _candidateNeedApproval,
+        string[] memory _raw_text_options
+    ) {
+        votingNFT = VotingNFT(_nftContract);
+
+        vote.version = 1;
+        vote.admin = msg.sender;
+        vote.title = _title;
+        vote.description = _description;
+        vote.optionType = _optionType;
+        vote.needRegistration = _needRegistration;
+        vote.candidateNeedApproval = _candidateNeedApproval;
+        vote.state = State.Init;
+
+        if (_optionType == OptionType.RawText) {
+            for (uint i = 0; i < _raw_text_options.length; i++) {
+                vote.options.push(Option({
+                    id: int(i) + 1,
+                    rawText: _raw_text_options[i],
+                    candidate: address(0)
+                }));
+            }
+        }
+    }
+
+    function getVote() public view returns (Vote memory) {
+        return vote;
+    }
+
+    function isOwner(address addr) public view returns (bool) {
+        return addr == vote.admin;
+    }
+
+    function hasRegistrationState() public view returns (bool) {
+        return vote.optionType == OptionType.Candidate || vote.needRegistration;
+    }
+
+    function getNextState() public view returns (State) {
+        if (vote.state == State.Init) {
+            if (hasRegistrationState()) {
+                return State.Registration;
+            } else {
+                return State.Voting;
+            }
+        } else if (vote.state == State.Registration) {
+            return State.Voting;
+        } else if (vote.state == State.Voting) {
+            return State.Reveal;
+        } else {
+            return State.Ended;
+        }
+    }
+
+    function nextState() public {
+        require(isOwner(msg.sender), "Only owner can change state");
+        vote.state = getNextState();
+    }
+
+    function getAllStates() public view returns (State[] memory) {
+        uint stateCount = 4; // Init、Voting、Reveal、Ended
+        if (hasRegistrationState()) {
+            stateCount++;
+        }
+
+        State[] memory states = new State[](stateCount);
+        uint index = 0;
+        states[index++] = State.Init;
+        if (hasRegistrationState()) {
+            states[index++] = State.Registration;
+        }
+        states[index++] = State.Voting;
+        states[index++] = State.Reveal;
+        states[index] = State.Ended;
+
+        return states;
+    }
+
+    function registerVoter() public {
+        require(votingNFT.isAuthorizedMinter(address(this)), "Voting contract not authorized");
+        require(vote.state == State.Registration || (vote.state == State.Voting && vote.needRegistration == false), "Voting contract not in registration state");
+        votingNFT.mint(msg.sender, address(this), UserVoteRoleVoter);
+    }
+
+    function registerCandidate() public {
+        require(votingNFT.isAuthorizedMinter(address(this)), "Voting contract not authorized");
+        require(vote.optionType == OptionType.Candidate, "Voting contract does not support candidate registration");
+        require(vote.state == State.Registration, "Voting contract not in registration state");
+        if (vote.candidateNeedApproval && !isOwner(msg.sender)) {
+            votingNFT.mint(msg.sender, address(this), UserVoteRolePendingCandidate);
+        } else {
+            votingNFT.mint(msg.sender, address(this), UserVoteRoleCandidate);
+            vote.options.push(Option({
+                id: int(vote.options.length) + 1,
+                rawText: "",
+                candidate: msg.sender
+            }));
+        }
+    }
+
+    function approveCandidate(address candidate) public {
+        require(votingNFT.isAuthorizedMinter(address(this)), "Voting contract not authorized");
+        require(vote.optionType == OptionType.Candidate, "Voting contract does not support candidate registration");
+        require(vote.state == State.Registration, "Voting contract not in registration state");
+        require(isOwner(msg.sender), "Only owner can approve candidate");
+        require(vote.candidateNeedApproval, "Voting contract does not require candidate approval");
+        require(compareStrings(votingNFT.getUserRoleInVoting(candidate, address(this)), UserVoteRolePendingCandidate), "User is not a pending candidate");
+        votingNFT.updateTokenRole(votingNFT.getUserTokenInVoting(candidate, address(this)), UserVoteRoleCandidate);
+        vote.options.push(Option({
+            id: int(vote.options.length) + 1,
+            rawText: "",
+            candidate: candidate
+        }));
+    }
+
+    // 承诺的计算方式：commitment = keccak256(abi.encodePacked(int256 option, bytes32 salt, address voter, address votingContract))
+    function commit(bytes32 commitment) public {
+        require(votingNFT.isAuthorizedMinter(address(this)), "Voting contract not authorized");
+        require(vote.state == State.Voting, "Voting contract not in commit state");
+        require(commitment != bytes32(0), "Empty commitment");
+        require(commitments[msg.sender] == bytes32(0), "User already committed");
+        require(!compareStrings(votingNFT.getUserRoleInVoting(msg.sender, address(this)), UserVoteRoleCandidate), "User is not a voter but a candidate");
+        require(!vote.needRegistration || compareStrings(votingNFT.getUserRoleInVoting(msg.sender, address(this)), UserVoteRoleVoter), "User is not registered as a voter");
+
+        if (!vote.needRegistration) {
+            registerVoter();
+        }
+        commitments[msg.sender] = commitment;
+        committers.push(msg.sender);
+    }
+
+    function computeCommitment(int option, bytes32 salt, address voter) public view returns (bytes32) {
+        return keccak256(abi.encodePacked(option, salt, voter, address(this)));
+    }
+
+    // option 从 1 开始
+    function reveal(int option, bytes32 salt) public {
+        require(vote.state == State.Reveal, "Voting contract not in reveal state");
+        require(commitments[msg.sender] != bytes32(0), "User has not committed");
+        require(!revealed[msg.sender], "User already revealed");
+        require(computeCommitment(option, salt, msg.sender) == commitments[msg.sender], "Commitment mismatch");
+
+        bool found = false;
+        for (uint i = 0; i < vote.options.length; i++) {
+            if (vote.options[i].id == option) {
+                found = true;
+                break;
+            }
+        }
+        require(found, "Option not found");
+
+        revealed[msg.sender] = true;
+        votingNFT.updateTokenOption(votingNFT.getUserTokenInVoting(msg.sender, address(this)), option);
+    }
+
+    function getAllCommits() public view returns (CommitInfo[] memory) {
+        CommitInfo[] memory res = new CommitInfo[](committers.length);
+        for (uint i = 0; i < committers.length; i++) {
+            res[i] = CommitInfo(committers[i], commitments[committers[i]], revealed[committers[i]]);
+        }
+        return res;
+    }
+
+    function compareStrings(string memory _a, string memory _b) internal pure returns(bool) {
+        return keccak256(abi.encodePacked(_a)) == keccak256(abi.encodePacked(_b));
+    }
+}
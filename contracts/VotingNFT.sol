@@ -23,6 +23,9 @@ contract VotingNFT is ERC721Enumerable, AccessControlEnumerable {
     constructor() ERC721("VotingParticipation", "VOTE-NFT") {
         _setupRole(DEFAULT_ADMIN_ROLE, msg.sender);
         _setupRole(ROOT_ROLE, msg.sender);
+        // Only roots manage roots and admins, otherwise a revoked root (still an admin) could grant ROOT_ROLE to itself again
+        _setRoleAdmin(ROOT_ROLE, ROOT_ROLE);
+        _setRoleAdmin(DEFAULT_ADMIN_ROLE, ROOT_ROLE);
         nextTokenId = 1;
     }
 